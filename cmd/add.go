@@ -21,7 +21,11 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var blueprint string = ""
+var (
+	blueprint   string = ""
+	useMarkdown bool
+	frontMatter string = "yaml"
+)
 
 // addCmd represents the add command
 var addCmd = &cobra.Command{
@@ -33,6 +37,11 @@ and the name should be an internal name for the page. Possible types are:
 
 page    - a standalone page
 article - a blog post used in a sequence of posts
+
+Articles can be written in markdown by using the --markdown flag. The article's
+metadata is then stored as front matter in the markdown file, and the blueprint,
+if any, is used as the template for the article. The rendered markdown is 
+available in the blueprint as {{ .content }}
 `,
 	Args: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
@@ -44,6 +53,17 @@ article - a blog post used in a sequence of posts
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		bh := internal.FromEnv()
+		if useMarkdown {
+			if args[0] != "article" {
+				println("Only articles can be written in markdown")
+				return
+			}
+			if err := bh.AddMarkdown(args[1], blueprint, frontMatter); err != nil {
+				println(err.Error())
+			}
+			return
+		}
+
 		if err := bh.Add(args[0], args[1], blueprint); err != nil {
 			println(err.Error())
 		}
@@ -52,5 +72,7 @@ article - a blog post used in a sequence of posts
 
 func init() {
 	addCmd.Flags().StringVarP(&blueprint, "blueprint", "b", "", "Specify the blueprint to initialize the page with")
+	addCmd.Flags().BoolVarP(&useMarkdown, "markdown", "m", false, "Write the article in markdown with front matter")
+	addCmd.Flags().StringVarP(&frontMatter, "front-matter", "f", "yaml", "Front matter format for markdown articles, yaml or toml")
 	rootCmd.AddCommand(addCmd)
 }
@@ -0,0 +1,132 @@
+/*
+Copyright © 2021 David Wiles david@wiles.fyi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/david-wiles/bloghead/internal"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var dryRun bool
+
+var articleCmd = &cobra.Command{
+	Use:   "article",
+	Short: "List, remove, move and rename articles",
+	Long: `Manage the site's articles. An article is named by its path relative to the root
+directory, without the extension, as given to 'bloghead add article'. Moving or
+removing an article keeps its page, its _meta.json, its content directory in
+.templates/.data and the list of articles in the configuration consistent, and
+deletes the article's published output. Use --dry-run to see the changes first.
+`,
+}
+
+var articleListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists every article with its status",
+	Run: func(cmd *cobra.Command, args []string) {
+		bh := internal.FromEnv()
+		if err := bh.ListArticles(); err != nil {
+			println(err.Error())
+		}
+	},
+}
+
+var articleRmCmd = &cobra.Command{
+	Use:   "rm [name]",
+	Short: "Removes an article",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		bh := internal.FromEnv()
+		changes, err := bh.RemoveArticle(args[0], dryRun)
+		printArticleChanges(changes)
+		if err != nil {
+			println(err.Error())
+		}
+	},
+}
+
+var articleMvCmd = &cobra.Command{
+	Use:   "mv [name] [directory]",
+	Short: "Moves an article to another directory, keeping its name",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("Requires name and directory arguments")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		bh := internal.FromEnv()
+		changes, err := bh.MoveArticleToDir(args[0], args[1], dryRun)
+		printArticleChanges(changes)
+		if err != nil {
+			println(err.Error())
+		}
+	},
+}
+
+var articleRenameCmd = &cobra.Command{
+	Use:   "rename [name] [new name]",
+	Short: "Renames an article, keeping its directory",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("Requires name and new name arguments")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		bh := internal.FromEnv()
+		changes, err := bh.RenameArticle(args[0], args[1], dryRun)
+		printArticleChanges(changes)
+		if err != nil {
+			println(err.Error())
+		}
+	},
+}
+
+// Prints each change relative to the working directory
+func printArticleChanges(changes []internal.ArticleChange) {
+	cwd, _ := os.Getwd()
+	rel := func(p string) string {
+		if r, err := filepath.Rel(cwd, p); err == nil {
+			return r
+		}
+		return p
+	}
+
+	for _, c := range changes {
+		switch {
+		case c.To == "" && dryRun:
+			fmt.Printf("Would remove %v\n", rel(c.From))
+		case c.To == "":
+			fmt.Printf("Removed %v\n", rel(c.From))
+		case dryRun:
+			fmt.Printf("Would move %v to %v\n", rel(c.From), rel(c.To))
+		default:
+			fmt.Printf("Moved %v to %v\n", rel(c.From), rel(c.To))
+		}
+	}
+}
+
+func init() {
+	articleCmd.PersistentFlags().BoolVarP(&dryRun, "dry-run", "n", false, "--dry-run, -n. Print the changes without making them")
+	articleCmd.AddCommand(articleListCmd, articleRmCmd, articleMvCmd, articleRenameCmd)
+	rootCmd.AddCommand(articleCmd)
+}
@@ -0,0 +1,43 @@
+/*
+Copyright © 2021 David Wiles david@wiles.fyi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/david-wiles/bloghead/internal"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Validates every page and template without building the site",
+	Long: `Parses every page and template in the root directory and follows the templates
+each one includes. Reports syntax errors, missing templates, and templates which
+include each other in a loop.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		bh := internal.FromEnv()
+		if err := bh.Check(); err != nil {
+			println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+}
@@ -0,0 +1,50 @@
+/*
+Copyright © 2021 David Wiles david@wiles.fyi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/david-wiles/bloghead/internal"
+	"net"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	devHost string
+	devPort int
+)
+
+var devCmd = &cobra.Command{
+	Use:   "dev",
+	Short: "Builds and watches the site while serving it with live reload",
+	Long: `Builds the site and watches it for changes, like publish --watch, while serving 
+the output directory. Pages open in the browser are reloaded when they are rebuilt,
+and compile errors are shown in the browser on top of the page.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		bh := internal.FromEnv()
+		if err := bh.Dev(net.JoinHostPort(devHost, strconv.Itoa(devPort))); err != nil {
+			println(err.Error())
+		}
+	},
+}
+
+func init() {
+	devCmd.Flags().StringVar(&devHost, "host", "localhost", "--host. Host to listen on")
+	devCmd.Flags().IntVarP(&devPort, "port", "p", 8081, "--port, -p. Port to listen on")
+	rootCmd.AddCommand(devCmd)
+}
@@ -23,9 +23,17 @@ import (
 	"path"
 )
 
+var initOptions internal.InitOptions
+
 var initCmd = &cobra.Command{
-	Use:   "init",
+	Use:   "init [directory]",
 	Short: "Initialize a new site in the specified directory",
+	Long: `Writes a new .bloghead configuration, and creates the root, output and .templates
+directories. Each value which isn't given as a flag is prompted for, unless --yes
+is set, in which case the defaults are used. With --starter, a starter theme with a
+layout, head partial, index page, article blueprint and stylesheet is written, so
+that the new site builds immediately.
+`,
 	Run: func(cmd *cobra.Command, args []string) {
 		configFile := ".bloghead"
 		if len(args) > 0 {
@@ -35,7 +43,7 @@ var initCmd = &cobra.Command{
 		_, err := os.Stat(configFile)
 		if err != nil {
 			if os.IsNotExist(err) {
-				if err := internal.Init(configFile); err != nil {
+				if err := internal.Init(configFile, initOptions); err != nil {
 					panic(err)
 				}
 			} else {
@@ -49,5 +57,14 @@ var initCmd = &cobra.Command{
 }
 
 func init() {
+	initCmd.Flags().StringVar(&initOptions.Root, "root", "", "--root. HTML root directory (default is ./html)")
+	initCmd.Flags().StringVar(&initOptions.Output, "output", "", "--output. Generated files output directory (default is ./www)")
+	initCmd.Flags().StringVar(&initOptions.Author, "author", "", "--author. Site author")
+	initCmd.Flags().StringVar(&initOptions.Email, "email", "", "--email. Author's email")
+	initCmd.Flags().StringVar(&initOptions.Domain, "domain", "", "--domain. Site domain")
+	initCmd.Flags().StringVar(&initOptions.Title, "title", "", "--title. Site title")
+	initCmd.Flags().StringVar(&initOptions.SubTitle, "subtitle", "", "--subtitle. Site description")
+	initCmd.Flags().BoolVarP(&initOptions.Defaults, "yes", "y", false, "--yes, -y. Use the defaults instead of prompting")
+	initCmd.Flags().BoolVar(&initOptions.Starter, "starter", false, "--starter. Write a starter theme and index page")
 	rootCmd.AddCommand(initCmd)
 }
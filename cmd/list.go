@@ -0,0 +1,45 @@
+/*
+Copyright © 2021 David Wiles david@wiles.fyi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/david-wiles/bloghead/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists every article with its status",
+	Long: `Lists every article, newest first, with its status, date and title. The status
+of an article is one of:
+
+published - the article is built
+draft     - the article has 'draft: true', and is only built with publish --drafts
+scheduled - the article's publishDate is in the future, and is only built with publish --future
+expired   - the article's expiryDate has passed, and is no longer built
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		bh := internal.FromEnv()
+		if err := bh.ListArticles(); err != nil {
+			println(err.Error())
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+}
@@ -16,17 +16,31 @@ limitations under the License.
 package cmd
 
 import (
+	"fmt"
 	"github.com/david-wiles/bloghead/internal"
 	"github.com/spf13/cobra"
 )
 
-var watch bool
+var (
+	watch  bool
+	jobs   int
+	stats  bool
+	force  bool
+	minify bool
+	drafts bool
+	future bool
+)
 
 var publishCmd = &cobra.Command{
 	Use:   "publish",
 	Short: "Builds all pages for the current project",
 	Run: func(cmd *cobra.Command, args []string) {
 		bh := internal.FromEnv()
+		bh.Jobs = jobs
+		bh.Force = force
+		bh.Minify = minify
+		bh.Drafts = drafts
+		bh.Future = future
 
 		if watch {
 			if err := bh.Watch(); err != nil {
@@ -36,12 +50,23 @@ var publishCmd = &cobra.Command{
 			if err := bh.Start(); err != nil {
 				println(err.Error())
 			}
+			if stats {
+				print(bh.Stats().String())
+			} else if s := bh.Stats(); s.MinifiedPages > 0 {
+				fmt.Printf("Minified %v page(s), saving %v byte(s)\n", s.MinifiedPages, s.MinifiedBytes)
+			}
 		}
 	},
 }
 
 func init() {
 	publishCmd.Flags().BoolVarP(&watch, "watch", "w", false, "--watch, -w. Watch files for changes")
+	publishCmd.Flags().BoolVarP(&force, "force", "f", false, "--force, -f. Build every page, even if it hasn't changed since the last build")
+	publishCmd.Flags().BoolVar(&stats, "stats", false, "--stats. Print build statistics")
+	publishCmd.Flags().BoolVar(&minify, "minify", false, "--minify. Minify each page before it is written")
+	publishCmd.Flags().BoolVar(&drafts, "drafts", false, "--drafts. Include draft articles")
+	publishCmd.Flags().BoolVar(&future, "future", false, "--future. Include articles with a publishDate in the future")
+	publishCmd.Flags().IntVarP(&jobs, "jobs", "j", 0, "--jobs, -j. Number of pages to compile concurrently (default is the number of CPUs)")
 
 	rootCmd.AddCommand(publishCmd)
 }
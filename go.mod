@@ -1,9 +1,12 @@
 module github.com/david-wiles/bloghead
 
-go 1.15
+go 1.16
 
 require (
 	github.com/fsnotify/fsnotify v1.4.7
+	github.com/pelletier/go-toml v1.2.0
 	github.com/spf13/cobra v1.1.1
 	github.com/spf13/viper v1.7.1
+	github.com/yuin/goldmark v1.4.13
+	gopkg.in/yaml.v2 v2.2.8
 )
@@ -0,0 +1,346 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ArticleChange is a file removed or moved by an article command
+type ArticleChange struct {
+	// The absolute path of the file or directory
+	From string
+	// Where the file is moved to. Empty if the file is removed
+	To string
+}
+
+// Returns the index in the config's Articles and the absolute path of the article
+// named name. The name is the article's path relative to the root directory, with or
+// without its extension, as given to 'bloghead add'
+func (bh *BlogHead) findArticle(name string) (int, string, error) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	for i, page := range bh.config.Articles {
+		abs, err := filepath.Abs(page)
+		if err != nil {
+			return 0, "", err
+		}
+
+		rel := trimPath(bh.Root+"/", abs)
+		if name == rel || name == trimExt(rel) {
+			return i, abs, nil
+		}
+	}
+	return 0, "", errors.New(fmt.Sprintf("No article named %v. Use 'bloghead article list' to see each article", name))
+}
+
+// Returns the content directory of the HTML article at page
+func (bh *BlogHead) contentDir(page string) string {
+	return path.Join(bh.tmplDir, ".data", path.Base(page))
+}
+
+// Determine if an article other than page has the same content directory. Articles
+// with the same file name in different directories share their content directory
+func (bh *BlogHead) sharesContentDir(page string) (bool, error) {
+	for _, other := range bh.config.Articles {
+		abs, err := filepath.Abs(other)
+		if err != nil {
+			return false, err
+		}
+		if abs != page && !isMarkdown(abs) && path.Base(abs) == path.Base(page) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Returns the files of the article at page which exist. These are the page and, for
+// an HTML article, its data file and content directory. The content directory is left
+// out if it is shared with another article
+func (bh *BlogHead) articleFiles(page string) ([]string, error) {
+	files := []string{page}
+	if isMarkdown(page) {
+		return files, nil
+	}
+
+	if _, err := os.Stat(metaPath(page)); err == nil {
+		files = append(files, metaPath(page))
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	shared, err := bh.sharesContentDir(page)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(bh.contentDir(page)); err == nil && !shared {
+		files = append(files, bh.contentDir(page))
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// Removes the published output of the page, if it exists. Returns the change, or nil
+// if the page hasn't been published
+func (bh *BlogHead) outputChange(page string) (*ArticleChange, error) {
+	out := bh.outputPath(page)
+	if _, err := os.Stat(out); os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &ArticleChange{From: out}, nil
+}
+
+// RemoveArticle removes the article named name from the site. The article's page,
+// data file and content directory are deleted along with its published output and
+// recorded history, and it is removed from the config's Articles. If dryRun is set,
+// nothing is changed. Returns the changes which were made, or would be made
+func (bh *BlogHead) RemoveArticle(name string, dryRun bool) ([]ArticleChange, error) {
+	i, page, err := bh.findArticle(name)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := bh.articleFiles(page)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []ArticleChange{}
+	for _, p := range files {
+		changes = append(changes, ArticleChange{From: p})
+	}
+	out, err := bh.outputChange(page)
+	if err != nil {
+		return nil, err
+	}
+	if out != nil {
+		changes = append(changes, *out)
+	}
+
+	if dryRun {
+		return changes, nil
+	}
+
+	for j, c := range changes {
+		if err := os.RemoveAll(c.From); err != nil {
+			return changes[:j], err
+		}
+	}
+	if err := removeOutputs(bh.readManifest().ListPages[page]); err != nil {
+		return changes, err
+	}
+	if err := bh.moveHistory(page, ""); err != nil {
+		return changes, err
+	}
+
+	bh.config.Articles = append(bh.config.Articles[:i], bh.config.Articles[i+1:]...)
+	return changes, bh.Save()
+}
+
+// MoveArticle moves the article named name to the path to, which is relative to the root
+// directory. The article keeps its extension, which may be left out of to. The article's
+// page, data file and content directory are moved, and its entries in the config's Articles
+// and the recorded history are updated. The article's published output is deleted, since
+// it is written at the new path by the next build. A link in the data file which points at
+// the old output, and the page's reference to its content.html, are updated. If dryRun is
+// set, nothing is changed. Returns the changes which were made, or would be made
+func (bh *BlogHead) MoveArticle(name, to string, dryRun bool) ([]ArticleChange, error) {
+	i, page, err := bh.findArticle(name)
+	if err != nil {
+		return nil, err
+	}
+
+	to = strings.TrimSuffix(to, path.Ext(page))
+	target := path.Join(bh.Root, path.Clean("/"+to)+path.Ext(page))
+	if target == page {
+		return nil, errors.New(fmt.Sprintf("%v is already at %v", name, to))
+	}
+	if trimPath(bh.tmplDir, target) != target {
+		return nil, errors.New("Cannot move an article into the templates directory")
+	}
+
+	files, err := bh.articleFiles(page)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []ArticleChange{}
+	for _, p := range files {
+		dest := target
+		switch p {
+		case metaPath(page):
+			dest = metaPath(target)
+		case bh.contentDir(page):
+			dest = bh.contentDir(target)
+		}
+		if dest == p {
+			continue
+		}
+
+		if _, err := os.Stat(dest); err == nil {
+			return nil, errors.New("Cannot move " + name + " to " + to + ": " + dest + " already exists")
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		changes = append(changes, ArticleChange{From: p, To: dest})
+	}
+
+	// A shared content directory can't be renamed, since the other article still uses it
+	shared, err := bh.sharesContentDir(page)
+	if err != nil {
+		return nil, err
+	}
+	if !isMarkdown(page) && shared && path.Base(target) != path.Base(page) {
+		return nil, errors.New(fmt.Sprintf("Cannot rename %v, since its content directory %v is shared with another article",
+			name, bh.contentDir(page)))
+	}
+
+	out, err := bh.outputChange(page)
+	if err != nil {
+		return nil, err
+	}
+	if out != nil {
+		changes = append(changes, *out)
+	}
+
+	if dryRun {
+		return changes, nil
+	}
+
+	for j, c := range changes {
+		if c.To == "" {
+			err = os.Remove(c.From)
+		} else if err = os.MkdirAll(path.Dir(c.To), 0744); err == nil {
+			err = os.Rename(c.From, c.To)
+		}
+		if err != nil {
+			return changes[:j], err
+		}
+	}
+	if err := removeOutputs(bh.readManifest().ListPages[page]); err != nil {
+		return changes, err
+	}
+	if err := bh.moveHistory(page, target); err != nil {
+		return changes, err
+	}
+
+	if isMarkdown(target) {
+		if err := bh.updateFrontMatterLink(page, target); err != nil {
+			return changes, err
+		}
+	} else {
+		if err := bh.updateMetaLink(page, target); err != nil {
+			return changes, err
+		}
+		if err := bh.updateContentRef(page, target); err != nil {
+			return changes, err
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return changes, err
+	}
+	// Articles are listed relative to the working directory, like 'bloghead add'
+	bh.config.Articles[i] = target
+	if rel := trimPath(cwd, target); rel != target {
+		bh.config.Articles[i] = "." + rel
+	}
+	return changes, bh.Save()
+}
+
+// MoveArticleToDir moves the article named name into the directory dir, which is relative
+// to the root directory, keeping its file name. See MoveArticle
+func (bh *BlogHead) MoveArticleToDir(name, dir string, dryRun bool) ([]ArticleChange, error) {
+	return bh.MoveArticle(name, path.Join(dir, path.Base(name)), dryRun)
+}
+
+// RenameArticle renames the article named name to newName, keeping its directory. See MoveArticle
+func (bh *BlogHead) RenameArticle(name, newName string, dryRun bool) ([]ArticleChange, error) {
+	return bh.MoveArticle(name, path.Join(path.Dir(name), newName), dryRun)
+}
+
+// Updates the link in the data file of the article at target, if it is the link
+// created by 'bloghead add' for the article's previous page
+func (bh *BlogHead) updateMetaLink(page, target string) error {
+	b, err := ioutil.ReadFile(metaPath(target))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	meta := make(map[string]interface{})
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return errors.New(metaPath(target) + ": " + err.Error())
+	}
+	if metaString(meta, "link") != bh.newDefaultMeta(page).Link {
+		return nil
+	}
+
+	meta["link"] = bh.newDefaultMeta(target).Link
+	if b, err = json.Marshal(meta); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(metaPath(target), b, 0644)
+}
+
+// Updates the link in the front matter of the markdown article at target, if it is the
+// link created by 'bloghead add' for the article's previous page. Only the link's line
+// is changed, so that the rest of the front matter keeps its formatting
+func (bh *BlogHead) updateFrontMatterLink(page, target string) error {
+	b, err := ioutil.ReadFile(target)
+	if err != nil {
+		return err
+	}
+
+	meta, body, err := splitFrontMatter(b)
+	if err != nil {
+		return errors.New(target + ": " + err.Error())
+	}
+	old := bh.newDefaultMeta(page).Link
+	if metaString(meta, "link") != old {
+		return nil
+	}
+
+	header := b[:len(b)-len(body)]
+	lines := bytes.SplitAfter(header, []byte("\n"))
+	for i, line := range lines {
+		if bytes.HasPrefix(bytes.TrimSpace(line), []byte("link")) && bytes.Contains(line, []byte(old)) {
+			lines[i] = bytes.Replace(line, []byte(old), []byte(bh.newDefaultMeta(target).Link), 1)
+			break
+		}
+	}
+
+	text := append(bytes.Join(lines, nil), body...)
+	return ioutil.WriteFile(target, text, 0644)
+}
+
+// Updates the page at target to include the content.html of its new content directory,
+// if it included the content.html of the article's previous page
+func (bh *BlogHead) updateContentRef(page, target string) error {
+	if path.Base(page) == path.Base(target) {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(target)
+	if err != nil {
+		return err
+	}
+
+	old := path.Join(".data", path.Base(page), "content.html")
+	if !bytes.Contains(b, []byte(old)) {
+		return nil
+	}
+	b = bytes.ReplaceAll(b, []byte(old), []byte(path.Join(".data", path.Base(target), "content.html")))
+	return ioutil.WriteFile(target, b, 0644)
+}
@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+// Adds an HTML article at posts/first.html, and a markdown article at posts/second.md,
+// and builds the site
+func makeArticleSite(t *testing.T) *BlogHead {
+	bh := makeTempSite(t)
+	bh.config.Domain = "example.com"
+	bh.configFile = path.Join(path.Dir(bh.Root), ".bloghead")
+
+	first := path.Join(bh.Root, "posts/first.html")
+	files := map[string]string{
+		"posts/first.html":                         "{{ template \".data/first.html/content.html\" . }}",
+		"posts/first_meta.json":                    `{"title":"First","link":"example.com/posts/first.html"}`,
+		".templates/.data/first.html/content.html": "<p>First</p>",
+		"posts/second.md":                          "---\ntitle: Second\n---\nSecond",
+	}
+	for name, text := range files {
+		f := unwrap(createFile(path.Join(bh.Root, name))).(*os.File)
+		if _, err := f.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+	bh.config.Articles = []string{first, path.Join(bh.Root, "posts/second.md")}
+	if err := bh.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	return bh
+}
+
+func TestBlogHead_RemoveArticle(t *testing.T) {
+	bh := makeArticleSite(t)
+	out := path.Join(bh.Output, "posts/first.html")
+
+	want := []ArticleChange{
+		{From: path.Join(bh.Root, "posts/first.html")},
+		{From: path.Join(bh.Root, "posts/first_meta.json")},
+		{From: path.Join(bh.tmplDir, ".data/first.html")},
+		{From: out},
+	}
+
+	// A dry run doesn't change anything
+	changes, err := bh.RemoveArticle("posts/first", true)
+	if err != nil {
+		t.Fatalf("RemoveArticle() error = %v", err)
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("RemoveArticle() = %v, want %v", changes, want)
+	}
+	if _, err := os.Stat(out); err != nil || len(bh.config.Articles) != 2 {
+		t.Errorf("RemoveArticle() changed the site during a dry run")
+	}
+
+	if changes, err = bh.RemoveArticle("posts/first.html", false); err != nil {
+		t.Fatalf("RemoveArticle() error = %v", err)
+	}
+	for _, c := range changes {
+		if _, err := os.Stat(c.From); !os.IsNotExist(err) {
+			t.Errorf("RemoveArticle() didn't remove %v", c.From)
+		}
+	}
+	if want := []string{path.Join(bh.Root, "posts/second.md")}; !reflect.DeepEqual(bh.config.Articles, want) {
+		t.Errorf("RemoveArticle() left the articles %v, want %v", bh.config.Articles, want)
+	}
+	if saved := unwrap(ReadConfig(bh.configFile)).(*BlogConfig); len(saved.Articles) != 1 {
+		t.Errorf("RemoveArticle() saved the articles %v, want 1 article", saved.Articles)
+	}
+
+	if _, err := bh.RemoveArticle("posts/first", false); err == nil {
+		t.Errorf("RemoveArticle() removed an article which doesn't exist")
+	}
+}
+
+func TestBlogHead_MoveArticle(t *testing.T) {
+	bh := makeArticleSite(t)
+
+	changes, err := bh.MoveArticle("posts/first", "archive/renamed", false)
+	if err != nil {
+		t.Fatalf("MoveArticle() error = %v", err)
+	}
+	want := []ArticleChange{
+		{path.Join(bh.Root, "posts/first.html"), path.Join(bh.Root, "archive/renamed.html")},
+		{path.Join(bh.Root, "posts/first_meta.json"), path.Join(bh.Root, "archive/renamed_meta.json")},
+		{path.Join(bh.tmplDir, ".data/first.html"), path.Join(bh.tmplDir, ".data/renamed.html")},
+		{From: path.Join(bh.Output, "posts/first.html")},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("MoveArticle() = %v, want %v", changes, want)
+	}
+	for _, c := range changes {
+		if _, err := os.Stat(c.From); !os.IsNotExist(err) {
+			t.Errorf("MoveArticle() didn't move %v", c.From)
+		}
+	}
+
+	meta := make(map[string]interface{})
+	if err := json.Unmarshal(unwrap(ioutil.ReadFile(path.Join(bh.Root, "archive/renamed_meta.json"))).([]byte), &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta["link"] != "example.com/archive/renamed.html" || meta["title"] != "First" {
+		t.Errorf("MoveArticle() wrote the metadata %v, want the new link", meta)
+	}
+	if _, _, err := bh.findArticle("archive/renamed"); err != nil {
+		t.Errorf("MoveArticle() didn't update the articles: %v", err)
+	}
+
+	// A markdown article has no other files, and can't replace an existing page
+	if _, err := bh.MoveArticle("posts/second", "notes/second", false); err != nil {
+		t.Errorf("MoveArticle() error = %v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(bh.Root, "taken.md"), nil, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bh.MoveArticle("notes/second", "taken", false); err == nil {
+		t.Errorf("MoveArticle() replaced an existing page")
+	}
+
+	// The site still builds after the articles are moved
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if got := string(unwrap(ioutil.ReadFile(path.Join(bh.Output, "archive/renamed.html"))).([]byte)); got != "<p>First</p>" {
+		t.Errorf("Start() wrote %v, want the moved article's content", got)
+	}
+}
+
+func TestBlogHead_MoveArticle_markdown(t *testing.T) {
+	bh := makeArticleSite(t)
+
+	third := path.Join(bh.Root, "posts/third.md")
+	text := "---\ntitle: Third\nlink: example.com/posts/third.html\ntags: [a, b]\n---\nThird links to example.com/posts/third.html"
+	if err := ioutil.WriteFile(third, []byte(text), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	bh.config.Articles = append(bh.config.Articles, third)
+
+	if _, err := bh.MoveArticle("posts/third", "notes/renamed", false); err != nil {
+		t.Fatalf("MoveArticle() error = %v", err)
+	}
+
+	// Only the link in the front matter is changed
+	want := "---\ntitle: Third\nlink: example.com/notes/renamed.html\ntags: [a, b]\n---\nThird links to example.com/posts/third.html"
+	if got := string(unwrap(ioutil.ReadFile(path.Join(bh.Root, "notes/renamed.md"))).([]byte)); got != want {
+		t.Errorf("MoveArticle() wrote %v, want %v", got, want)
+	}
+
+	a := unwrap(bh.readArticle(path.Join(bh.Root, "notes/renamed.md"))).(*article)
+	if metaString(a.Meta, "link") != "example.com/notes/renamed.html" {
+		t.Errorf("readArticle() link = %v, want the new link", a.Meta["link"])
+	}
+}
+
+func TestBlogHead_MoveArticle_fileName(t *testing.T) {
+	bh := makeArticleSite(t)
+
+	// The name given to mv and rename keeps its extension, which isn't added again
+	if _, err := bh.MoveArticleToDir("posts/second.md", "notes", false); err != nil {
+		t.Fatalf("MoveArticleToDir() error = %v", err)
+	}
+	if _, err := os.Stat(path.Join(bh.Root, "notes/second.md")); err != nil {
+		t.Errorf("MoveArticleToDir() didn't move the article to notes/second.md")
+	}
+	if _, err := bh.RenameArticle("notes/second.md", "renamed.md", false); err != nil {
+		t.Fatalf("RenameArticle() error = %v", err)
+	}
+	if _, err := os.Stat(path.Join(bh.Root, "notes/renamed.md")); err != nil {
+		t.Errorf("RenameArticle() didn't rename the article to notes/renamed.md")
+	}
+	if want := path.Join(bh.Root, "notes/renamed.md"); bh.config.Articles[1] != want {
+		t.Errorf("RenameArticle() left the article %v, want %v", bh.config.Articles[1], want)
+	}
+}
+
+func TestBlogHead_MoveArticle_fileMode(t *testing.T) {
+	bh := makeArticleSite(t)
+	if err := os.Chmod(path.Join(bh.Root, "posts/first_meta.json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bh.RenameArticle("posts/first", "renamed", false); err != nil {
+		t.Fatalf("RenameArticle() error = %v", err)
+	}
+	info, err := os.Stat(path.Join(bh.Root, "posts/renamed_meta.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("RenameArticle() changed the data file's mode to %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+	}
+}
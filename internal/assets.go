@@ -0,0 +1,222 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// The number of characters of the content hash added to the
+// name of a fingerprinted asset
+const fingerprintLength = 6
+
+// An asset as it is published, returned by the asset template function
+type assetRef struct {
+	// The URL of the asset from the root of the site's domain
+	URL string
+	// The subresource integrity hash of the asset, for an integrity attribute
+	Integrity string
+}
+
+// The URL of the asset, so that {{ asset "style.css" }} can be used as a link
+func (a *assetRef) String() string {
+	return a.URL
+}
+
+// Determine if the file at the path p is an asset, which is copied to the output
+// directory as it is. Every file in the root directory is an asset, except for:
+//   1: pages and their _meta.json files
+//   2: files in the data directory
+//   3: the '.templates' and '.data' directories, version control files such as '.git',
+//      and the files bloghead keeps next to the output directory, such as '.www_manifest.json'
+//   4: the configuration file, and files in the output directory
+// The theme's assets are also assets, unless the root directory overrides them
+func (bh *BlogHead) isAsset(p string, info os.FileInfo) bool {
+	if bh.isThemeFile(p) {
+		return bh.isThemeAsset(p, info)
+	}
+
+	rel := trimPath(bh.Root+"/", p)
+	if info.IsDir() || rel == p || bh.isPage(p, info) || bh.isDataFile(p) {
+		return false
+	}
+
+	if strings.HasSuffix(p, "_meta.json") || p == bh.configFile || trimPath(bh.Output+"/", p) != p {
+		return false
+	}
+
+	for _, name := range strings.Split(rel, "/") {
+		if name == ".templates" || name == ".data" || vcsFiles[name] {
+			return false
+		}
+	}
+
+	// Files such as .well-known/security.txt and .htaccess are published
+	return !bh.isBuildFile(p)
+}
+
+// The names of the files and directories used by version control and the
+// operating system, which aren't published
+var vcsFiles = map[string]bool{
+	".DS_Store":      true,
+	".git":           true,
+	".gitkeep":       true,
+	".gitignore":     true,
+	".gitattributes": true,
+	".gitmodules":    true,
+	".hg":            true,
+	".hgignore":      true,
+	".svn":           true,
+}
+
+// Determine if p is one of the files kept next to the output directory between builds,
+// which are the manifest, the history and the image cache
+func (bh *BlogHead) isBuildFile(p string) bool {
+	return strings.HasPrefix(trimPath(path.Dir(bh.Output)+"/", p), "."+path.Base(bh.Output)+"_")
+}
+
+// Returns the path of the asset at p in the output directory, where hash is the
+// hex encoded sha256 hash of its content. If fingerprinting is enabled, the start
+// of the hash is added to the file name before its extension
+func (bh *BlogHead) assetPath(p, hash string) string {
+	out := path.Join(bh.Output, bh.sourcePath(p))
+	if bh.config == nil || !bh.config.Fingerprint {
+		return out
+	}
+	return trimExt(out) + "." + hash[:fingerprintLength] + path.Ext(out)
+}
+
+// Copies the asset at p to the output directory. Returns the path it was written to
+func (bh *BlogHead) writeAsset(p string) (string, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+	out := bh.assetPath(p, hex.EncodeToString(sum[:]))
+
+	f, err := createFile(out)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(b); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// Copies each asset which changed since the last build to the output directory, and
+// adds an entry for each asset to the next manifest. Resized copies of images are
+// written as well. An asset's entry is keyed by the
+// asset, so that its old output is removed when a fingerprinted asset changes
+func (bh *BlogHead) buildAssets(assets []string, manifest, next *buildManifest) error {
+	var errs BuildErrors
+	for _, p := range assets {
+		inputs, err := hashFiles(p)
+		if err != nil {
+			errs = append(errs, errors.New(p+": "+err.Error()))
+			continue
+		}
+
+		if bh.hasImageVariants(p) {
+			if err := bh.buildImageVariants(p, inputs[p], manifest, next); err != nil {
+				errs = append(errs, errors.New(p+": "+err.Error()))
+			}
+		}
+
+		if entry, ok := manifest.Entries[p]; ok && entry.Output == bh.assetPath(p, inputs[p]) && manifest.upToDate(p, inputs) {
+			next.Entries[p] = entry
+			continue
+		}
+
+		out, err := bh.writeAsset(p)
+		if err != nil {
+			errs = append(errs, errors.New(p+": "+err.Error()))
+			continue
+		}
+		next.Entries[p] = &manifestEntry{out, inputs}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Returns the published URL and integrity hash of the asset at name, which is
+// relative to the root directory, or to the theme directory if the root directory
+// doesn't have it. The asset is a dependency of the page at p
+func (bh *BlogHead) asset(p, name string) (*assetRef, error) {
+	file := bh.assetFile(name)
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	if !bh.isAsset(file, info) {
+		return nil, errors.New(name + " is not an asset")
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if p != "" {
+		bh.saveDependencies(p, file)
+	}
+
+	sum := sha256.Sum256(b)
+	out := bh.assetPath(file, hex.EncodeToString(sum[:]))
+
+	return &assetRef{
+		URL:       bh.relURL(trimPath(bh.Output, out)),
+		Integrity: integrity(b),
+	}, nil
+}
+
+// Returns the subresource integrity hash of the content
+func integrity(b []byte) string {
+	sum := sha512.Sum384(b)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Returns the assets used by each of the files, which are found by the names passed to
+// the asset, image and bundle functions. The inputs of a bundle are returned for the bundle.
+// Names which aren't a string, or which don't exist, are skipped
+func (bh *BlogHead) templateAssets(files []string) ([]string, error) {
+	assets := []string{}
+	for _, f := range files {
+		t, err := bh.parseFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		names := append(stringArgs(t, "asset"), stringArgs(t, "image")...)
+		for _, name := range names {
+			p := bh.assetFile(name)
+			if _, err := os.Stat(p); err == nil {
+				assets = appendUnique(assets, p)
+			}
+		}
+
+		for _, name := range stringArgs(t, "bundle") {
+			inputs, err := bh.bundleInputs(name)
+			if err != nil {
+				continue
+			}
+			for _, p := range inputs {
+				assets = appendUnique(assets, p)
+			}
+		}
+	}
+	return assets, nil
+}
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestBlogHead_isAsset(t *testing.T) {
+	bh := makeTempSite(t)
+	bh.configFile = path.Join(bh.Root, ".bloghead")
+	// The files kept next to the output directory are in the root directory
+	bh.Output = path.Join(bh.Root, "www")
+
+	tests := []struct {
+		name string
+		p    string
+		want bool
+	}{
+		{name: "Stylesheet", p: "css/style.css", want: true},
+		{name: "Image", p: "images/photo.jpg", want: true},
+		{name: "Page", p: "index.html", want: false},
+		{name: "Markdown page", p: "post.md", want: false},
+		{name: "Page data file", p: "index_meta.json", want: false},
+		{name: "Data file", p: "data/menu.json", want: false},
+		{name: "Template", p: ".templates/head.html", want: false},
+		{name: "File in the templates directory", p: ".templates/README", want: false},
+		{name: "Dotfile", p: ".gitignore", want: false},
+		{name: "File in a hidden directory", p: ".git/config", want: false},
+		{name: "Configuration file", p: ".bloghead", want: false},
+		{name: "Well-known file", p: ".well-known/security.txt", want: true},
+		{name: "Server configuration", p: ".htaccess", want: true},
+		{name: "Article content", p: ".templates/.data/post.html/content.html", want: false},
+		{name: "Build manifest", p: ".www_manifest.json", want: false},
+		{name: "Image cache", p: ".www_images/0a1b.jpg", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := path.Join(bh.Root, tt.p)
+			f := unwrap(createFile(p)).(*os.File)
+			_ = f.Close()
+
+			info := unwrap(os.Stat(p)).(os.FileInfo)
+			if got := bh.isAsset(p, info); got != tt.want {
+				t.Errorf("isAsset() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlogHead_Start_assets(t *testing.T) {
+	bh := makeTempSite(t)
+	bh.config.Fingerprint = true
+
+	write := func(name, text string) {
+		if err := ioutil.WriteFile(path.Join(bh.Root, name), []byte(text), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(name string) string {
+		return string(unwrap(ioutil.ReadFile(path.Join(bh.Output, name))).([]byte))
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(path.Join(bh.Output, name))
+		return err == nil
+	}
+
+	f := unwrap(createFile(path.Join(bh.Root, "css/style.css"))).(*os.File)
+	_ = f.Close()
+	write("css/style.css", "body {}")
+	write(".gitignore", "www")
+	write("page.html", `<link href="{{ asset "css/style.css" }}" integrity="{{ (asset "/css/style.css").Integrity }}">`)
+
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// sha256("body {}") starts with 62368a
+	if got := read("css/style.62368a.css"); got != "body {}" {
+		t.Errorf("Start() wrote the asset %v, want body {}", got)
+	}
+	if exists(".gitignore") || exists("index_meta.json") {
+		t.Errorf("Start() copied a file which isn't an asset")
+	}
+	want := `<link href="/css/style.62368a.css" integrity="sha384-JvbluEOKMBmUtNHx346xlZFWqKqtOmexOupPSHRCR0NbwTey4wjq9itKKoSWuGsH">`
+	if got := read("page.html"); got != want {
+		t.Errorf("Start() wrote the page %v, want %v", got, want)
+	}
+
+	// Changing the asset replaces its output and rebuilds the page which uses it
+	write("css/style.css", "body { color: red; }")
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if exists("css/style.62368a.css") {
+		t.Errorf("Start() didn't remove the previous output of the asset")
+	}
+	if built := bh.Stats().PageTimes; len(built) != 1 {
+		t.Errorf("Start() built %v page(s), want only the page using the asset", len(built))
+	}
+	if got := read("page.html"); got == want {
+		t.Errorf("Start() didn't rebuild the page using the asset")
+	}
+}
+
+func Test_stringArgs(t *testing.T) {
+	text := `{{ asset "a.css" }}{{ if .x }}{{ (asset "b.js").Integrity }}{{ end }}` +
+		`{{ define "block" }}{{ asset "c.png" | print }}{{ end }}{{ asset .name }}`
+	tmpl := template.Must(template.New("page").Funcs(template.FuncMap{"asset": func(string) string { return "" }}).Parse(text))
+
+	got := stringArgs(tmpl, "asset")
+	want := map[string]bool{"a.css": true, "b.js": true, "c.png": true}
+	if len(got) != len(want) {
+		t.Fatalf("stringArgs() = %v, want %v", got, want)
+	}
+	found := make(map[string]bool)
+	for _, name := range got {
+		found[name] = true
+	}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("stringArgs() = %v, want %v", got, want)
+	}
+}
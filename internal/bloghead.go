@@ -6,9 +6,14 @@ import (
 	"fmt"
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
 )
 
 // BlogHead keeps track of everything going on during the site's build process.
@@ -17,6 +22,26 @@ type BlogHead struct {
 	Output  string
 	tmplDir string
 
+	// The directory of the site's theme and the templates directory within it.
+	// Both are empty if the site doesn't use a theme
+	themeDir     string
+	themeTmplDir string
+
+	// The number of pages to compile concurrently.
+	// If less than 1, the number of CPUs is used
+	Jobs int
+
+	// Build every page, even if its inputs haven't changed since the last build
+	Force bool
+
+	// Minify each page before it is written, even if minify isn't set in the config
+	Minify bool
+
+	// Build draft articles, which are otherwise left out of the site
+	Drafts bool
+	// Build articles with a publishDate in the future
+	Future bool
+
 	// Configuration file for the site created by this bloghead
 	// This file also stores the state of the site
 	configFile string
@@ -25,10 +50,58 @@ type BlogHead struct {
 	// Templates is a map of each template and the templates is is used in.
 	// When running in watch mode, this is used to determine which files to watch
 	templates map[string][]string
+	// Guards templates, since pages are compiled concurrently
+	mu sync.RWMutex
+
+	// Parsed templates which are shared between pages
+	cache templateCache
+	// Statistics for the most recent build
+	stats BuildStats
+	// The time the most recent build started, available to templates as .Site.BuildTime
+	buildTime time.Time
+	// The articles left out of the most recent build, because they are drafts,
+	// scheduled or expired. Recorded in the manifest
+	hidden []string
+
+	// The revisions of each article recorded by the most recent build
+	recorded map[string][]revision
+	// The revisions of each article, read from git or the recorded history
+	revisionCache map[string][]revision
+	// Guards revisionCache, since pages are compiled concurrently
+	historyMu sync.Mutex
+
+	// The content of each bundle, built once for each build by the first page which uses it
+	bundles map[string][]byte
+	// Guards bundles, since pages are compiled concurrently
+	bundlesMu sync.Mutex
+
+	// The dimensions and hash of each image, read once for each build by the first page which uses it
+	images map[string]*imageInfo
+	// Guards images, since pages are compiled concurrently
+	imagesMu sync.Mutex
+
+	// The outputs of the second and later pages of each list page, which are
+	// read from the manifest and recorded as list pages are written
+	listPages map[string][]string
+	// Guards listPages, since pages are compiled concurrently
+	listPagesMu sync.Mutex
+
+	// The site's articles, read once for each build by the first page which uses them
+	articles []*article
+	// Guards articles, since pages are compiled concurrently
+	articlesMu sync.Mutex
 
 	// The filesystem watcher used when running with the watch option
 	// Does not have a value unless the watch option is set
 	watcher *fsnotify.Watcher
+
+	// Called after each page is compiled, with the error if the page failed.
+	// Used by the development server to notify browsers of rebuilt pages
+	onBuild func(p string, err error)
+	// Called with the output paths of the taxonomy pages written while watching
+	onGenerate func(outputs []string)
+	// Called after assets or bundles are written while watching
+	onAssets func()
 }
 
 func FromEnv() *BlogHead {
@@ -45,89 +118,149 @@ func FromEnv() *BlogHead {
 		panic(err)
 	}
 
-	config, err := ReadConfig(viper.ConfigFileUsed())
+	configFile, err := filepath.Abs(viper.ConfigFileUsed())
+	if err != nil {
+		panic(err)
+	}
+
+	config, err := ReadConfig(configFile)
 	if err != nil {
 		panic(err)
 	}
 
-	return &BlogHead{
+	bh := &BlogHead{
 		Root:       rootPath,
 		Output:     outPath,
 		tmplDir:    path.Join(rootPath, ".templates/") + "/",
-		configFile: viper.ConfigFileUsed(),
+		configFile: configFile,
 		config:     config,
 		templates:  make(map[string][]string),
 	}
+	if err := bh.loadTheme(); err != nil {
+		panic(err)
+	}
+	return bh
 }
 
-func Init(filename string) error {
+// InitOptions are the values used to create a new site. Each value which is
+// empty is prompted for, unless Defaults is set
+type InitOptions struct {
+	Root     string
+	Output   string
+	Author   string
+	Email    string
+	Domain   string
+	Title    string
+	SubTitle string
+
+	// Use the default of each value which isn't set, instead of prompting for it
+	Defaults bool
+	// Write the starter theme's templates, pages and stylesheet into the new site
+	Starter bool
+}
+
+// Init writes a new configuration file at filename, and creates the root,
+// output and templates directories next to it. Values which aren't set
+// in opts are read from stdin
+func Init(filename string, opts InitOptions) error {
+	return initSite(filename, opts, os.Stdin, os.Stdout)
+}
+
+func initSite(filename string, opts InitOptions, in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	prompt := func(value *string, def, text string) error {
+		if *value != "" {
+			return nil
+		}
+		*value = def
+		if opts.Defaults {
+			return nil
+		}
+		if def != "" {
+			text = fmt.Sprintf("%v (default is %v): ", text, def)
+		} else {
+			text += ": "
+		}
+		return promptUser(scanner, out, value, text)
+	}
+
 	// Get init variables from user via prompt
-	var (
-		root     string = "./html"
-		output   string = "./www"
-		author   string
-		email    string
-		domain   string
-		title    string
-		subtitle string
-	)
-
-	scanner := bufio.NewScanner(os.Stdin)
-
-	if err := promptUser(scanner, &root, fmt.Sprintf("HTML root directory (default is %v): ", root)); err != nil {
+	if err := prompt(&opts.Root, "./html", "HTML root directory"); err != nil {
 		return err
 	}
 
-	if err := promptUser(scanner, &output, fmt.Sprintf("Generated files output directory (default is %v): ", output)); err != nil {
+	if err := prompt(&opts.Output, "./www", "Generated files output directory"); err != nil {
 		return err
 	}
 
-	if err := promptUser(scanner, &author, "Site author: "); err != nil {
+	if err := prompt(&opts.Author, "", "Site author"); err != nil {
 		return err
 	}
 
-	if err := promptUser(scanner, &email, "Author's email: "); err != nil {
+	if err := prompt(&opts.Email, "", "Author's email"); err != nil {
 		return err
 	}
 
-	if err := promptUser(scanner, &domain, "Site domain: "); err != nil {
+	if err := prompt(&opts.Domain, "", "Site domain"); err != nil {
 		return err
 	}
 
-	if err := promptUser(scanner, &title, "Site title: "); err != nil {
+	if err := prompt(&opts.Title, "", "Site title"); err != nil {
 		return err
 	}
 
-	if err := promptUser(scanner, &subtitle, "Site description: "); err != nil {
+	if err := prompt(&opts.SubTitle, "", "Site description"); err != nil {
 		return err
 	}
 
-	// Write a blank config file
+	// The directories are relative to the configuration file, which is where bloghead is run
+	dir := path.Dir(filename)
+	resolve := func(p string) string {
+		if path.IsAbs(p) {
+			return p
+		}
+		return path.Join(dir, p)
+	}
+	root := resolve(opts.Root)
+	for _, d := range []string{root, resolve(opts.Output), path.Join(root, ".templates")} {
+		if err := os.MkdirAll(d, 0744); err != nil {
+			return err
+		}
+	}
+
+	blueprints := make(map[string]string)
+	if opts.Starter {
+		var err error
+		if blueprints, err = writeStarter(root, out); err != nil {
+			return err
+		}
+	}
+
 	if err := SaveConfig(&BlogConfig{
-		Root:       root,
-		Output:     output,
-		Author:     author,
-		Email:      email,
-		Domain:     domain,
-		Title:      title,
-		SubTitle:   subtitle,
-		Blueprints: make(map[string]string),
+		Root:       opts.Root,
+		Output:     opts.Output,
+		Author:     opts.Author,
+		Email:      opts.Email,
+		Domain:     opts.Domain,
+		Title:      opts.Title,
+		SubTitle:   opts.SubTitle,
+		Blueprints: blueprints,
 		Articles:   []string{},
 	}, filename); err != nil {
 		return err
 	}
 
-	if _, err := fmt.Fprintf(os.Stdout, "Configuration successfully written at %v. Happy coding!\n", filename); err != nil {
+	if _, err := fmt.Fprintf(out, "Configuration successfully written at %v. Happy coding!\n", filename); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func promptUser(scanner *bufio.Scanner, value *string, prompt string) error {
+func promptUser(scanner *bufio.Scanner, out io.Writer, value *string, prompt string) error {
 	input := ""
 
-	if _, err := os.Stdout.WriteString(prompt); err != nil {
+	if _, err := io.WriteString(out, prompt); err != nil {
 		return err
 	}
 
@@ -139,16 +272,81 @@ func promptUser(scanner *bufio.Scanner, value *string, prompt string) error {
 	return nil
 }
 
+// BuildErrors contains every error which occurred while building the site.
+// A page which fails to compile does not stop the other pages from compiling
+type BuildErrors []error
+
+func (e BuildErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = "  " + err.Error()
+	}
+	return fmt.Sprintf("%v error(s) occurred during the build:\n%v", len(e), strings.Join(lines, "\n"))
+}
+
+// PageError is an error which occurred while compiling a page
+type PageError struct {
+	Page string
+	Err  error
+}
+
+func (e *PageError) Error() string {
+	return e.Page + ": " + e.Err.Error()
+}
+
 // Start compiling pages found in the root directory
-// Ignores the directory named '.templates'
+// Ignores the directory named '.templates'. Every other file is copied as an asset.
+// Only the pages with inputs which changed since the last build are compiled,
+// unless bh.Force is set, and the output of pages which were removed is deleted
 func (bh *BlogHead) Start() error {
+	bh.stats.reset()
+	bh.resetArticles()
+	bh.resetBundles()
+	bh.resetImages()
+	start := time.Now()
+	bh.buildTime = start
+	defer func() {
+		bh.stats.Duration = time.Since(start)
+	}()
+
+	var errs BuildErrors
+
+	if err := bh.loadTheme(); err != nil {
+		return err
+	}
+
+	hidden, err := bh.hiddenArticles()
+	if err != nil {
+		return err
+	}
+	bh.hidden = hidden
+	isHidden := make(map[string]bool)
+	for _, p := range hidden {
+		isHidden[p] = true
+	}
+
+	manifest := bh.readManifest()
+	next := bh.newManifest()
+	bh.listPages = make(map[string][]string)
+	for p, outputs := range manifest.ListPages {
+		bh.listPages[p] = outputs
+	}
+
 	if len(bh.config.Articles) != 0 {
-		if err := bh.writeFeed(); err != nil {
-			return err
+		if err := bh.recordHistory(); err != nil {
+			errs = append(errs, errors.New("history: "+err.Error()))
+		}
+		if err := bh.buildFeed(manifest, next); err != nil {
+			errs = append(errs, err)
+		}
+		if err := bh.buildTaxonomies(manifest, next); err != nil {
+			errs = append(errs, err)
 		}
 	}
 
-	return filepath.Walk(bh.Root, func(p string, info os.FileInfo, err error) error {
+	pages := []string{}
+	assets := []string{}
+	if err := filepath.Walk(bh.Root, func(p string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -158,58 +356,138 @@ func (bh *BlogHead) Start() error {
 			return err
 		}
 
-		if bh.isHTMLPage(absPath, info) {
-			if err := bh.compileAndWriteHTML(absPath); err != nil {
-				return err
+		// The theme's assets are found below, even if it is in the root directory
+		if info.IsDir() && absPath == bh.themeDir {
+			return filepath.SkipDir
+		}
+
+		// Hidden articles aren't built, so their previous output is removed
+		if bh.isPage(absPath, info) {
+			if !isHidden[absPath] {
+				pages = append(pages, absPath)
 			}
+		} else if bh.isAsset(absPath, info) {
+			assets = append(assets, absPath)
 		}
 
 		return nil
-	})
-}
-
-// Watch initializes the filesystem watcher for all files found
-// in the root directory, including the '.templates' directory.
-// On a file change, the file is rebuilt along with all files which
-// use the changed template. The site is created before the watcher
-// is initialized
-func (bh *BlogHead) Watch() error {
-	// Build all files
-	if err := bh.Start(); err != nil {
+	}); err != nil {
 		return err
 	}
 
-	// Watch files for changes
-	watcher, err := fsnotify.NewWatcher()
+	themeAssets, err := bh.themeAssets()
 	if err != nil {
 		return err
 	}
-	defer watcher.Close()
+	assets = append(assets, themeAssets...)
 
-	bh.watcher = watcher
+	if err := bh.buildAssets(assets, manifest, next); err != nil {
+		errs = append(errs, err.(BuildErrors)...)
+	}
+	if err := bh.buildBundles(manifest, next); err != nil {
+		errs = append(errs, err.(BuildErrors)...)
+	}
 
-	// Register listeners on each file
-	if err := filepath.Walk(bh.Root, func(p string, info os.FileInfo, err error) error {
+	// Pages which fail are added to the next manifest without any inputs,
+	// so that their output is kept but they are built again next time
+	changed := []string{}
+	inputs := make(map[string]map[string]string)
+	for _, p := range pages {
+		in, err := bh.pageInputs(p)
 		if err != nil {
-			return err
+			errs = append(errs, &PageError{p, err})
+			next.Entries[p] = &manifestEntry{bh.outputPath(p), nil}
+		} else if manifest.upToDate(p, in) {
+			next.Entries[p] = manifest.Entries[p]
+		} else {
+			changed = append(changed, p)
+			inputs[p] = in
 		}
+	}
 
-		if !info.IsDir() {
-			if err := bh.watcher.Add(p); err != nil {
-				return err
-			}
+	failed := make(map[string]bool)
+	if err := bh.compilePages(changed); err != nil {
+		for _, err := range err.(BuildErrors) {
+			failed[err.(*PageError).Page] = true
+			errs = append(errs, err)
 		}
+	}
 
-		return nil
-	}); err != nil {
-		return err
+	for _, p := range changed {
+		if failed[p] {
+			next.Entries[p] = &manifestEntry{bh.outputPath(p), nil}
+		} else {
+			next.Entries[p] = &manifestEntry{bh.outputPath(p), inputs[p]}
+		}
 	}
 
-	// When a filesystem change is detected, handle the event
-	done := make(chan bool)
-	go bh.watchFiles()
-	<-done
+	if err := bh.buildSitemap(pages, next); err != nil {
+		errs = append(errs, errors.New("sitemap: "+err.Error()))
+	}
 
+	next.ListPages = bh.recordedListPages(next.Entries)
+
+	// Remove the output of pages which no longer exist
+	if err := bh.removeStaleOutput(manifest, next); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := bh.writeManifest(next); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Compiles and writes each page using a pool of bh.Jobs workers.
+// Returns BuildErrors containing the error of each page which failed
+func (bh *BlogHead) compilePages(pages []string) error {
+	jobs := bh.Jobs
+	if jobs < 1 {
+		jobs = runtime.NumCPU()
+	}
+
+	// Each worker records its error at the index of the page,
+	// so that the errors are reported in a consistent order
+	results := make([]error, len(pages))
+	work := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				err := bh.compileAndWriteHTML(pages[i])
+				if err != nil {
+					results[i] = &PageError{pages[i], err}
+				}
+				if bh.onBuild != nil {
+					bh.onBuild(pages[i], err)
+				}
+			}
+		}()
+	}
+
+	for i := range pages {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	var errs BuildErrors
+	for _, err := range results {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
 
@@ -247,10 +525,33 @@ func (bh *BlogHead) SetMetaValue(key, value string) error {
 	return nil
 }
 
+// Statistics for the most recent build
+func (bh *BlogHead) Stats() *BuildStats {
+	return &bh.stats
+}
+
 // Compile a page at p and write to a file with the same relative path to output.
+// Markdown pages are written with the .html extension, and each page of a list page is written.
 // p must be an absolute path to the file
 func (bh *BlogHead) compileAndWriteHTML(p string) error {
-	out, err := createFile(path.Join(bh.Output, trimPath(bh.Root, p)))
+	start := time.Now()
+	defer func() {
+		bh.stats.pageBuilt(p, time.Since(start))
+	}()
+
+	meta, err := getTemplateData(p)
+	if err != nil {
+		return err
+	}
+	if isListPage(meta) {
+		return bh.compileAndWriteList(p, meta)
+	}
+	// The pages written while the page was a list page are removed
+	if err := removeOutputs(bh.setListPages(p, nil)); err != nil {
+		return err
+	}
+
+	out, err := createFile(bh.outputPath(p))
 	if err != nil {
 		return err
 	}
@@ -261,53 +562,28 @@ func (bh *BlogHead) compileAndWriteHTML(p string) error {
 		return err
 	}
 
-	if _, err := out.Write(b); err != nil {
+	if _, err := out.Write(bh.minifyPage(b)); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (bh *BlogHead) watchFiles() {
-	for {
-		select {
-		case event, ok := <-bh.watcher.Events:
-			if !ok {
-				// If the watcher was closed, return
-				return
-			} else {
-				if event.Op&fsnotify.Write == fsnotify.Write {
-					p, err := filepath.Abs(event.Name)
-					if err != nil {
-						println(err.Error())
-					}
-
-					// Rewrite all pages dependent on the modified file
-					if err := bh.walkDependencies(p, func(p string) error {
-						// If the trimmed path is equal to the original path, then the
-						// page is not in the template directory
-						if trimPath(bh.tmplDir, p) == p {
-							if err := bh.compileAndWriteHTML(p); err != nil {
-								return err
-							}
-						}
-						return nil
-					}); err != nil {
-						println(err.Error())
-					}
-
-					// If the file was an article, re-compile the feed.xml file
-				}
-			}
-		case err, ok := <-bh.watcher.Errors:
-			if !ok {
-				// If the watcher was closed, return
-				return
-			} else {
-				println(err.Error())
-			}
-		}
+// Determine if pages are minified before they are written
+func (bh *BlogHead) minify() bool {
+	return bh.Minify || (bh.config != nil && bh.config.Minify)
+}
+
+// Returns the compiled page b, minified if minification is enabled.
+// The number of bytes which were removed is added to the build's stats
+func (bh *BlogHead) minifyPage(b []byte) []byte {
+	if !bh.minify() {
+		return b
 	}
+
+	minified := minifyHTML(b)
+	bh.stats.pageMinified(len(b) - len(minified))
+	return minified
 }
 
 // Determine if the file at the path p should be processed as a page
@@ -315,15 +591,39 @@ func (bh *BlogHead) watchFiles() {
 //   1: has the .html file extension
 //   2: is not a directory
 //   3: is not in the templates directory or one of its subdirectories
+//   4: is not in the data directory
+//   5: is not one of the theme's files
 func (bh *BlogHead) isHTMLPage(p string, info os.FileInfo) bool {
 	return path.Ext(p) == ".html" &&
 		!info.IsDir() &&
 		// If the trimmed path is equal to the original path,
 		// then the template directory is not a parent directory of the file
-		trimPath(bh.tmplDir, p) == p
+		trimPath(bh.tmplDir, p) == p &&
+		!bh.isDataFile(p) &&
+		!bh.isThemeFile(p)
+}
+
+// Determine if the file at the path p should be compiled, either as
+// an HTML page or as a markdown page
+func (bh *BlogHead) isPage(p string, info os.FileInfo) bool {
+	return bh.isHTMLPage(p, info) || bh.isMarkdownPage(p, info)
+}
+
+// Determine if the file at the path p should be processed as a markdown page.
+// The conditions are the same as an HTML page, except that the file must have
+// the .md or .markdown file extension
+func (bh *BlogHead) isMarkdownPage(p string, info os.FileInfo) bool {
+	return isMarkdown(p) &&
+		!info.IsDir() &&
+		trimPath(bh.tmplDir, p) == p &&
+		!bh.isDataFile(p) &&
+		!bh.isThemeFile(p)
 }
 
 func (bh *BlogHead) saveDependencies(p string, templates ...string) {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
 	// Add entries for each dependency in the templates map
 	for _, tmpl := range templates {
 		if list, ok := bh.templates[tmpl]; ok {
@@ -334,20 +634,55 @@ func (bh *BlogHead) saveDependencies(p string, templates ...string) {
 	}
 }
 
+// Removes p from the templates map, both as a template and as a dependent
+func (bh *BlogHead) forgetDependencies(p string) {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	delete(bh.templates, p)
+	for tmpl, list := range bh.templates {
+		for i, dep := range list {
+			if dep == p {
+				bh.templates[tmpl] = append(list[:i:i], list[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Returns a copy of the list of files which depend on p
+func (bh *BlogHead) dependents(p string) []string {
+	bh.mu.RLock()
+	defer bh.mu.RUnlock()
+
+	return append([]string{}, bh.templates[p]...)
+}
+
 // Walk through each page dependent page on p and call the walkFn
-// for each page, including p
+// for each page, including p. If the dependencies form a loop,
+// a CycleError is returned
 func (bh *BlogHead) walkDependencies(p string, walkFn func(p string) error) error {
-	// TODO detect circular dependencies
-	if deps, ok := bh.templates[p]; ok {
-		for _, dep := range deps {
-			if err := walkFn(dep); err != nil {
-				return err
-			}
-			// Walk through all dependencies of dep
-			if err := bh.walkDependencies(dep, walkFn); err != nil {
-				return err
+	return bh.walkDependenciesFrom(p, []string{p}, walkFn)
+}
+
+// Walks the dependencies of p, where chain is the list of files
+// which were walked to reach p, ending with p itself
+func (bh *BlogHead) walkDependenciesFrom(p string, chain []string, walkFn func(p string) error) error {
+	for _, dep := range bh.dependents(p) {
+		next := append(chain[:len(chain):len(chain)], dep)
+		for _, walked := range chain {
+			if walked == dep {
+				return bh.newCycleError(next)
 			}
 		}
+
+		if err := walkFn(dep); err != nil {
+			return err
+		}
+		// Walk through all dependencies of dep
+		if err := bh.walkDependenciesFrom(dep, next, walkFn); err != nil {
+			return err
+		}
 	}
 
 	if err := walkFn(p); err != nil {
@@ -357,6 +692,35 @@ func (bh *BlogHead) walkDependencies(p string, walkFn func(p string) error) erro
 	return nil
 }
 
+// CycleError is returned when templates include each other in a loop.
+// Chain is the list of files in the loop, starting and ending with the same file
+type CycleError struct {
+	Chain []string
+}
+
+func (e *CycleError) Error() string {
+	return "circular template dependency: " + strings.Join(e.Chain, " -> ")
+}
+
+// Creates a CycleError, naming each file relative to the
+// templates directory or the root directory
+func (bh *BlogHead) newCycleError(chain []string) *CycleError {
+	names := make([]string, len(chain))
+	for i, p := range chain {
+		names[i] = bh.relPath(p)
+	}
+	return &CycleError{names}
+}
+
+// Returns the path of p relative to the templates directory
+// if it is a template, or relative to the root directory
+func (bh *BlogHead) relPath(p string) string {
+	if bh.isTemplateFile(p) {
+		return bh.templateName(p)
+	}
+	return strings.TrimPrefix(trimPath(bh.Root, p), "/")
+}
+
 // Adds the value to the list if it doesn't already exist
 func appendUnique(list []string, val string) []string {
 	for _, el := range list {
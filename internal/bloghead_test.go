@@ -27,7 +27,7 @@ func makeTestBH(testName string) BHFields {
 	return BHFields{
 		Root:       path.Join(cwd, "../testdata", testName),
 		Output:     path.Join(cwd, "../testdata/.output", testName),
-		tmplDir:    path.Join(cwd, "../testdata", testName, ".templates"),
+		tmplDir:    path.Join(cwd, "../testdata", testName, ".templates") + "/",
 		configFile: path.Join(cwd, ".bloghead_test"),
 		config: &BlogConfig{
 			Root:       "../testdata/" + testName,
@@ -148,6 +148,76 @@ func TestBlogHead_Start(t *testing.T) {
 		})
 	}
 	// Remove all generated files
+	t.Cleanup(func() {
+		for _, tt := range tests {
+			if err := os.RemoveAll(tt.fields.Output); err != nil {
+				println(err.Error())
+			}
+			bh := &BlogHead{Output: tt.fields.Output}
+			if err := os.RemoveAll(bh.manifestPath()); err != nil {
+				println(err.Error())
+			}
+		}
+	})
+}
+
+func TestBlogHead_compilePages(t *testing.T) {
+	cwd := unwrap(os.Getwd()).(string)
+
+	tests := []struct {
+		name       string
+		fields     BHFields
+		jobs       int
+		pages      []string
+		wantErrors int
+	}{
+		{
+			name:   "Compiles each page with multiple workers",
+			fields: makeTestBH("basic"),
+			jobs:   4,
+			pages: []string{
+				path.Join(cwd, "../testdata/basic/index.html"),
+				path.Join(cwd, "../testdata/basic/index.html"),
+				path.Join(cwd, "../testdata/basic/index.html"),
+			},
+			wantErrors: 0,
+		},
+		{
+			name:   "Errors from every page are reported",
+			fields: makeTestBH("basic"),
+			jobs:   2,
+			pages: []string{
+				path.Join(cwd, "../testdata/basic/missing1.html"),
+				path.Join(cwd, "../testdata/basic/index.html"),
+				path.Join(cwd, "../testdata/basic/missing2.html"),
+			},
+			wantErrors: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bh := &BlogHead{
+				Root:       tt.fields.Root,
+				Output:     tt.fields.Output,
+				tmplDir:    tt.fields.tmplDir,
+				Jobs:       tt.jobs,
+				configFile: tt.fields.configFile,
+				config:     tt.fields.config,
+				templates:  tt.fields.templates,
+				watcher:    tt.fields.watcher,
+			}
+			err := bh.compilePages(tt.pages)
+			if tt.wantErrors == 0 {
+				if err != nil {
+					t.Errorf("compilePages() error = %v", err)
+				}
+				return
+			}
+			if errs, ok := err.(BuildErrors); !ok || len(errs) != tt.wantErrors {
+				t.Errorf("compilePages() error = %v, want %v errors", err, tt.wantErrors)
+			}
+		})
+	}
 	t.Cleanup(func() {
 		for _, tt := range tests {
 			if err := os.RemoveAll(tt.fields.Output); err != nil {
@@ -326,7 +396,35 @@ func TestBlogHead_walkDependencies(t *testing.T) {
 		args    args
 		wantErr bool
 	}{
-		// TODO: Add test cases.
+		{
+			name: "Walks each dependent page",
+			fields: BHFields{
+				templates: map[string][]string{
+					"head.html": {"nav.html", "about.html"},
+					"nav.html":  {"index.html"},
+				},
+			},
+			args: args{
+				p:      "head.html",
+				walkFn: func(p string) error { return nil },
+			},
+			wantErr: false,
+		},
+		{
+			name: "Dependencies which form a loop",
+			fields: BHFields{
+				templates: map[string][]string{
+					"a.html": {"b.html"},
+					"b.html": {"c.html"},
+					"c.html": {"a.html"},
+				},
+			},
+			args: args{
+				p:      "a.html",
+				walkFn: func(p string) error { return nil },
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
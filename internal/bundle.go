@@ -0,0 +1,192 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+)
+
+// Returns the path of each input of the named bundle, in the order they are bundled
+func (bh *BlogHead) bundleInputs(name string) ([]string, error) {
+	inputs, ok := bh.config.Bundles[name]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("bundle %v is not defined", name))
+	}
+
+	files := make([]string, len(inputs))
+	for i, input := range inputs {
+		files[i] = bh.assetFile(input)
+	}
+	return files, nil
+}
+
+// Returns the name of each bundle in the config, sorted so that they are built in order
+func (bh *BlogHead) bundleNames() []string {
+	names := []string{}
+	if bh.config == nil {
+		return names
+	}
+
+	for name := range bh.config.Bundles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Concatenates and minifies the inputs of the named bundle. The inputs are minified
+// as CSS or JS depending on the extension of the bundle's name
+func (bh *BlogHead) bundle(name string) ([]byte, error) {
+	files, err := bh.bundleInputs(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		minify func([]byte) []byte
+		sep    []byte
+	)
+	switch path.Ext(name) {
+	case ".css":
+		minify, sep = minifyCSS, []byte("\n")
+	case ".js":
+		// Each script ends its last statement, in case it relies on a line break
+		minify, sep = minifyJS, []byte(";\n")
+	default:
+		return nil, errors.New(fmt.Sprintf("bundle %v must have the .css or .js extension", name))
+	}
+
+	parts := make([][]byte, len(files))
+	for i, p := range files {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = minify(b)
+	}
+
+	return bytes.Join(parts, sep), nil
+}
+
+// Returns the content of the named bundle. Each bundle is built once for each build
+// and shared by the pages which use it
+func (bh *BlogHead) bundleContent(name string) ([]byte, error) {
+	bh.bundlesMu.Lock()
+	defer bh.bundlesMu.Unlock()
+
+	if b, ok := bh.bundles[name]; ok {
+		return b, nil
+	}
+
+	b, err := bh.bundle(name)
+	if err != nil {
+		return nil, err
+	}
+	if bh.bundles == nil {
+		bh.bundles = make(map[string][]byte)
+	}
+	bh.bundles[name] = b
+	return b, nil
+}
+
+// Forgets the bundles built by bundleContent, so that the next build builds them again
+func (bh *BlogHead) resetBundles() {
+	bh.bundlesMu.Lock()
+	bh.bundles = nil
+	bh.bundlesMu.Unlock()
+}
+
+// Writes the named bundle to the output directory. Returns the path it was written to
+func (bh *BlogHead) writeBundle(name string) (string, error) {
+	b, err := bh.bundleContent(name)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+	out := bh.bundlePath(name, hex.EncodeToString(sum[:]))
+
+	f, err := createFile(out)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(b); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// Returns the path of the named bundle in the output directory, where
+// hash is the hex encoded sha256 hash of the bundle's content
+func (bh *BlogHead) bundlePath(name, hash string) string {
+	return bh.assetPath(path.Join(bh.Root, path.Clean("/"+name)), hash)
+}
+
+// Writes each bundle with inputs that changed since the last build, and adds an entry
+// for each bundle to the next manifest. A bundle's entry is keyed by its path in the
+// output directory without a fingerprint, so that the key doesn't change with its content
+func (bh *BlogHead) buildBundles(manifest, next *buildManifest) error {
+	var errs BuildErrors
+	for _, name := range bh.bundleNames() {
+		key := path.Join(bh.Output, path.Clean("/"+name))
+
+		files, err := bh.bundleInputs(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		inputs, err := hashFiles(files...)
+		if err != nil {
+			errs = append(errs, errors.New(name+": "+err.Error()))
+			continue
+		}
+
+		// A bundle is written again if fingerprinting was turned on or off
+		if entry, ok := manifest.Entries[key]; ok && manifest.upToDate(key, inputs) && (entry.Output != key) == bh.config.Fingerprint {
+			next.Entries[key] = entry
+			continue
+		}
+
+		out, err := bh.writeBundle(name)
+		if err != nil {
+			errs = append(errs, errors.New(name+": "+err.Error()))
+			continue
+		}
+		next.Entries[key] = &manifestEntry{out, inputs}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Returns the published URL and integrity hash of the named bundle.
+// The bundle's inputs are dependencies of the page at p
+func (bh *BlogHead) bundleRef(p, name string) (*assetRef, error) {
+	files, err := bh.bundleInputs(name)
+	if err != nil {
+		return nil, err
+	}
+	if p != "" {
+		bh.saveDependencies(p, files...)
+	}
+
+	b, err := bh.bundleContent(name)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(b)
+	return &assetRef{
+		URL:       bh.relURL(trimPath(bh.Output, bh.bundlePath(name, hex.EncodeToString(sum[:])))),
+		Integrity: integrity(b),
+	}, nil
+}
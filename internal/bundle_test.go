@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestBlogHead_Start_bundles(t *testing.T) {
+	bh := makeTempSite(t)
+	bh.config.Bundles = map[string][]string{
+		"css/site.css": {"css/reset.css", "css/main.css"},
+		"js/site.js":   {"js/app.js"},
+	}
+
+	files := map[string]string{
+		"css/reset.css": "* { margin: 0; }\n",
+		"css/main.css":  "body {\n  color: red;\n}\n",
+		"js/app.js":     "// App\nconsole.log('hi')\n",
+		"page.html":     `<link href="{{ bundle "css/site.css" }}"><script src="{{ (bundle "js/site.js").URL }}"></script>`,
+	}
+	for name, text := range files {
+		f := unwrap(createFile(path.Join(bh.Root, name))).(*os.File)
+		if _, err := f.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+
+	read := func(name string) string {
+		return string(unwrap(ioutil.ReadFile(path.Join(bh.Output, name))).([]byte))
+	}
+	modTime := func(name string) int64 {
+		return unwrap(os.Stat(path.Join(bh.Output, name))).(os.FileInfo).ModTime().UnixNano()
+	}
+
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if got, want := read("css/site.css"), "*{margin:0}\nbody{color:red}"; got != want {
+		t.Errorf("Start() wrote the bundle %q, want %q", got, want)
+	}
+	if got, want := read("js/site.js"), "console.log('hi')"; got != want {
+		t.Errorf("Start() wrote the bundle %q, want %q", got, want)
+	}
+	if got, want := read("page.html"), `<link href="/css/site.css"><script src="/js/site.js"></script>`; got != want {
+		t.Errorf("Start() wrote the page %v, want %v", got, want)
+	}
+
+	// Only the bundle with a changed input is written again
+	js := modTime("js/site.js")
+	if err := ioutil.WriteFile(path.Join(bh.Root, "css/main.css"), []byte("body { color: blue; }"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if got := read("css/site.css"); !strings.HasSuffix(got, "body{color:blue}") {
+		t.Errorf("Start() didn't write the changed bundle, got %q", got)
+	}
+	if modTime("js/site.js") != js {
+		t.Errorf("Start() wrote a bundle which didn't change")
+	}
+	if built := bh.Stats().PageTimes; len(built) != 1 {
+		t.Errorf("Start() built %v page(s), want only the page using the bundle", len(built))
+	}
+
+	// Fingerprinted bundles replace the previous output
+	bh.config.Fingerprint = true
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if _, err := os.Stat(path.Join(bh.Output, "css/site.css")); !os.IsNotExist(err) {
+		t.Errorf("Start() didn't remove the bundle without a fingerprint")
+	}
+}
+
+func TestBlogHead_bundle_undefined(t *testing.T) {
+	bh := makeTempSite(t)
+	bh.config.Bundles = map[string][]string{"site.txt": {}}
+
+	if _, err := bh.bundle("missing.css"); err == nil {
+		t.Errorf("bundle() error = nil, want an error for an undefined bundle")
+	}
+	if _, err := bh.bundle("site.txt"); err == nil {
+		t.Errorf("bundle() error = nil, want an error for a bundle which isn't CSS or JS")
+	}
+}
+
+func TestBlogHead_bundleContent(t *testing.T) {
+	bh := makeTempSite(t)
+	bh.config.Bundles = map[string][]string{"site.css": {"main.css"}}
+
+	p := path.Join(bh.Root, "main.css")
+	if err := ioutil.WriteFile(p, []byte("a { color: red; }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	first := string(unwrap(bh.bundleContent("site.css")).([]byte))
+
+	// The bundle is built once for each build, however many pages use it
+	if err := ioutil.WriteFile(p, []byte("a { color: blue; }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(unwrap(bh.bundleContent("site.css")).([]byte)); got != first {
+		t.Errorf("bundleContent() = %v, want the bundle built earlier in the build, %v", got, first)
+	}
+
+	bh.resetBundles()
+	if got := string(unwrap(bh.bundleContent("site.css")).([]byte)); !strings.Contains(got, "blue") {
+		t.Errorf("bundleContent() after resetBundles() = %v, want the changed input", got)
+	}
+}
@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// A cache of parsed template files, keyed by the path of the template. An entry
+// is reused until the modification time of the file changes, so a template shared
+// by many pages is only read and parsed once per build. The zero value is ready to use
+type templateCache struct {
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	modTime time.Time
+	tmpl    *template.Template
+}
+
+// Get the parsed template for the file at p, parsing it if it isn't cached or
+// if the file has been modified. The template is defined with the given name, and
+// may use the functions in funcs. The returned template must not be executed,
+// its trees should be copied instead
+func (c *templateCache) get(p, name string, funcs template.FuncMap, stats *BuildStats) (*template.Template, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]*cacheEntry)
+	}
+
+	if entry, ok := c.entries[p]; ok && entry.modTime.Equal(info.ModTime()) {
+		stats.cacheHit()
+		return entry.tmpl, nil
+	}
+
+	text, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New(name).Funcs(funcs).Parse(string(text))
+	if err != nil {
+		return nil, err
+	}
+	stats.parsed()
+
+	c.entries[p] = &cacheEntry{info.ModTime(), tmpl}
+	return tmpl, nil
+}
+
+// Remove the template at p from the cache
+func (c *templateCache) invalidate(p string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, p)
+}
+
+// BuildStats records the work done while building the site
+type BuildStats struct {
+	mu sync.Mutex
+
+	// Number of template files found in the cache
+	CacheHits int
+	// Number of template files read and parsed
+	Parses int
+	// Time taken to compile and write each page
+	PageTimes map[string]time.Duration
+	// Time taken by the whole build
+	Duration time.Duration
+	// Number of pages which were minified
+	MinifiedPages int
+	// Number of bytes removed by minifying pages
+	MinifiedBytes int
+}
+
+func (s *BuildStats) cacheHit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.CacheHits++
+}
+
+func (s *BuildStats) parsed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Parses++
+}
+
+func (s *BuildStats) pageBuilt(p string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.PageTimes == nil {
+		s.PageTimes = make(map[string]time.Duration)
+	}
+	s.PageTimes[p] = d
+}
+
+func (s *BuildStats) pageMinified(saved int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.MinifiedPages++
+	s.MinifiedBytes += saved
+}
+
+// Clear all statistics before a new build
+func (s *BuildStats) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.CacheHits = 0
+	s.Parses = 0
+	s.PageTimes = make(map[string]time.Duration)
+	s.Duration = 0
+	s.MinifiedPages = 0
+	s.MinifiedBytes = 0
+}
+
+func (s *BuildStats) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		total   time.Duration
+		slowest time.Duration
+		page    string
+		avg     time.Duration
+	)
+	for p, d := range s.PageTimes {
+		total += d
+		if d > slowest {
+			slowest, page = d, p
+		}
+	}
+	if len(s.PageTimes) > 0 {
+		avg = total / time.Duration(len(s.PageTimes))
+	}
+
+	str := fmt.Sprintf("Built %v page(s) in %v\n", len(s.PageTimes), s.Duration)
+	str += fmt.Sprintf("  time per page: %v average, %v slowest (%v)\n", avg, slowest, page)
+	str += fmt.Sprintf("  template cache: %v hit(s), %v parse(s)\n", s.CacheHits, s.Parses)
+	if s.MinifiedPages > 0 {
+		str += fmt.Sprintf("  minified: %v page(s), %v byte(s) saved\n", s.MinifiedPages, s.MinifiedBytes)
+	}
+	return str
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func Test_templateCache_get(t *testing.T) {
+	dir := unwrap(ioutil.TempDir("", "bloghead_cache")).(string)
+	defer os.RemoveAll(dir)
+
+	p := path.Join(dir, "head.html")
+	if err := ioutil.WriteFile(p, []byte("<head></head>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := &templateCache{}
+	stats := &BuildStats{}
+
+	first, err := cache.get(p, "head.html", nil, stats)
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	second, err := cache.get(p, "head.html", nil, stats)
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	if first != second || stats.Parses != 1 || stats.CacheHits != 1 {
+		t.Errorf("Expected the second get to be a cache hit, got %v parse(s) and %v hit(s)", stats.Parses, stats.CacheHits)
+	}
+
+	// Modifying the file invalidates the entry
+	if err := ioutil.WriteFile(p, []byte("<head><title></title></head>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(p, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	third, err := cache.get(p, "head.html", nil, stats)
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	if third == second || stats.Parses != 2 {
+		t.Errorf("Expected a modified template to be parsed again, got %v parse(s)", stats.Parses)
+	}
+
+	// Invalidating the entry causes the file to be parsed again
+	cache.invalidate(p)
+	if _, err := cache.get(p, "head.html", nil, stats); err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	if stats.Parses != 3 {
+		t.Errorf("Expected an invalidated template to be parsed again, got %v parse(s)", stats.Parses)
+	}
+}
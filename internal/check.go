@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Check validates every page and template in the site without building it,
+// along with the theme's templates. Each file is parsed, and the templates
+// it includes must exist and must not include each other in a loop.
+// Returns BuildErrors containing every problem which was found
+func (bh *BlogHead) Check() error {
+	var (
+		errs      BuildErrors
+		pages     int
+		templates int
+	)
+
+	if err := bh.loadTheme(); err != nil {
+		return err
+	}
+
+	check := func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		absPath, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+
+		// The theme's templates are checked below, even if it is in the root directory
+		if info.IsDir() && absPath == bh.themeDir {
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() || (path.Ext(absPath) != ".html" && !isMarkdown(absPath)) {
+			return nil
+		}
+
+		isTemplate := bh.isTemplateFile(absPath)
+		if isTemplate {
+			templates++
+		} else {
+			pages++
+		}
+
+		if err := bh.checkFile(absPath, isTemplate); err != nil {
+			errs = append(errs, &PageError{absPath, err})
+		}
+
+		return nil
+	}
+
+	if err := filepath.Walk(bh.Root, check); err != nil {
+		return err
+	}
+	if _, err := os.Stat(bh.themeTmplDir); bh.themeTmplDir != "" && err == nil {
+		if err := filepath.Walk(bh.themeTmplDir, check); err != nil {
+			return err
+		}
+	}
+
+	_, _ = fmt.Fprintf(os.Stdout, "Checked %v page(s) and %v template(s)\n", pages, templates)
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Checks a single page or template
+func (bh *BlogHead) checkFile(p string, isTemplate bool) error {
+	if isMarkdown(p) {
+		// Markdown in the templates directory is not compiled
+		if isTemplate {
+			return nil
+		}
+
+		meta, err := readFrontMatter(p)
+		if err != nil {
+			return err
+		}
+		_, err = bh.pageTemplates(p, meta)
+		return err
+	}
+
+	// Following the includes finds missing templates and loops
+	if isTemplate {
+		if _, err := bh.gatherTemplates(p); err != nil {
+			return err
+		}
+	} else {
+		meta, err := getTemplateData(p)
+		if err != nil {
+			return err
+		}
+		if _, err := bh.pageTemplates(p, meta); err != nil {
+			return err
+		}
+	}
+
+	text, err := ioutil.ReadFile(p)
+	if err != nil {
+		return err
+	}
+
+	if _, err := template.New(bh.relPath(p)).Funcs(bh.funcMap("")).Parse(string(text)); err != nil {
+		return errors.New("syntax error: " + err.Error())
+	}
+
+	return nil
+}
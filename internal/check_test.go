@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBlogHead_Check(t *testing.T) {
+	tests := []struct {
+		name       string
+		fields     BHFields
+		wantErrors []string
+	}{
+		{
+			name:   "Valid site",
+			fields: makeTestBH("basic"),
+		},
+		{
+			name:   "Templates which include each other are reported with the chain of includes",
+			fields: makeTestBH("cycle"),
+			wantErrors: []string{
+				"a.html -> b.html -> a.html",
+				"b.html -> a.html -> b.html",
+				"index.html -> a.html -> b.html -> a.html",
+				"self.html -> self.html",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bh := &BlogHead{
+				Root:      tt.fields.Root,
+				tmplDir:   tt.fields.tmplDir,
+				config:    tt.fields.config,
+				templates: tt.fields.templates,
+			}
+			err := bh.Check()
+			if len(tt.wantErrors) == 0 {
+				if err != nil {
+					t.Errorf("Check() error = %v", err)
+				}
+				return
+			}
+
+			errs, ok := err.(BuildErrors)
+			if !ok || len(errs) != len(tt.wantErrors) {
+				t.Fatalf("Check() error = %v, want %v errors", err, len(tt.wantErrors))
+			}
+			for _, want := range tt.wantErrors {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Check() error = %v, want it to contain %v", err, want)
+				}
+			}
+		})
+	}
+}
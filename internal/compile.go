@@ -3,18 +3,36 @@ package internal
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
 	"io/ioutil"
 	"os"
 	"path"
-	"regexp"
+	"sort"
+	"text/template/parse"
 )
 
 // Compiles the template located at path. Once the template has been created,
 // a corresponding file in the output folder will be created and written.
 func (bh *BlogHead) compile(p string) ([]byte, error) {
+	return bh.compilePage(p, nil)
+}
+
+// Compiles the page at p. If the page is one page of a list page, the
+// pagination is made available to the page's template as .pagination
+func (bh *BlogHead) compilePage(p string, pg *pagination) ([]byte, error) {
+	if isMarkdown(p) {
+		return bh.compileMarkdown(p, pg)
+	}
+
+	meta, err := getTemplateData(p)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get dependencies for the template and save to the BlogHead
-	templates, err := bh.gatherTemplates(p)
+	templates, err := bh.pageTemplates(p, meta)
 	if err != nil {
 		return nil, err
 	}
@@ -27,45 +45,112 @@ func (bh *BlogHead) compile(p string) ([]byte, error) {
 		return nil, err
 	}
 
-	// Create a new named template from the html file
-	t, err := template.New("html").Parse("{{define \"html\"}}" + string(text) + "{{end}}")
+	if meta != nil {
+		// Set the data file as a dependency of the current page
+		bh.saveDependencies(p, metaPath(p))
+	}
+
+	files := append([]string{p}, templates...)
+	inputs, dirs, err := bh.contextFiles(files)
+	if err != nil {
+		return nil, err
+	}
+	bh.saveDependencies(p, append(inputs, dirs...)...)
+
+	data, err := bh.templateContext(p, meta, files)
 	if err != nil {
 		return nil, err
 	}
 
-	// Parse each template dependency
-	for _, tmpl := range templates {
-		text, err = ioutil.ReadFile(tmpl)
+	if pg != nil {
+		data["pagination"] = pg
+	}
+
+	return bh.execute(p, string(text), metaString(meta, "layout"), templates, data)
+}
+
+// Returns each template used by the page at p with the metadata meta. These are
+// the templates included by the page and, if the page has a layout, the layout and
+// the templates it includes. A markdown page only uses its layout's templates
+func (bh *BlogHead) pageTemplates(p string, meta map[string]interface{}) ([]string, error) {
+	templates := []string{}
+	if !isMarkdown(p) {
+		included, err := bh.gatherTemplates(p)
 		if err != nil {
 			return nil, err
 		}
+		templates = append(templates, included...)
+	}
 
-		t, err = t.Parse("{{define \"" + trimPath(bh.tmplDir, tmpl) + "\"}}" + string(text) + "{{end}}")
+	if layout := pageLayout(p, meta); layout != "" {
+		used, err := bh.layoutTemplates(layout)
 		if err != nil {
 			return nil, err
 		}
+		for _, tmpl := range used {
+			templates = appendUnique(templates, tmpl)
+		}
+	}
+
+	return templates, nil
+}
+
+// Returns the name of the page's layout in the templates directory, or an empty string
+// if it doesn't have one. A markdown page's layout can also be set with 'template'
+func pageLayout(p string, meta map[string]interface{}) string {
+	if layout := metaString(meta, "layout"); layout != "" {
+		return layout
+	}
+	if isMarkdown(p) {
+		return metaString(meta, "template")
 	}
+	return ""
+}
 
-	if len(templates) > 0 {
-		t, err = t.ParseFiles(templates...)
+// Executes the text as a template with the data. Each file in templates is
+// defined using its path relative to the templates directory it is in. The template
+// files are parsed once and then copied from the template cache for each page.
+// The template functions are available, and any files they read are recorded
+// as dependencies of the page at p.
+//
+// If layout is set, the layout is executed rather than the text, and the blocks
+// defined in the text replace the layout's blocks. The templates are added in the
+// reverse of the order they were found in, so that a template's blocks are replaced
+// by the blocks of the templates which include it, and the text is added last
+func (bh *BlogHead) execute(p, text, layout string, templates []string, data interface{}) ([]byte, error) {
+	funcs := bh.funcMap(p)
+	t := template.New("html").Funcs(funcs)
+
+	// Add each template dependency, including any templates defined within the file
+	for i := len(templates) - 1; i >= 0; i-- {
+		cached, err := bh.cache.get(templates[i], bh.templateName(templates[i]), funcs, &bh.stats)
 		if err != nil {
 			return nil, err
 		}
+
+		for _, ct := range cached.Templates() {
+			if ct.Tree == nil {
+				continue
+			}
+			if _, err := t.AddParseTree(ct.Name(), ct.Tree.Copy()); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	data, err := getTemplateData(p)
-	if err != nil {
+	// Parse the page, which may define blocks used by its templates
+	if _, err := t.Parse(text); err != nil {
 		return nil, err
 	}
 
-	if data != nil {
-		// Set the data file as a dependency of the current page
-		bh.saveDependencies(p, p[:len(p)-5]+"_meta.json")
+	name := "html"
+	if layout != "" {
+		name = layout
 	}
 
 	var b []byte
 	buf := bytes.NewBuffer(b)
-	if err := t.Execute(buf, data); err != nil {
+	if err := t.ExecuteTemplate(buf, name, data); err != nil {
 		return nil, err
 	}
 
@@ -74,43 +159,127 @@ func (bh *BlogHead) compile(p string) ([]byte, error) {
 
 // Recursively takes a text file as input and parses the text
 // to determine what templates are used in the file. Returns
-// a string slice containing the file path of each template
+// a string slice containing the file path of each template.
+// If the templates include each other in a loop, a CycleError is returned
 func (bh *BlogHead) gatherTemplates(p string) ([]string, error) {
-	f, err := os.Open(p)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	re := regexp.MustCompile("{{\\s*template\\s*\"([-_./\\w ]+)\"\\s*([.$\\w]+)?\\s*}}")
+	return bh.gatherTemplatesFrom(p, []string{p})
+}
 
-	text, err := ioutil.ReadAll(f)
+// Gathers the templates used by p, where chain is the list of files
+// which were included to reach p, ending with p itself. The templates
+// are found by walking the parse trees of the file. Each template is
+// the site's, or the theme's if the site doesn't override it
+func (bh *BlogHead) gatherTemplatesFrom(p string, chain []string) ([]string, error) {
+	t, err := bh.parseFile(p)
 	if err != nil {
 		return nil, err
 	}
 
-	matches := re.FindAllStringSubmatch(string(text), -1)
+	names, defined := templateNames(t)
 
 	filenames := []string{}
-	for _, match := range matches {
-		if len(match) > 1 {
-			templateFile := path.Join(bh.tmplDir, match[1])
-			filenames = appendUnique(filenames, templateFile)
+	for _, name := range names {
+		templateFile := bh.templatePath(name)
 
-			tmpFiles, err := bh.gatherTemplates(templateFile)
-			if err != nil {
-				return nil, err
+		// A name which isn't a file is a template defined within a file, such as a
+		// block. Names with an extension must be files, unless they are defined here
+		if _, err := os.Stat(templateFile); err != nil {
+			if defined[name] || path.Ext(name) == "" {
+				continue
 			}
+			return nil, errors.New(fmt.Sprintf("template %v could not be found: %v", name, err))
+		}
 
-			for _, tf := range tmpFiles {
-				filenames = appendUnique(filenames, tf)
+		// Copy the chain so that the includes of each template are followed separately
+		next := append(chain[:len(chain):len(chain)], templateFile)
+		for _, included := range chain {
+			if included == templateFile {
+				return nil, bh.newCycleError(next)
 			}
 		}
+
+		filenames = appendUnique(filenames, templateFile)
+
+		tmpFiles, err := bh.gatherTemplatesFrom(templateFile, next)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tf := range tmpFiles {
+			filenames = appendUnique(filenames, tf)
+		}
 	}
 
 	return filenames, nil
 }
 
+// Parses the file at p. Templates, including the theme's, are parsed through the cache
+func (bh *BlogHead) parseFile(p string) (*template.Template, error) {
+	if bh.isTemplateFile(p) {
+		return bh.cache.get(p, bh.templateName(p), bh.funcMap(""), &bh.stats)
+	}
+
+	text, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	return template.New(bh.relPath(p)).Funcs(bh.funcMap("")).Parse(string(text))
+}
+
+// Returns the name of each template executed by t or the templates defined with it,
+// in the order they are found, along with the set of templates which t defines
+func templateNames(t *template.Template) ([]string, map[string]bool) {
+	names := []string{}
+	defined := make(map[string]bool)
+
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.IfNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			names = appendUnique(names, n.Name)
+		}
+	}
+
+	// Walk the file's own tree first so that names are found in order
+	trees := []*template.Template{}
+	for _, dt := range t.Templates() {
+		if dt.Name() != t.Name() {
+			trees = append(trees, dt)
+		}
+	}
+	sort.Slice(trees, func(i, j int) bool {
+		return trees[i].Name() < trees[j].Name()
+	})
+	trees = append([]*template.Template{t}, trees...)
+	for _, dt := range trees {
+		if dt.Tree == nil {
+			continue
+		}
+		if dt.Name() != t.Name() {
+			defined[dt.Name()] = true
+		}
+		walk(dt.Tree.Root)
+	}
+
+	return names, defined
+}
+
 // Creates a file and any directories on the path that don't currently exist.
 // Returns the newly opened file. The caller must close the file
 func createFile(p string) (*os.File, error) {
@@ -128,10 +297,14 @@ func createFile(p string) (*os.File, error) {
 }
 
 // Look for a file with the name <filename>_meta.json
-// This will contain data to be used in the template, if any
+// This will contain data to be used in the template, if any.
+// The data for a markdown page is read from its front matter instead
 func getTemplateData(p string) (map[string]interface{}, error) {
-	// Trim .html extension from name
-	if f, err := os.Open(p[:len(p)-5] + "_meta.json"); err == nil {
+	if isMarkdown(p) {
+		return readFrontMatter(p)
+	}
+
+	if f, err := os.Open(metaPath(p)); err == nil {
 		defer f.Close()
 
 		d, err := ioutil.ReadAll(f)
@@ -152,6 +325,26 @@ func getTemplateData(p string) (map[string]interface{}, error) {
 	return nil, nil
 }
 
+// Returns the path of the data file for the page at p
+func metaPath(p string) string {
+	return trimExt(p) + "_meta.json"
+}
+
+// Returns the path of the compiled page in the output directory for the page at p.
+// Markdown pages are written with the .html extension
+func (bh *BlogHead) outputPath(p string) string {
+	rel := trimPath(bh.Root, p)
+	if isMarkdown(rel) {
+		rel = trimExt(rel) + ".html"
+	}
+	return path.Join(bh.Output, rel)
+}
+
+// Removes the file extension from the path p
+func trimExt(p string) string {
+	return p[:len(p)-len(path.Ext(p))]
+}
+
 // Trims the base path from the path p.
 // If p does not start with base, then p is returned
 func trimPath(base string, p string) string {
@@ -165,3 +358,70 @@ func trimPath(base string, p string) string {
 
 	return p
 }
+
+// Returns each string passed as the first argument to the function fn in t or the templates defined with it
+func stringArgs(t *template.Template, fn string) []string {
+	names := []string{}
+	walkTemplates(t, func(node parse.Node) {
+		if n, ok := node.(*parse.CommandNode); ok && len(n.Args) >= 2 {
+			ident, isIdent := n.Args[0].(*parse.IdentifierNode)
+			name, isString := n.Args[1].(*parse.StringNode)
+			if isIdent && isString && ident.Ident == fn {
+				names = appendUnique(names, name.Text)
+			}
+		}
+	})
+	return names
+}
+
+// Calls visit with each node of t and the templates defined with it
+func walkTemplates(t *template.Template, visit func(node parse.Node)) {
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		visit(node)
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		case *parse.ChainNode:
+			walk(n.Node)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		}
+	}
+
+	for _, dt := range t.Templates() {
+		if dt.Tree != nil {
+			walk(dt.Tree.Root)
+		}
+	}
+}
@@ -2,7 +2,10 @@ package internal
 
 import (
 	"github.com/fsnotify/fsnotify"
+	"os"
+	"path"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -52,6 +55,8 @@ func TestBlogHead_compile(t *testing.T) {
 }
 
 func TestBlogHead_gatherTemplates(t *testing.T) {
+	cwd := unwrap(os.Getwd()).(string)
+
 	type fields struct {
 		Root       string
 		Output     string
@@ -71,7 +76,24 @@ func TestBlogHead_gatherTemplates(t *testing.T) {
 		want    []string
 		wantErr bool
 	}{
-		// TODO: Add test cases.
+		{
+			name:   "Page with a single template",
+			fields: fields(makeTestBH("basic")),
+			args:   args{path.Join(cwd, "../testdata/basic/index.html")},
+			want:   []string{path.Join(cwd, "../testdata/basic/.templates/head.html")},
+		},
+		{
+			name:    "Templates which include each other",
+			fields:  fields(makeTestBH("cycle")),
+			args:    args{path.Join(cwd, "../testdata/cycle/index.html")},
+			wantErr: true,
+		},
+		{
+			name:    "Template which includes itself",
+			fields:  fields(makeTestBH("cycle")),
+			args:    args{path.Join(cwd, "../testdata/cycle/.templates/self.html")},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -142,3 +164,122 @@ func Test_trimPath(t *testing.T) {
 		})
 	}
 }
+
+func TestBlogHead_gatherTemplates_cycleError(t *testing.T) {
+	cwd := unwrap(os.Getwd()).(string)
+	fields := makeTestBH("cycle")
+	bh := &BlogHead{
+		Root:      fields.Root,
+		tmplDir:   fields.tmplDir,
+		templates: fields.templates,
+	}
+
+	_, err := bh.gatherTemplates(path.Join(cwd, "../testdata/cycle/index.html"))
+	cycleErr, ok := err.(*CycleError)
+	if !ok {
+		t.Fatalf("gatherTemplates() error = %v, want a CycleError", err)
+	}
+
+	want := "index.html -> a.html -> b.html -> a.html"
+	if got := strings.Join(cycleErr.Chain, " -> "); got != want {
+		t.Errorf("gatherTemplates() chain = %v, want %v", got, want)
+	}
+}
+
+func TestBlogHead_compile_layout(t *testing.T) {
+	bh := makeTempSite(t)
+
+	files := map[string]string{
+		".templates/base.html": `<html>{{- template "head.html" . -}}<body>{{ block "main" . }}Default{{ end }}</body></html>`,
+		".templates/post.html": `{{ template "base.html" . }}{{ define "main" }}<article>{{ block "body" . }}{{ end }}</article>{{ end }}`,
+		"page.html":            `Ignored{{ define "main" }}<p>Page</p>{{ end }}`,
+		"page_meta.json":       `{"title": "Page", "layout": "base.html"}`,
+		"post.html":            `{{ define "body" }}<p>{{ .title }}</p>{{ end }}`,
+		"post_meta.json":       `{"title": "Post", "layout": "post.html"}`,
+		"plain.html":           `{{ template "base.html" . }}`,
+	}
+	for name, text := range files {
+		f := unwrap(createFile(path.Join(bh.Root, name))).(*os.File)
+		if _, err := f.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+
+	tests := []struct {
+		name      string
+		page      string
+		want      string
+		templates []string
+	}{
+		{
+			name:      "Page replaces the layout's block",
+			page:      "page.html",
+			want:      "<html><head>Page</head><body><p>Page</p></body></html>",
+			templates: []string{"base.html", "head.html"},
+		},
+		{
+			name:      "Layout which extends another layout",
+			page:      "post.html",
+			want:      "<html><head>Post</head><body><article><p>Post</p></article></body></html>",
+			templates: []string{"post.html", "base.html", "head.html"},
+		},
+		{
+			name:      "Block defaults are used without a layout",
+			page:      "plain.html",
+			want:      "<html><head></head><body>Default</body></html>",
+			templates: []string{"base.html", "head.html"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := path.Join(bh.Root, tt.page)
+			got, err := bh.compile(p)
+			if err != nil {
+				t.Fatalf("compile() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("compile() = %v, want %v", string(got), tt.want)
+			}
+
+			meta := unwrap(getTemplateData(p)).(map[string]interface{})
+			templates := unwrap(bh.pageTemplates(p, meta)).([]string)
+			for i := range templates {
+				templates[i] = trimPath(bh.tmplDir, templates[i])
+			}
+			if !reflect.DeepEqual(templates, tt.templates) {
+				t.Errorf("pageTemplates() = %v, want %v", templates, tt.templates)
+			}
+		})
+	}
+}
+
+func TestBlogHead_gatherTemplates_parseTree(t *testing.T) {
+	bh := makeTempSite(t)
+
+	files := map[string]string{
+		".templates/nav.html": `<nav></nav>`,
+		"trim.html":           `{{- template "head.html" . -}}{{ if .title }}{{template "nav.html"}}{{ end }}{{ block "content" . }}{{ end }}`,
+		"missing.html":        `{{ template "footer.html" . }}`,
+	}
+	for name, text := range files {
+		f := unwrap(createFile(path.Join(bh.Root, name))).(*os.File)
+		if _, err := f.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+
+	got, err := bh.gatherTemplates(path.Join(bh.Root, "trim.html"))
+	if err != nil {
+		t.Fatalf("gatherTemplates() error = %v", err)
+	}
+	want := []string{path.Join(bh.tmplDir, "head.html"), path.Join(bh.tmplDir, "nav.html")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("gatherTemplates() = %v, want %v", got, want)
+	}
+
+	if _, err := bh.gatherTemplates(path.Join(bh.Root, "missing.html")); err == nil {
+		t.Errorf("gatherTemplates() error = nil, want an error for the missing template")
+	}
+}
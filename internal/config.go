@@ -2,7 +2,10 @@ package internal
 
 import (
 	"encoding/json"
+	"io/ioutil"
 	"os"
+	"reflect"
+	"strings"
 )
 
 // Blog config corresponds to the configuration file used to
@@ -20,9 +23,47 @@ type BlogConfig struct {
 	Title    string `json:"Title"`
 	SubTitle string `json:"SubTitle"`
 
+	// Each feed to write, keyed by format (atom, rss or json), with the path
+	// of the feed in the output directory. If empty, an atom feed is written at feed.xml
+	Feeds map[string]string `json:"feeds,omitempty"`
+	// The maximum number of articles in each feed. If 0, every article is included
+	FeedLimit int `json:"feedLimit,omitempty"`
+	// Only publish the summary of articles which have one, rather than their content
+	FeedSummaryOnly bool `json:"feedSummaryOnly,omitempty"`
+
+	// The number of articles on each page of a list page. If 0, 10 articles are listed per page
+	PageSize int `json:"pageSize,omitempty"`
+
+	// Add a hash of each asset's content to its file name, so that
+	// style.css is published as style.3f9a1c.css
+	Fingerprint bool `json:"fingerprint,omitempty"`
+	// Stylesheets and scripts which are concatenated and minified, keyed by the path of the
+	// bundle in the output directory, with the path of each input in the root directory
+	Bundles map[string][]string `json:"bundles,omitempty"`
+	// The widths, in pixels, of the resized copies written for each JPEG and PNG image.
+	// If empty, images aren't resized
+	ImageWidths []int `json:"imageWidths,omitempty"`
+	// The quality of resized JPEG images, from 1 to 100. If 0, the quality is 85
+	ImageQuality int `json:"imageQuality,omitempty"`
+	// Write a lossless WebP copy of each PNG image and its resized copies, which
+	// is used by browsers which support it. A copy which isn't smaller isn't written
+	ImageWebP bool `json:"imageWebP,omitempty"`
+
+	// Minify each page before it is written
+	Minify bool `json:"minify,omitempty"`
+
+	// The directory of the theme, relative to the working directory, or the name of a
+	// built-in theme. The theme's templates are used unless the site has a template with
+	// the same name, and its assets unless the root directory has a file at the same path
+	Theme string `json:"theme,omitempty"`
+
 	// meta data used within bloghead
 	Blueprints map[string]string `json:"blueprints"`
 	Articles   []string          `json:"articles"`
+
+	// Any other keys in the configuration file. These are
+	// available to templates along with the site's details
+	Params map[string]interface{} `json:"-"`
 }
 
 func ReadConfig(filename string) (*BlogConfig, error) {
@@ -32,11 +73,32 @@ func ReadConfig(filename string) (*BlogConfig, error) {
 	}
 	defer f.Close()
 
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
 	bc := &BlogConfig{}
-	decoder := json.NewDecoder(f)
-	if err := decoder.Decode(bc); err != nil {
+	if err := json.Unmarshal(b, bc); err != nil {
+		return nil, err
+	}
+
+	// Keep the keys which aren't part of the config
+	values := make(map[string]interface{})
+	if err := json.Unmarshal(b, &values); err != nil {
 		return nil, err
 	}
+	// Keys are matched to fields without case, as they are when decoding
+	for key := range values {
+		for _, field := range configKeys() {
+			if strings.EqualFold(key, field) {
+				delete(values, key)
+			}
+		}
+	}
+	if len(values) > 0 {
+		bc.Params = values
+	}
 
 	return bc, nil
 }
@@ -49,9 +111,37 @@ func SaveConfig(config *BlogConfig, filename string) error {
 	defer f.Close()
 
 	encoder := json.NewEncoder(f)
-	if err := encoder.Encode(config); err != nil {
+	if len(config.Params) == 0 {
+		return encoder.Encode(config)
+	}
+
+	// Write the other keys back alongside the config
+	b, err := json.Marshal(config)
+	if err != nil {
 		return err
 	}
+	values := make(map[string]interface{})
+	if err := json.Unmarshal(b, &values); err != nil {
+		return err
+	}
+	for key, val := range config.Params {
+		if _, ok := values[key]; !ok {
+			values[key] = val
+		}
+	}
 
-	return nil
+	return encoder.Encode(values)
+}
+
+// Returns the key of each field of BlogConfig in the configuration file
+func configKeys() []string {
+	keys := []string{}
+	t := reflect.TypeOf(BlogConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		key := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if key != "" && key != "-" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
 }
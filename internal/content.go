@@ -92,11 +92,23 @@ article - a blog post used in a sequence of posts
 	return err
 }
 
+// Adds a new markdown article named 'name'. The article's metadata is written
+// as front matter in the format 'format' (yaml or toml) rather than a _meta.json
+// file, and the blueprint is used as the template the rendered markdown is placed in
+func (bh *BlogHead) AddMarkdown(name, bp, format string) (err error) {
+	err = bh.addNewMarkdownArticle(bp, path.Join(bh.Root, name+".md"), format)
+	if err := bh.Save(); err != nil {
+		return err
+	}
+	return err
+}
+
 // Creates a new generic web page based on the named template
 func (bh *BlogHead) addNewPage(bp, name string) error {
 	// Check that a blueprint with the bp exists
 	// If bp is an empty string, we should skip this and initialize an empty page
-	if _, ok := bh.config.Blueprints[bp]; bp != "" && !ok {
+	blueprint, ok := bh.blueprintPath(bp)
+	if bp != "" && !ok {
 		return errors.New("Could not find a blueprint named " + bp + ". Did you remember to create it first?\n")
 	}
 
@@ -116,7 +128,7 @@ func (bh *BlogHead) addNewPage(bp, name string) error {
 	html := []byte("")
 	if bp != "" {
 		// Copy the blueprint page to the new path
-		html, err = ioutil.ReadFile(bh.config.Blueprints[bp])
+		html, err = ioutil.ReadFile(blueprint)
 		if err != nil {
 			return err
 		}
@@ -162,6 +174,53 @@ func (bh *BlogHead) addNewArticle(bp, name string) error {
 	return nil
 }
 
+// Creates a new markdown article with default front matter and adds
+// the page to the list of articles. If a blueprint is named, the
+// article's template is set to the blueprint
+func (bh *BlogHead) addNewMarkdownArticle(bp, name, format string) error {
+	meta := bh.newDefaultMeta(name)
+
+	if bp != "" {
+		tmpl, ok := bh.blueprintPath(bp)
+		if !ok {
+			return errors.New("Could not find a blueprint named " + bp + ". Did you remember to create it first?\n")
+		}
+		meta.Template = bh.templateName(tmpl)
+	}
+
+	// Check that a page doesn't already exist at the path
+	_, err := os.Stat(name)
+	if err == nil {
+		return errors.New("Cannot create a page at " + name + ": already exists.")
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	frontMatter, err := marshalFrontMatter(*meta, format)
+	if err != nil {
+		return err
+	}
+
+	f, err := createFile(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(frontMatter); err != nil {
+		return err
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	// Add the page to articles list
+	bh.config.Articles = appendUnique(bh.config.Articles, "."+trimPath(cwd, name))
+	return nil
+}
+
 func (bh *BlogHead) createContentFile(name string) error {
 	// Create empty file for content in .data
 	f, err := createFile(path.Join(bh.tmplDir, ".data", path.Base(name), "content.html"))
@@ -172,26 +231,36 @@ func (bh *BlogHead) createContentFile(name string) error {
 	return nil
 }
 
-func (bh *BlogHead) addDefaultMeta(page string) error {
-	type defaultMeta struct {
-		Title   string `json:"title"`
-		Updated string `json:"updated"`
-		Link    string `json:"link"`
-	}
+// The metadata which is created for each new article
+type defaultMeta struct {
+	Title     string   `json:"title" yaml:"title" toml:"title"`
+	Published string   `json:"published" yaml:"published" toml:"published"`
+	Updated   string   `json:"updated" yaml:"updated" toml:"updated"`
+	Link      string   `json:"link" yaml:"link" toml:"link"`
+	Author    string   `json:"author,omitempty" yaml:"author,omitempty" toml:"author,omitempty"`
+	Tags      []string `json:"tags" yaml:"tags" toml:"tags"`
+	Template  string   `json:"template,omitempty" yaml:"template,omitempty" toml:"template,omitempty"`
+}
 
-	title := path.Base(page)
-	meta := &defaultMeta{
-		title[:len(title)-5],
-		time.Now().Format(time.RFC3339),
-		path.Join(bh.config.Domain, trimPath(bh.Root, page)),
+func (bh *BlogHead) newDefaultMeta(page string) *defaultMeta {
+	now := time.Now().Format(time.RFC3339)
+	return &defaultMeta{
+		Title:     trimExt(path.Base(page)),
+		Published: now,
+		Updated:   now,
+		Link:      path.Join(bh.config.Domain, trimPath(bh.Output, bh.outputPath(page))),
+		Author:    bh.config.Author,
+		Tags:      []string{},
 	}
+}
 
-	b, err := json.Marshal(meta)
+func (bh *BlogHead) addDefaultMeta(page string) error {
+	b, err := json.Marshal(bh.newDefaultMeta(page))
 	if err != nil {
 		return err
 	}
 
-	f, err := os.Create(page[:len(page)-5] + "_meta.json")
+	f, err := os.Create(metaPath(page))
 	if err != nil {
 		return err
 	}
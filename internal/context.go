@@ -0,0 +1,294 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template/parse"
+	"time"
+)
+
+// The name of the directory in the root directory which contains the site's
+// data files. The files are available to every template as .Data
+const dataDirName = "data"
+
+// Details of the page being compiled, available to templates as .Page
+type pageContext struct {
+	// The page's metadata
+	Meta map[string]interface{}
+	// The path of the page relative to the root directory
+	Path string
+	// The URL the page is published at
+	URL string
+	// The path of the compiled page relative to the output directory
+	OutputPath string
+	// The revisions of an article, newest first. Empty for other pages
+	Revisions []revision
+	// The dates an article was published and last updated, from its metadata and
+	// its revisions. Zero for other pages
+	Published time.Time
+	Updated   time.Time
+}
+
+// Returns the directory containing the site's data files
+func (bh *BlogHead) dataDir() string {
+	return path.Join(bh.Root, dataDirName)
+}
+
+// Determine if p is in the data directory
+func (bh *BlogHead) isDataFile(p string) bool {
+	return strings.HasPrefix(p, bh.dataDir()+"/")
+}
+
+// Returns the data passed to the templates of the page at p. Each of the page's
+// metadata keys is available as before, and the structured context is added:
+//   .Site     the site's details from the config, and any other keys in the config
+//   .Page     the page's metadata, path, URL, output path and an article's revisions and dates
+//   .Articles the site's articles, newest first
+//   .Data     the contents of each file in the data directory
+// The articles and data are only loaded if the page or one of its templates, listed
+// in files, refers to them. Generated pages, for which p is empty, and files outside
+// of the root directory don't have .Page or .Articles. The content of an article is
+// compiled while reading the articles, so it can't use the articles itself
+func (bh *BlogHead) templateContext(p string, meta map[string]interface{}, files []string) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	for k, v := range meta {
+		data[k] = v
+	}
+
+	data["Site"] = bh.siteContext()
+
+	inRoot := p != "" && trimPath(bh.Root+"/", p) != p
+	if inRoot {
+		out := bh.outputPath(p)
+		data["Page"] = &pageContext{
+			Meta:       meta,
+			Path:       trimPath(bh.Root, p),
+			URL:        bh.siteURL(trimPath(bh.Output, out)),
+			OutputPath: trimPath(bh.Output, out),
+		}
+		if bh.isArticle(p) {
+			page := data["Page"].(*pageContext)
+			page.Revisions = bh.revisions(p)
+			page.Published, page.Updated = bh.articleDates(p, meta)
+
+			// The page's published and updated keys use the dates from the history
+			if !page.Published.IsZero() {
+				data["published"] = page.Published.UTC().Format(time.RFC3339)
+			}
+			if !page.Updated.IsZero() {
+				data["updated"] = page.Updated.UTC().Format(time.RFC3339)
+			}
+		}
+	}
+
+	uses, err := bh.templatesUse(files)
+	if err != nil {
+		return nil, err
+	}
+
+	if uses[".Data"] {
+		values, err := bh.readData()
+		if err != nil {
+			return nil, err
+		}
+		data["Data"] = values
+	}
+
+	if uses[".Articles"] && inRoot {
+		articles, err := bh.siteArticles()
+		if err != nil {
+			return nil, err
+		}
+		data["Articles"] = articles
+	}
+
+	return data, nil
+}
+
+// Returns the site's details, available to templates as .Site
+func (bh *BlogHead) siteContext() map[string]interface{} {
+	site := make(map[string]interface{})
+	if bh.config == nil {
+		return site
+	}
+
+	for k, v := range bh.config.Params {
+		site[k] = v
+	}
+
+	site["Title"] = bh.config.Title
+	site["SubTitle"] = bh.config.SubTitle
+	site["Author"] = bh.config.Author
+	site["Email"] = bh.config.Email
+	site["Domain"] = bh.config.Domain
+	site["URL"] = bh.siteURL("/")
+
+	site["BuildTime"] = bh.buildTime
+	if bh.buildTime.IsZero() {
+		site["BuildTime"] = time.Now()
+	}
+
+	return site
+}
+
+// Returns the files used by the structured context of a page, given the page and its
+// templates. The config file is used by .Site, the data files by .Data, and the files
+// of each article by .Articles. The data directory is also returned if it is used, so
+// that the page depends on it when new data files are created
+func (bh *BlogHead) contextFiles(files []string) (inputs []string, dirs []string, err error) {
+	uses, err := bh.templatesUse(files)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if uses[".Site"] && bh.configFile != "" {
+		inputs = append(inputs, bh.configFile)
+	}
+
+	if uses[".Data"] {
+		data, err := bh.dataFiles()
+		if err != nil {
+			return nil, nil, err
+		}
+		inputs = append(inputs, data...)
+		dirs = append(dirs, bh.dataDir())
+	}
+
+	if uses[".Articles"] {
+		articles, err := bh.feedFiles()
+		if err != nil {
+			return nil, nil, err
+		}
+		inputs = append(inputs, articles...)
+	}
+
+	return inputs, dirs, nil
+}
+
+// Determine which parts of the structured context are referred to in the files. A part
+// is used by a field such as .Site.Title, a variable such as $.Data, or a call such as
+// index . "Articles". A field of any value is counted, so the result may include a part
+// which isn't used, but never leaves out a part which is
+func (bh *BlogHead) templatesUse(files []string) (map[string]bool, error) {
+	uses := make(map[string]bool)
+	for _, p := range files {
+		// The files may include articles and data files, which aren't templates
+		if isMarkdown(p) || path.Ext(p) == ".json" {
+			continue
+		}
+
+		t, err := bh.parseFile(p)
+		if err != nil {
+			return nil, err
+		}
+
+		walkTemplates(t, func(node parse.Node) {
+			switch n := node.(type) {
+			case *parse.FieldNode:
+				uses["."+n.Ident[0]] = true
+			case *parse.VariableNode:
+				if len(n.Ident) > 1 {
+					uses["."+n.Ident[1]] = true
+				}
+			case *parse.CommandNode:
+				if len(n.Args) == 0 {
+					return
+				}
+				if ident, ok := n.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "index" {
+					for _, arg := range n.Args[1:] {
+						if key, ok := arg.(*parse.StringNode); ok {
+							uses["."+key.Text] = true
+						}
+					}
+				}
+			}
+		})
+	}
+	return uses, nil
+}
+
+// Returns each JSON, YAML and TOML file in the data directory
+func (bh *BlogHead) dataFiles() ([]string, error) {
+	files := []string{}
+	err := filepath.Walk(bh.dataDir(), func(p string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch path.Ext(p) {
+		case ".json", ".yaml", ".yml", ".toml":
+			if !info.IsDir() {
+				files = append(files, p)
+			}
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Reads each file in the data directory. The contents of a file are keyed by the
+// name of the file without its extension. Files in a subdirectory are in a map
+// keyed by the name of the subdirectory, so data/authors/ann.json is .Data.authors.ann
+func (bh *BlogHead) readData() (map[string]interface{}, error) {
+	files, err := bh.dataFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	data := make(map[string]interface{})
+	for _, p := range files {
+		value, err := readDataFile(p)
+		if err != nil {
+			return nil, errors.New(p + ": " + err.Error())
+		}
+
+		dir := data
+		names := strings.Split(trimPath(bh.dataDir()+"/", trimExt(p)), "/")
+		for _, name := range names[:len(names)-1] {
+			sub, ok := dir[name].(map[string]interface{})
+			if !ok {
+				sub = make(map[string]interface{})
+				dir[name] = sub
+			}
+			dir = sub
+		}
+		dir[names[len(names)-1]] = value
+	}
+
+	return data, nil
+}
+
+// Reads the data file at p using the format given by its extension
+func readDataFile(p string) (interface{}, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	switch path.Ext(p) {
+	case ".json":
+		err = json.Unmarshal(b, &value)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &value)
+	case ".toml":
+		var tree *toml.Tree
+		if tree, err = toml.LoadBytes(b); err == nil {
+			value = tree.ToMap()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return normalizeValue(value), nil
+}
@@ -0,0 +1,198 @@
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBlogHead_readData(t *testing.T) {
+	bh := makeTempSite(t)
+
+	files := map[string]string{
+		"data/menu.json":        `[{"name": "Home", "url": "/"}]`,
+		"data/social.yaml":      "twitter: bloghead\n",
+		"data/authors/ann.toml": "name = \"Ann\"\n",
+		"data/notes.txt":        "not data",
+	}
+	for name, text := range files {
+		f := unwrap(createFile(path.Join(bh.Root, name))).(*os.File)
+		if _, err := f.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+
+	got, err := bh.readData()
+	if err != nil {
+		t.Fatalf("readData() error = %v", err)
+	}
+
+	want := map[string]interface{}{
+		"menu":    []interface{}{map[string]interface{}{"name": "Home", "url": "/"}},
+		"social":  map[string]interface{}{"twitter": "bloghead"},
+		"authors": map[string]interface{}{"ann": map[string]interface{}{"name": "Ann"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readData() = %v, want %v", got, want)
+	}
+}
+
+func TestBlogHead_compile_context(t *testing.T) {
+	bh := makeTempSite(t)
+	bh.config.Title = "Blog"
+	bh.config.Domain = "example.com"
+	bh.config.Params = map[string]interface{}{"tagline": "Hello"}
+
+	files := map[string]string{
+		"page.html":      "{{ .title }}|{{ .Site.Title }}|{{ .Site.tagline }}|{{ .Page.URL }}|{{ .Page.Meta.title }}|{{ .Data.menu.home }}",
+		"page_meta.json": `{"title": "Page"}`,
+		"data/menu.json": `{"home": "/"}`,
+	}
+	for name, text := range files {
+		f := unwrap(createFile(path.Join(bh.Root, name))).(*os.File)
+		if _, err := f.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+
+	got, err := bh.compile(path.Join(bh.Root, "page.html"))
+	if err != nil {
+		t.Fatalf("compile() error = %v", err)
+	}
+	if want := "Page|Blog|Hello|https://example.com/page.html|Page|/"; string(got) != want {
+		t.Errorf("compile() = %v, want %v", string(got), want)
+	}
+
+	// The page is rebuilt when the data changes
+	deps := bh.dependents(path.Join(bh.Root, "data/menu.json"))
+	if !reflect.DeepEqual(deps, []string{path.Join(bh.Root, "page.html")}) {
+		t.Errorf("dependents() = %v, want the page", deps)
+	}
+}
+
+func TestReadConfig_params(t *testing.T) {
+	dir := unwrap(ioutil.TempDir("", "bloghead_config")).(string)
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	p := path.Join(dir, ".bloghead")
+	if err := ioutil.WriteFile(p, []byte(`{"Title": "Blog", "author": "Ann", "tagline": "Hello", "articles": []}`), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := ReadConfig(p)
+	if err != nil {
+		t.Fatalf("ReadConfig() error = %v", err)
+	}
+	if want := map[string]interface{}{"tagline": "Hello"}; !reflect.DeepEqual(config.Params, want) {
+		t.Errorf("ReadConfig() params = %v, want %v", config.Params, want)
+	}
+	if config.Author != "Ann" {
+		t.Errorf("ReadConfig() author = %v, want Ann", config.Author)
+	}
+
+	// Other keys are kept when the config is saved
+	if err := SaveConfig(config, p); err != nil {
+		t.Fatalf("SaveConfig() error = %v", err)
+	}
+	config, err = ReadConfig(p)
+	if err != nil {
+		t.Fatalf("ReadConfig() error = %v", err)
+	}
+	if config.Params["tagline"] != "Hello" || config.Title != "Blog" {
+		t.Errorf("ReadConfig() after SaveConfig() = %+v", config)
+	}
+}
+
+func TestBlogHead_Start_concurrentArticles(t *testing.T) {
+	bh := makeTempSite(t)
+	bh.Jobs = 8
+
+	write := func(name, text string) {
+		f := unwrap(createFile(path.Join(bh.Root, name))).(*os.File)
+		if _, err := f.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+
+	// Each HTML article's content is compiled from its content.html
+	want := ""
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("a%02d.html", i)
+		date := time.Date(2021, 1, 20-i, 0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+		write(name, "<h1>Article</h1>")
+		write(trimExt(name)+"_meta.json", fmt.Sprintf(`{"title": "T%02d", "published": %q}`, i, date))
+		write(path.Join(".templates/.data", name, "content.html"), fmt.Sprintf("CONTENT%02d", i))
+		bh.config.Articles = append(bh.config.Articles, path.Join(bh.Root, name))
+		want += fmt.Sprintf("[T%02d=CONTENT%02d]", i, i)
+	}
+	for i := 0; i < 8; i++ {
+		write(fmt.Sprintf("list%v.html", i), "{{ range .Articles }}[{{ .Title }}={{ .Content }}]{{ end }}")
+	}
+
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	for i := 0; i < 8; i++ {
+		b, err := ioutil.ReadFile(path.Join(bh.Output, fmt.Sprintf("list%v.html", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("Start() wrote list%v.html as %v, want %v", i, string(b), want)
+		}
+	}
+}
+
+func TestBlogHead_templatesUse(t *testing.T) {
+	bh := makeTempSite(t)
+
+	tests := []struct {
+		text string
+		want map[string]bool
+	}{
+		{"{{ .Site.Title }}", map[string]bool{".Site": true}},
+		{"{{ with .Page }}{{ $.Data.menu }}{{ end }}", map[string]bool{".Page": true, ".Data": true}},
+		{`{{ range index . "Articles" }}{{ end }}`, map[string]bool{".Articles": true}},
+		{"{{ $site := .Site }}{{ $site.Title }}", map[string]bool{".Site": true}},
+		// Text which isn't part of an action doesn't use the context
+		{"<p>Use .Site and .Data in templates</p>{{/* .Articles */}}", map[string]bool{}},
+	}
+	for _, tt := range tests {
+		p := path.Join(bh.Root, "page.html")
+		if err := ioutil.WriteFile(p, []byte(tt.text), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := bh.templatesUse([]string{p})
+		if err != nil {
+			t.Fatalf("templatesUse(%q) error = %v", tt.text, err)
+		}
+		for _, key := range []string{".Site", ".Data", ".Articles"} {
+			if got[key] != tt.want[key] {
+				t.Errorf("templatesUse(%q)[%v] = %v, want %v", tt.text, key, got[key], tt.want[key])
+			}
+		}
+	}
+	// A markdown article and a data file aren't parsed as templates
+	article := path.Join(bh.Root, "post.md")
+	data := path.Join(bh.Root, "post_meta.json")
+	if err := ioutil.WriteFile(article, []byte("Use {{ .Site.Title }} or {{ undefined }}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(data, []byte(`{"title": "{{ .Data }}"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := bh.templatesUse([]string{article, data})
+	if err != nil || len(got) != 0 {
+		t.Errorf("templatesUse() = %v, %v, want no uses", got, err)
+	}
+}
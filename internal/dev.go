@@ -0,0 +1,278 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The path of the server sent events endpoint used by the live reload script
+const devEventsPath = "/_bloghead/events"
+
+// Injected into every HTML page served by the development server. The script listens
+// for events about the page it is showing. A 'reload' event reloads the page and a
+// 'build-error' event shows the compile error on top of the page
+const liveReloadScript = `<script>
+(function () {
+	var source = new EventSource("` + devEventsPath + `?page=" + encodeURIComponent(location.pathname));
+	source.addEventListener("reload", function () {
+		location.reload();
+	});
+	source.addEventListener("build-error", function (e) {
+		var overlay = document.getElementById("bloghead-error");
+		if (!overlay) {
+			overlay = document.createElement("div");
+			overlay.id = "bloghead-error";
+			overlay.style.cssText = "position:fixed;top:0;left:0;right:0;bottom:0;z-index:2147483647;" +
+				"overflow:auto;padding:2em;background:rgba(24,24,24,0.95);color:#ff6b6b;font:14px monospace;";
+			document.body.appendChild(overlay);
+		}
+		var pre = document.createElement("pre");
+		pre.style.whiteSpace = "pre-wrap";
+		pre.textContent = JSON.parse(e.data);
+		overlay.innerHTML = "<h2 style='color:#fff'>bloghead: build failed</h2>";
+		overlay.appendChild(pre);
+	});
+})();
+</script>
+`
+
+type devEvent struct {
+	name string
+	data string
+}
+
+// devServer serves the output directory and notifies browsers when
+// the page they are showing is rebuilt
+type devServer struct {
+	bh *BlogHead
+
+	mu sync.Mutex
+	// Each connected browser, and the output file it is showing
+	clients map[chan devEvent]string
+	// The most recent compile error for each output file
+	errors map[string]string
+}
+
+// Dev builds the site and starts watching it for changes, then serves the output
+// directory at addr. HTML pages are served with a script which reloads the page
+// whenever it is rebuilt, or shows the error if the page failed to compile
+func (bh *BlogHead) Dev(addr string) error {
+	s := &devServer{
+		bh:      bh,
+		clients: make(map[chan devEvent]string),
+		errors:  make(map[string]string),
+	}
+	bh.onBuild = s.pageBuilt
+	bh.onGenerate = s.generated
+	bh.onAssets = s.assetsChanged
+
+	// Bind the address first, so that a port which is in use is reported before anything is built
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(devEventsPath, s.events)
+	mux.HandleFunc("/", s.serve)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- http.Serve(ln, mux)
+	}()
+
+	_, _ = fmt.Fprintf(os.Stdout, "Serving %v at http://%v\n", bh.Output, addr)
+
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- bh.Watch()
+	}()
+
+	select {
+	case err := <-watchErr:
+		return err
+	case err := <-serveErr:
+		return err
+	}
+}
+
+// Called after a page is compiled. Notifies each browser showing the page,
+// or any of the pages of a list page
+func (s *devServer) pageBuilt(p string, err error) {
+	outputs := s.outputs(p)
+
+	ev := devEvent{name: "reload"}
+	if err != nil {
+		b, _ := json.Marshal(p + ": " + err.Error())
+		ev = devEvent{name: "build-error", data: string(b)}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for out := range outputs {
+		if err != nil {
+			s.errors[out] = ev.data
+		} else {
+			delete(s.errors, out)
+		}
+	}
+	s.notify(outputs, ev)
+}
+
+// Called after the taxonomy pages are written. Notifies each browser showing one of them
+func (s *devServer) generated(outputs []string) {
+	files := make(map[string]bool)
+	for _, out := range outputs {
+		files[out] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notify(files, devEvent{name: "reload"})
+}
+
+// Called after assets or bundles are written. Every page may use them, so each browser is reloaded
+func (s *devServer) assetsChanged() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files := make(map[string]bool)
+	for _, file := range s.clients {
+		files[file] = true
+	}
+	s.notify(files, devEvent{name: "reload"})
+}
+
+// Returns each output file written for the page at p. Pages after the
+// first page of a list page are written to page/2/index.html and so on
+func (s *devServer) outputs(p string) map[string]bool {
+	outputs := map[string]bool{s.bh.outputPath(p): true}
+	for _, out := range s.bh.listPageOutputs(p) {
+		outputs[out] = true
+	}
+	return outputs
+}
+
+// Sends the event to each browser showing one of the files. s.mu must be held
+func (s *devServer) notify(files map[string]bool, ev devEvent) {
+	for ch, file := range s.clients {
+		if !files[file] {
+			continue
+		}
+		// Don't block the build on a slow browser
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Streams events for the page named in the 'page' query parameter
+func (s *devServer) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	file := s.resolve(r.URL.Query().Get("page"))
+	ch := make(chan devEvent, 4)
+
+	s.mu.Lock()
+	s.clients[ch] = file
+	// Show the error right away if the page is already broken
+	if data, ok := s.errors[file]; ok {
+		ch <- devEvent{name: "build-error", data: data}
+	}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, ch)
+		s.mu.Unlock()
+	}()
+
+	// Send a comment periodically so that proxies don't close the connection
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			_, _ = fmt.Fprint(w, ": ping\n\n")
+		case ev := <-ch:
+			_, _ = fmt.Fprintf(w, "event: %v\ndata: %v\n\n", ev.name, ev.data)
+		}
+		flusher.Flush()
+	}
+}
+
+// Serves files from the output directory, adding the live reload script to HTML pages
+func (s *devServer) serve(w http.ResponseWriter, r *http.Request) {
+	file := s.resolve(r.URL.Path)
+	if path.Ext(file) != ".html" {
+		http.FileServer(http.Dir(s.bh.Output)).ServeHTTP(w, r)
+		return
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		// A page which failed on the first build has no output yet, but the
+		// browser should still be told about the error
+		s.mu.Lock()
+		_, broken := s.errors[file]
+		s.mu.Unlock()
+		if !broken {
+			http.FileServer(http.Dir(s.bh.Output)).ServeHTTP(w, r)
+			return
+		}
+		b = []byte("<!DOCTYPE html><html><body></body></html>")
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write(injectScript(b, liveReloadScript))
+}
+
+// Returns the file in the output directory which is served for the URL path
+func (s *devServer) resolve(urlPath string) string {
+	p := path.Join(s.bh.Output, path.Clean("/"+urlPath))
+	if strings.HasSuffix(urlPath, "/") {
+		return path.Join(p, "index.html")
+	}
+	if info, err := os.Stat(p); err == nil && info.IsDir() {
+		return path.Join(p, "index.html")
+	}
+	return p
+}
+
+// Inserts the script before the closing body tag of the page,
+// or at the end of the page if it doesn't have one
+func injectScript(page []byte, script string) []byte {
+	i := bytes.LastIndex(bytes.ToLower(page), []byte("</body>"))
+	if i == -1 {
+		return append(page, []byte(script)...)
+	}
+
+	out := make([]byte, 0, len(page)+len(script))
+	out = append(out, page[:i]...)
+	out = append(out, script...)
+	return append(out, page[i:]...)
+}
@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"io/ioutil"
+	"net"
+	"path"
+	"testing"
+)
+
+func Test_injectScript(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want string
+	}{
+		{
+			name: "Script is inserted before the closing body tag",
+			page: "<html><body><h1>Hi</h1></body></html>",
+			want: "<html><body><h1>Hi</h1><script></script></body></html>",
+		},
+		{
+			name: "Closing body tag is case insensitive",
+			page: "<BODY></BODY>",
+			want: "<BODY><script></script></BODY>",
+		},
+		{
+			name: "Script is appended to pages without a body tag",
+			page: "<h1>Hi</h1>",
+			want: "<h1>Hi</h1><script></script>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := injectScript([]byte(tt.page), "<script></script>"); string(got) != tt.want {
+				t.Errorf("injectScript() = %v, want %v", string(got), tt.want)
+			}
+		})
+	}
+}
+
+func Test_devServer_resolve(t *testing.T) {
+	s := &devServer{bh: &BlogHead{Output: "/www"}}
+
+	tests := []struct {
+		urlPath string
+		want    string
+	}{
+		{"/", "/www/index.html"},
+		{"/posts/", "/www/posts/index.html"},
+		{"/posts/first.html", "/www/posts/first.html"},
+		{"/../../etc/passwd", "/www/etc/passwd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.urlPath, func(t *testing.T) {
+			if got := s.resolve(tt.urlPath); got != tt.want {
+				t.Errorf("resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_devServer_pageBuilt_listPages(t *testing.T) {
+	bh := makeTempSite(t)
+	s := &devServer{
+		bh:      bh,
+		clients: make(map[chan devEvent]string),
+		errors:  make(map[string]string),
+	}
+
+	index := path.Join(bh.Root, "index.html")
+	bh.setListPages(index, []string{bh.listPagePath(index, 2), bh.listPagePath(index, 3)})
+	about := path.Join(bh.Output, "about.html")
+
+	// A browser on each page of the list page, and on another page
+	clients := map[string]chan devEvent{}
+	for _, file := range []string{bh.listPagePath(index, 1), bh.listPagePath(index, 3), about} {
+		ch := make(chan devEvent, 1)
+		s.clients[ch] = file
+		clients[file] = ch
+	}
+	received := func(file string) bool {
+		select {
+		case <-clients[file]:
+			return true
+		default:
+			return false
+		}
+	}
+
+	s.pageBuilt(index, nil)
+	if !received(bh.listPagePath(index, 1)) || !received(bh.listPagePath(index, 3)) {
+		t.Errorf("pageBuilt() didn't reload every page of the list page")
+	}
+	if received(about) {
+		t.Errorf("pageBuilt() reloaded a page which wasn't rebuilt")
+	}
+}
+
+func Test_devServer_generated(t *testing.T) {
+	bh := makeTempSite(t)
+	s := &devServer{
+		bh:      bh,
+		clients: make(map[chan devEvent]string),
+		errors:  make(map[string]string),
+	}
+
+	// A browser on a tag page, and on another page
+	tag := path.Join(bh.Output, "tags", "go", "index.html")
+	about := path.Join(bh.Output, "about.html")
+	clients := map[string]chan devEvent{}
+	for _, file := range []string{tag, about} {
+		ch := make(chan devEvent, 1)
+		s.clients[ch] = file
+		clients[file] = ch
+	}
+	received := func(file string) bool {
+		select {
+		case <-clients[file]:
+			return true
+		default:
+			return false
+		}
+	}
+
+	s.generated([]string{tag})
+	if !received(tag) || received(about) {
+		t.Errorf("generated() didn't reload only the generated page")
+	}
+}
+
+func TestBlogHead_Dev_addressInUse(t *testing.T) {
+	ln := unwrap(net.Listen("tcp", "127.0.0.1:0")).(net.Listener)
+	defer ln.Close()
+
+	bh := makeTempSite(t)
+	if err := bh.Dev(ln.Addr().String()); err == nil {
+		t.Errorf("Dev() expected an error for an address which is in use")
+	}
+}
+
+func Test_siteWatcher_handleChanges_assetReload(t *testing.T) {
+	bh := makeTempSite(t)
+	if err := bh.Start(); err != nil {
+		t.Fatal(err)
+	}
+	bh.watcher = unwrap(fsnotify.NewWatcher()).(*fsnotify.Watcher)
+	defer bh.watcher.Close()
+
+	reloads := 0
+	bh.onAssets = func() { reloads++ }
+	w := &siteWatcher{
+		bh:     bh,
+		pages:  make(map[string]bool),
+		failed: make(map[string]bool),
+		assets: make(map[string]string),
+	}
+	if _, _, err := w.addDir(bh.Root); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing a page doesn't reload every browser, but changing an asset does
+	about := path.Join(bh.Root, "about.html")
+	if err := ioutil.WriteFile(about, []byte("<h1>Changed</h1>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.handleChanges(map[string]bool{about: true})
+	if reloads != 0 {
+		t.Errorf("handleChanges() reloaded every browser after a page changed")
+	}
+
+	style := path.Join(bh.Root, "style.css")
+	if err := ioutil.WriteFile(style, []byte("body {}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.handleChanges(map[string]bool{style: true})
+	if reloads != 1 {
+		t.Errorf("handleChanges() reloaded %v time(s) after an asset changed, want 1", reloads)
+	}
+}
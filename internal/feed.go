@@ -2,160 +2,414 @@ package internal
 
 import (
 	"encoding/json"
-	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"os"
 	"path"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 )
 
-type xmlLink struct {
-	Href string `xml:"href,attr"`
-	Rel  string `xml:"rel,attr"`
-	Type string `xml:"type,attr"`
-}
-
-type xmlEntry struct {
-	Title   string  `xml:"title"`
-	Link    xmlLink `xml:"link"`
-	Updated string  `xml:"updated"`
-	ID      string  `xml:"id"`
-	Content struct {
-		Type string `xml:"type,attr"`
-		Text string `xml:",cdata"`
-	} `xml:"content"`
-}
-
-type feedXML struct {
-	XMLName  xml.Name  `xml:"feed"`
-	Title    string    `xml:"title"`
-	Subtitle string    `xml:"subtitle"`
-	Links    []xmlLink `xml:"link"`
-	Updated  string    `xml:"updated"`
-	ID       string    `xml:"id"`
-	Author   struct {
-		Name  string `xml:"name"`
-		Email string `xml:"email"`
-	} `xml:"author"`
-	Entries []xmlEntry `xml:"entry"`
-}
-
-// Write an RSS feed.xml based on the pages in the config's Articles field
+// The path of the feed written when the config doesn't list any feeds
+const defaultFeedPath = "feed.xml"
+
+// A feed format writes the feed to w. self is the URL of the feed being written
+type feedFormat func(w io.Writer, feed *siteFeed, self string) error
+
+// Each supported feed format, keyed by the name used in the config's feeds
+var feedFormats = map[string]feedFormat{
+	"atom": writeAtom,
+	"rss":  writeRSS,
+	"json": writeJSONFeed,
+}
+
+// The site's details and articles, independent of the format of the feed
+type siteFeed struct {
+	Title    string
+	Subtitle string
+	Link     string
+	Author   string
+	Email    string
+	Updated  time.Time
+	Articles []*article
+}
+
+// An article in the site's feeds
+type article struct {
+	// Absolute path of the article's page
+	Page string
+	// A unique and permanent identifier for the article
+	ID        string
+	Link      string
+	Title     string
+	Published time.Time
+	Updated   time.Time
+	Summary   string
+	Tags      []string
+	Author    string
+	// The article's content as HTML. Empty if only the summary should be published
+	Content string
+	Meta    map[string]interface{}
+	// The article's revisions, newest first
+	Revisions []revision
+}
+
+// The date used to sort articles, which is the date the article
+// was published or, if that isn't known, the date it was last updated
+func (a *article) Date() time.Time {
+	if !a.Published.IsZero() {
+		return a.Published
+	}
+	return a.Updated
+}
+
+// Returns the path in the output directory of each feed to write, keyed by format.
+// If the config doesn't list any feeds, only an atom feed is written at feed.xml
+func (bh *BlogHead) feedPaths() (map[string]string, error) {
+	if len(bh.config.Feeds) == 0 {
+		return map[string]string{"atom": path.Join(bh.Output, defaultFeedPath)}, nil
+	}
+
+	paths := make(map[string]string)
+	for format, p := range bh.config.Feeds {
+		if _, ok := feedFormats[format]; !ok {
+			return nil, errors.New(fmt.Sprintf("Unknown feed format %v. Valid formats are atom, rss and json", format))
+		}
+		if p == "" {
+			continue
+		}
+		paths[format] = path.Join(bh.Output, p)
+	}
+	return paths, nil
+}
+
+// Returns the absolute URL of the path p within the site
+func (bh *BlogHead) siteURL(p string) string {
+	return "https://" + path.Join(bh.config.Domain, p)
+}
+
+// Writes each feed if any of its inputs changed since the last build, and
+// records the inputs in the next manifest
+func (bh *BlogHead) buildFeed(manifest, next *buildManifest) error {
+	paths, err := bh.feedPaths()
+	if err != nil {
+		return err
+	}
+
+	inputs, err := bh.feedInputs()
+
+	upToDate := err == nil
+	for _, feed := range paths {
+		if !manifest.upToDate(feed, inputs) {
+			upToDate = false
+		}
+	}
+
+	if !upToDate && err == nil {
+		err = bh.writeFeed()
+	}
+
+	for _, feed := range paths {
+		if err == nil {
+			next.Entries[feed] = &manifestEntry{feed, inputs}
+		} else if _, ok := manifest.Entries[feed]; ok {
+			// Keep the previous feed, but write it again during the next build
+			next.Entries[feed] = &manifestEntry{feed, nil}
+		}
+	}
+
+	if err != nil {
+		return &PageError{"feeds", err}
+	}
+	return nil
+}
+
+// Write each of the site's feeds based on the pages in the config's Articles field
 // The site's domain and author fields must be configured for this to work
 func (bh *BlogHead) writeFeed() error {
-	feed := feedXML{
+	paths, err := bh.feedPaths()
+	if err != nil {
+		return err
+	}
+
+	articles, err := bh.readArticles()
+	if err != nil {
+		return err
+	}
+
+	feed := bh.newSiteFeed(articles)
+
+	// Write the feeds in a consistent order
+	formats := []string{}
+	for format := range paths {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+
+	for _, format := range formats {
+		if err := bh.writeFeedFile(paths[format], feed, feedFormats[format]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Creates the feed of the articles, which must be sorted from newest to oldest.
+// The feed contains at most FeedLimit articles, and only the summary of each
+// article is included if the site or the article is configured to do so
+func (bh *BlogHead) newSiteFeed(articles []*article) *siteFeed {
+	if bh.config.FeedLimit > 0 && len(articles) > bh.config.FeedLimit {
+		articles = articles[:bh.config.FeedLimit]
+	}
+
+	feed := &siteFeed{
 		Title:    bh.config.Title,
 		Subtitle: bh.config.SubTitle,
-		Links: []xmlLink{
-			{
-				Href: "https://" + path.Join(bh.config.Domain, "feed.xml"),
-				Rel:  "self",
-				Type: "application/atom+xml",
-			},
-			{
-				Href: "https://" + bh.config.Domain,
-				Rel:  "alternate",
-				Type: "text/html",
-			},
-		},
-		Updated: time.Now().Format(time.RFC3339),
-		ID:      bh.config.Domain,
-		Author: struct {
-			Name  string `xml:"name"`
-			Email string `xml:"email"`
-		}{
-			Name:  bh.config.Author,
-			Email: bh.config.Email,
-		},
-		Entries: []xmlEntry{},
+		Link:     bh.siteURL("/"),
+		Author:   bh.config.Author,
+		Email:    bh.config.Email,
+		Updated:  time.Now(),
+		Articles: []*article{},
 	}
 
-	for _, page := range bh.config.Articles {
-		text, title, updated, err := bh.getArticleData(page)
-		if err != nil {
-			return err
+	// The feed was last updated when its most recently updated article was
+	newest := time.Time{}
+	for _, a := range articles {
+		if a.Updated.After(newest) {
+			newest = a.Updated
+		}
+	}
+	if !newest.IsZero() {
+		feed.Updated = newest
+	}
+
+	for _, a := range articles {
+		if bh.summaryOnly(a) {
+			copied := *a
+			copied.Content = ""
+			a = &copied
 		}
+		feed.Articles = append(feed.Articles, a)
+	}
+
+	return feed
+}
 
-		feed.Entries = append(feed.Entries, xmlEntry{
-			Title: title,
-			Link: xmlLink{
-				Href: "https://" + path.Join(bh.config.Domain, trimPath(bh.Root, page)),
-			},
-			Updated: updated,
-			ID:      path.Join(bh.config.Domain, trimPath(bh.Root, page)),
-			Content: struct {
-				Type string `xml:"type,attr"`
-				Text string `xml:",cdata"`
-			}{"html", text},
-		})
-	}
-
-	f, err := createFile(path.Join(bh.Output, "feed.xml"))
+func (bh *BlogHead) writeFeedFile(p string, feed *siteFeed, write feedFormat) error {
+	f, err := createFile(p)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	encoder := xml.NewEncoder(f)
-	if err := encoder.Encode(feed); err != nil {
-		return err
+	return write(f, feed, bh.siteURL(trimPath(bh.Output, p)))
+}
+
+// Reads every article in the config's Articles field which is built, sorted from newest to oldest
+func (bh *BlogHead) readArticles() ([]*article, error) {
+	articles := []*article{}
+	for _, page := range bh.config.Articles {
+		abs, err := filepath.Abs(page)
+		if err != nil {
+			return nil, err
+		}
+
+		// Drafts, scheduled and expired articles are left out unless they are built
+		status, err := bh.pageStatus(abs)
+		if err != nil {
+			return nil, err
+		}
+		if !bh.isBuilt(status) {
+			continue
+		}
+
+		a, err := bh.readArticle(page)
+		if err != nil {
+			return nil, err
+		}
+		articles = append(articles, a)
 	}
 
-	return nil
+	sort.SliceStable(articles, func(i, j int) bool {
+		return articles[i].Date().After(articles[j].Date())
+	})
+
+	return articles, nil
 }
 
-func (bh *BlogHead) getArticleData(page string) (text, title, updated string, err error) {
+// Returns the site's articles, newest first. The articles are read once for each
+// build and shared by the pages which use them. The list is copied, so that each
+// page can sort it
+func (bh *BlogHead) siteArticles() ([]*article, error) {
+	bh.articlesMu.Lock()
+	defer bh.articlesMu.Unlock()
 
-	// Get article metadata
-	b, err := ioutil.ReadFile(page[:len(page)-5] + "_meta.json")
-	if err != nil {
-		return text, title, updated, err
+	if bh.articles == nil {
+		articles, err := bh.readArticles()
+		if err != nil {
+			return nil, err
+		}
+		bh.articles = articles
 	}
 
-	// Make a temporary file to compile templates with
-	tmpF, err := os.Create(path.Join(os.TempDir(), "_tmp.html"))
+	return append([]*article{}, bh.articles...), nil
+}
+
+// Forgets the articles read by siteArticles, so that the next build reads them again
+func (bh *BlogHead) resetArticles() {
+	bh.articlesMu.Lock()
+	bh.articles = nil
+	bh.articlesMu.Unlock()
+}
+
+// Reads the article at page. The content of an HTML article is compiled from
+// its content.html in the .data directory, and the content of a markdown article
+// is its rendered markdown
+func (bh *BlogHead) readArticle(page string) (*article, error) {
+	abs, err := filepath.Abs(page)
 	if err != nil {
-		return "", "", "", err
+		return nil, err
 	}
-	defer tmpF.Close()
 
-	if _, err := tmpF.WriteString(
-		fmt.Sprintf("{{template \"%v\" .}}", path.Join(".data", path.Base(page), "content.html"))); err != nil {
-		return "", "", "", err
+	a := &article{
+		Page: abs,
+		Link: bh.siteURL(trimPath(bh.Output, bh.outputPath(abs))),
 	}
 
-	// Copy article metadata to temporary file
-	tmplData, err := os.Create(path.Join(os.TempDir(), "_tmp_meta.json"))
-	if err != nil {
-		return "", "", "", err
+	if isMarkdown(abs) {
+		meta, content, err := readMarkdown(abs)
+		if err != nil {
+			return nil, err
+		}
+		a.Meta, a.Content = meta, string(content)
+	} else {
+		if a.Meta, a.Content, err = bh.compileArticleContent(abs); err != nil {
+			return nil, err
+		}
 	}
-	defer tmplData.Close()
 
-	if _, err = tmplData.Write(b); err != nil {
-		return "", "", "", err
+	a.Title = metaString(a.Meta, "title")
+	a.Summary = metaString(a.Meta, "summary")
+	a.Author = metaString(a.Meta, "author")
+	// Categories are treated as tags
+	a.Tags = []string{}
+	for _, tag := range append(metaStrings(a.Meta, "tags"), metaStrings(a.Meta, "categories")...) {
+		a.Tags = appendUnique(a.Tags, tag)
 	}
 
-	meta := make(map[string]string)
-	if err := json.Unmarshal(b, &meta); err != nil {
-		return "", "", "", err
+	// An invalid date is left as the zero time
+	a.Updated, _ = toTime(a.Meta["updated"])
+	a.Published, _ = toTime(a.Meta["published"])
+
+	// The id only uses the dates in the metadata, so that it doesn't change with the history
+	a.ID = bh.articleID(a)
+
+	a.Revisions = bh.revisions(abs)
+	a.Published, a.Updated = bh.articleDates(abs, a.Meta)
+
+	return a, nil
+}
+
+// Returns the article's id from its metadata or, if it doesn't have one, a tag URI
+// (RFC 4151) made from the site's domain, the date the article was first published,
+// and the path of the article. The id won't change if the site's scheme changes
+func (bh *BlogHead) articleID(a *article) string {
+	if id := metaString(a.Meta, "id"); id != "" {
+		return id
+	}
+
+	date := a.Date()
+	if date.IsZero() || bh.config.Domain == "" {
+		return a.Link
 	}
 
-	var textBytes []byte
-	textBytes, err = bh.compile(tmpF.Name())
+	// The authority of a tag URI is a domain name, so any path in the configured
+	// domain is part of the specific part of the URI
+	domain := strings.TrimSuffix(bh.config.Domain, "/")
+	specific := trimPath(bh.Output, bh.outputPath(a.Page))
+	if i := strings.Index(domain, "/"); i != -1 {
+		domain, specific = domain[:i], path.Join(domain[i:], specific)
+	}
+
+	return fmt.Sprintf("tag:%v,%v:%v", domain, date.UTC().Format("2006-01-02"), specific)
+}
+
+// Determine if only the summary of the article should be published in feeds.
+// The article's summaryOnly metadata overrides the site's feedSummaryOnly config.
+// Articles without a summary are always published in full
+func (bh *BlogHead) summaryOnly(a *article) bool {
+	if a.Summary == "" {
+		return false
+	}
+	if only, ok := a.Meta["summaryOnly"].(bool); ok {
+		return only
+	}
+	return bh.config.FeedSummaryOnly
+}
+
+// Returns the metadata value for key if it is a string
+func metaString(meta map[string]interface{}, key string) string {
+	if s, ok := meta[key].(string); ok {
+		return s
+	}
+	return ""
+}
+
+// Returns the metadata value for key as a list of strings. A single
+// string is returned as a list containing only that string
+func metaStrings(meta map[string]interface{}, key string) []string {
+	switch val := meta[key].(type) {
+	case string:
+		return []string{val}
+	case []interface{}:
+		list := []string{}
+		for _, v := range val {
+			if s, ok := v.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	default:
+		return nil
+	}
+}
+
+// Compiles the content.html for the HTML article at page, using the article's
+// metadata as the template data. The content is compiled in memory, since
+// articles are read by pages which are compiled concurrently
+func (bh *BlogHead) compileArticleContent(page string) (map[string]interface{}, string, error) {
+	// Get article metadata
+	b, err := ioutil.ReadFile(metaPath(page))
 	if err != nil {
-		return "", "", "", err
+		return nil, "", err
 	}
 
-	text = string(textBytes)
+	meta := make(map[string]interface{})
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return nil, "", err
+	}
 
-	if m, ok := meta["title"]; ok {
-		title = m
+	content := path.Join(bh.contentDir(page), "content.html")
+	included, err := bh.gatherTemplates(content)
+	if err != nil {
+		return nil, "", err
 	}
+	templates := append([]string{content}, included...)
 
-	if m, ok := meta["updated"]; ok {
-		updated = m
+	data, err := bh.templateContext("", meta, templates)
+	if err != nil {
+		return nil, "", err
+	}
+
+	text := fmt.Sprintf("{{ template %q . }}", bh.templateName(content))
+	textBytes, err := bh.execute("", text, "", templates, data)
+	if err != nil {
+		return nil, "", err
 	}
 
-	return text, title, updated, nil
+	return meta, string(textBytes), nil
 }
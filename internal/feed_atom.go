@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+type xmlLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type xmlPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+}
+
+type xmlCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type xmlText struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",cdata"`
+}
+
+type xmlEntry struct {
+	Title      string        `xml:"title"`
+	Link       xmlLink       `xml:"link"`
+	ID         string        `xml:"id"`
+	Published  string        `xml:"published,omitempty"`
+	Updated    string        `xml:"updated"`
+	Author     *xmlPerson    `xml:"author,omitempty"`
+	Categories []xmlCategory `xml:"category"`
+	Summary    *xmlText      `xml:"summary,omitempty"`
+	Content    *xmlText      `xml:"content,omitempty"`
+}
+
+type feedXML struct {
+	XMLName   xml.Name   `xml:"feed"`
+	Namespace string     `xml:"xmlns,attr"`
+	Title     string     `xml:"title"`
+	Subtitle  string     `xml:"subtitle,omitempty"`
+	Links     []xmlLink  `xml:"link"`
+	Updated   string     `xml:"updated"`
+	ID        string     `xml:"id"`
+	Author    *xmlPerson `xml:"author,omitempty"`
+	Generator string     `xml:"generator"`
+	Entries   []xmlEntry `xml:"entry"`
+}
+
+// Writes the feed as an Atom document (RFC 4287). Dates use the RFC3339 format.
+// The feed's id is the URL of the site and each entry's id is the article's id
+func writeAtom(w io.Writer, feed *siteFeed, self string) error {
+	doc := feedXML{
+		Namespace: atomNamespace,
+		Title:     feed.Title,
+		Subtitle:  feed.Subtitle,
+		Links: []xmlLink{
+			{
+				Href: self,
+				Rel:  "self",
+				Type: "application/atom+xml",
+			},
+			{
+				Href: feed.Link,
+				Rel:  "alternate",
+				Type: "text/html",
+			},
+		},
+		Updated:   feed.Updated.Format(time.RFC3339),
+		ID:        feed.Link,
+		Generator: "bloghead",
+		Entries:   []xmlEntry{},
+	}
+	if feed.Author != "" {
+		doc.Author = &xmlPerson{Name: feed.Author, Email: feed.Email}
+	}
+
+	for _, a := range feed.Articles {
+		entry := xmlEntry{
+			Title: a.Title,
+			Link: xmlLink{
+				Href: a.Link,
+				Rel:  "alternate",
+				Type: "text/html",
+			},
+			ID:         a.ID,
+			Updated:    a.Date().Format(time.RFC3339),
+			Categories: []xmlCategory{},
+		}
+		if !a.Updated.IsZero() {
+			entry.Updated = a.Updated.Format(time.RFC3339)
+		}
+		if !a.Published.IsZero() {
+			entry.Published = a.Published.Format(time.RFC3339)
+		}
+		if a.Author != "" {
+			entry.Author = &xmlPerson{Name: a.Author}
+		}
+		for _, tag := range a.Tags {
+			entry.Categories = append(entry.Categories, xmlCategory{tag})
+		}
+		if a.Summary != "" {
+			entry.Summary = &xmlText{"text", a.Summary}
+		}
+		// An entry must have either content or a summary
+		if a.Content != "" || a.Summary == "" {
+			entry.Content = &xmlText{"html", a.Content}
+		}
+
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	return encoder.Encode(doc)
+}
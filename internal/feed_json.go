@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+type jsonFeedAuthor struct {
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title,omitempty"`
+	ContentHTML   string           `json:"content_html"`
+	Summary       string           `json:"summary,omitempty"`
+	DatePublished string           `json:"date_published,omitempty"`
+	DateModified  string           `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	Description string           `json:"description,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+// Writes the feed as a JSON Feed 1.1 document. Dates use the RFC3339 format
+func writeJSONFeed(w io.Writer, feed *siteFeed, self string) error {
+	doc := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       feed.Title,
+		HomePageURL: feed.Link,
+		FeedURL:     self,
+		Description: feed.Subtitle,
+		Items:       []jsonFeedItem{},
+	}
+	if feed.Author != "" {
+		doc.Authors = []jsonFeedAuthor{{Name: feed.Author}}
+	}
+
+	for _, a := range feed.Articles {
+		item := jsonFeedItem{
+			ID:          a.ID,
+			URL:         a.Link,
+			Title:       a.Title,
+			ContentHTML: a.Content,
+			Summary:     a.Summary,
+			Tags:        a.Tags,
+		}
+		// Items must have content, so summary-only items use the summary
+		if item.ContentHTML == "" {
+			item.ContentHTML = a.Summary
+		}
+		if date := a.Date(); !date.IsZero() {
+			item.DatePublished = date.Format(time.RFC3339)
+		}
+		if !a.Updated.IsZero() {
+			item.DateModified = a.Updated.Format(time.RFC3339)
+		}
+		if a.Author != "" {
+			item.Authors = []jsonFeedAuthor{{Name: a.Author}}
+		}
+		doc.Items = append(doc.Items, item)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
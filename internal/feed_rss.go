@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate,omitempty"`
+	Categories  []string `xml:"category"`
+	Description struct {
+		Text string `xml:",cdata"`
+	} `xml:"description"`
+}
+
+type rssAtomLink struct {
+	XMLName xml.Name `xml:"atom:link"`
+	Href    string   `xml:"href,attr"`
+	Rel     string   `xml:"rel,attr"`
+	Type    string   `xml:"type,attr"`
+}
+
+type rssXML struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+	AtomNS  string   `xml:"xmlns:atom,attr"`
+	Channel struct {
+		Title          string      `xml:"title"`
+		Link           string      `xml:"link"`
+		Description    string      `xml:"description"`
+		AtomLink       rssAtomLink `xml:"atom:link"`
+		ManagingEditor string      `xml:"managingEditor,omitempty"`
+		LastBuildDate  string      `xml:"lastBuildDate"`
+		Generator      string      `xml:"generator"`
+		Items          []rssItem   `xml:"item"`
+	} `xml:"channel"`
+}
+
+// Writes the feed as an RSS 2.0 document. Dates use the RFC822 format,
+// with four digit years as recommended by the RSS specification
+func writeRSS(w io.Writer, feed *siteFeed, self string) error {
+	doc := rssXML{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+	}
+	doc.Channel.Title = feed.Title
+	doc.Channel.Link = feed.Link
+	// The description is required, so fall back to the title
+	doc.Channel.Description = feed.Subtitle
+	if doc.Channel.Description == "" {
+		doc.Channel.Description = feed.Title
+	}
+	doc.Channel.AtomLink = rssAtomLink{Href: self, Rel: "self", Type: "application/rss+xml"}
+	// The managing editor must be an email address, optionally followed by a name
+	if feed.Email != "" {
+		doc.Channel.ManagingEditor = feed.Email
+		if feed.Author != "" {
+			doc.Channel.ManagingEditor += " (" + feed.Author + ")"
+		}
+	}
+	doc.Channel.LastBuildDate = feed.Updated.Format(time.RFC1123Z)
+	doc.Channel.Generator = "bloghead"
+	doc.Channel.Items = []rssItem{}
+
+	for _, a := range feed.Articles {
+		item := rssItem{
+			Title:      a.Title,
+			Link:       a.Link,
+			GUID:       rssGUID{IsPermaLink: a.ID == a.Link, Value: a.ID},
+			Categories: a.Tags,
+		}
+		if date := a.Date(); !date.IsZero() {
+			item.PubDate = date.Format(time.RFC1123Z)
+		}
+		item.Description.Text = a.Content
+		if item.Description.Text == "" {
+			item.Description.Text = a.Summary
+		}
+		doc.Channel.Items = append(doc.Channel.Items, item)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	return encoder.Encode(doc)
+}
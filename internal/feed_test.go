@@ -0,0 +1,304 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func makeTestFeed() *siteFeed {
+	return &siteFeed{
+		Title:    "Blog",
+		Subtitle: "A blog",
+		Link:     "https://example.com/",
+		Author:   "Author",
+		Email:    "author@example.com",
+		Updated:  time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC),
+		Articles: []*article{
+			{
+				ID:      "https://example.com/first.html",
+				Link:    "https://example.com/first.html",
+				Title:   "First",
+				Updated: time.Date(2021, 1, 2, 15, 4, 5, 0, time.UTC),
+				Content: "<p>First</p>",
+			},
+		},
+	}
+}
+
+func Test_feedFormats(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		self   string
+		want   []string
+	}{
+		{
+			name:   "Atom",
+			format: "atom",
+			self:   "https://example.com/feed.xml",
+			want: []string{
+				`<?xml version="1.0" encoding="UTF-8"?>`,
+				`<feed xmlns="http://www.w3.org/2005/Atom">`,
+				`<link href="https://example.com/feed.xml" rel="self" type="application/atom+xml">`,
+				"<id>https://example.com/</id>",
+				`<link href="https://example.com/first.html" rel="alternate" type="text/html">`,
+				"<updated>2021-01-02T15:04:05Z</updated>",
+				"<content type=\"html\"><![CDATA[<p>First</p>]]></content>",
+			},
+		},
+		{
+			name:   "RSS 2.0",
+			format: "rss",
+			self:   "https://example.com/rss.xml",
+			want: []string{
+				`<?xml version="1.0" encoding="UTF-8"?>`,
+				`<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">`,
+				"<title>Blog</title><link>https://example.com/</link><description>A blog</description>",
+				`<atom:link href="https://example.com/rss.xml" rel="self" type="application/rss+xml"></atom:link>`,
+				"<managingEditor>author@example.com (Author)</managingEditor>",
+				`<guid isPermaLink="true">https://example.com/first.html</guid>`,
+				"<pubDate>Sat, 02 Jan 2021 15:04:05 +0000</pubDate>",
+				"<description><![CDATA[<p>First</p>]]></description>",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := feedFormats[tt.format](&buf, makeTestFeed(), tt.self); err != nil {
+				t.Fatalf("feed error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("feed = %v, want it to contain %v", buf.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func Test_writeJSONFeed(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeJSONFeed(&buf, makeTestFeed(), "https://example.com/feed.json"); err != nil {
+		t.Fatalf("writeJSONFeed() error = %v", err)
+	}
+
+	got := jsonFeed{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("writeJSONFeed() wrote invalid json: %v", err)
+	}
+
+	want := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       "Blog",
+		HomePageURL: "https://example.com/",
+		FeedURL:     "https://example.com/feed.json",
+		Description: "A blog",
+		Authors:     []jsonFeedAuthor{{Name: "Author"}},
+		Items: []jsonFeedItem{
+			{
+				ID:            "https://example.com/first.html",
+				URL:           "https://example.com/first.html",
+				Title:         "First",
+				ContentHTML:   "<p>First</p>",
+				DatePublished: "2021-01-02T15:04:05Z",
+				DateModified:  "2021-01-02T15:04:05Z",
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("writeJSONFeed() = %+v, want %+v", got, want)
+	}
+}
+
+func TestBlogHead_feedPaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		feeds   map[string]string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "Atom feed at feed.xml by default",
+			want: map[string]string{"atom": "/www/feed.xml"},
+		},
+		{
+			name:  "Configured feeds",
+			feeds: map[string]string{"rss": "rss.xml", "json": "feeds/feed.json", "atom": ""},
+			want:  map[string]string{"rss": "/www/rss.xml", "json": "/www/feeds/feed.json"},
+		},
+		{
+			name:    "Unknown format",
+			feeds:   map[string]string{"rdf": "feed.rdf"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bh := &BlogHead{Output: "/www", config: &BlogConfig{Feeds: tt.feeds}}
+			got, err := bh.feedPaths()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("feedPaths() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("feedPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_writeAtom_summaryOnly(t *testing.T) {
+	feed := makeTestFeed()
+	feed.Articles[0].Content = ""
+	feed.Articles[0].Summary = "The first article"
+	feed.Articles[0].Tags = []string{"go"}
+
+	var buf bytes.Buffer
+	if err := writeAtom(&buf, feed, "https://example.com/feed.xml"); err != nil {
+		t.Fatalf("writeAtom() error = %v", err)
+	}
+
+	got := buf.String()
+	for _, want := range []string{
+		"<summary type=\"text\"><![CDATA[The first article]]></summary>",
+		`<category term="go"></category>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("writeAtom() = %v, want it to contain %v", got, want)
+		}
+	}
+	if strings.Contains(got, "<content") {
+		t.Errorf("writeAtom() = %v, want no content", got)
+	}
+}
+
+func TestBlogHead_articleID(t *testing.T) {
+	published := time.Date(2021, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name    string
+		domain  string
+		article *article
+		want    string
+	}{
+		{
+			name:    "Tag URI",
+			domain:  "example.com",
+			article: &article{Page: "/site/posts/first.html", Link: "https://example.com/posts/first.html", Published: published},
+			want:    "tag:example.com,2021-01-02:/posts/first.html",
+		},
+		{
+			name:    "Domain with a path",
+			domain:  "example.com/blog/",
+			article: &article{Page: "/site/first.md", Link: "https://example.com/blog/first.html", Updated: published},
+			want:    "tag:example.com,2021-01-02:/blog/first.html",
+		},
+		{
+			name: "Id from metadata",
+			article: &article{
+				Link:      "https://example.com/first.html",
+				Published: published,
+				Meta:      map[string]interface{}{"id": "urn:uuid:1234"},
+			},
+			want: "urn:uuid:1234",
+		},
+		{
+			name:    "Link when the article has no date",
+			domain:  "example.com",
+			article: &article{Page: "/site/first.html", Link: "https://example.com/first.html"},
+			want:    "https://example.com/first.html",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bh := &BlogHead{Root: "/site", Output: "/www", config: &BlogConfig{Domain: tt.domain}}
+			if got := bh.articleID(tt.article); got != tt.want {
+				t.Errorf("articleID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlogHead_summaryOnly(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  bool
+		article *article
+		want    bool
+	}{
+		{
+			name:    "Full content by default",
+			article: &article{Summary: "Summary"},
+			want:    false,
+		},
+		{
+			name:    "Summary only from config",
+			config:  true,
+			article: &article{Summary: "Summary"},
+			want:    true,
+		},
+		{
+			name:    "Article overrides config",
+			config:  true,
+			article: &article{Summary: "Summary", Meta: map[string]interface{}{"summaryOnly": false}},
+			want:    false,
+		},
+		{
+			name:    "Full content without a summary",
+			config:  true,
+			article: &article{},
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bh := &BlogHead{config: &BlogConfig{FeedSummaryOnly: tt.config}}
+			if got := bh.summaryOnly(tt.article); got != tt.want {
+				t.Errorf("summaryOnly() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlogHead_writeFeed_sortedAndLimited(t *testing.T) {
+	bh := makeTempSite(t)
+	bh.config.Domain = "example.com"
+	bh.config.FeedLimit = 2
+
+	articles := map[string]string{
+		"old.md":    "---\ntitle: Old\npublished: 2021-01-01T00:00:00Z\n---\nOld",
+		"newest.md": "---\ntitle: Newest\npublished: 2021-03-01T00:00:00Z\n---\nNewest",
+		"middle.md": "---\ntitle: Middle\npublished: 2021-02-01T00:00:00Z\nupdated: 2021-04-01T00:00:00Z\n---\nMiddle",
+	}
+	for name, text := range articles {
+		p := path.Join(bh.Root, name)
+		if err := ioutil.WriteFile(p, []byte(text), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		bh.config.Articles = append(bh.config.Articles, p)
+	}
+
+	if err := bh.writeFeed(); err != nil {
+		t.Fatalf("writeFeed() error = %v", err)
+	}
+
+	got := string(unwrap(ioutil.ReadFile(path.Join(bh.Output, "feed.xml"))).([]byte))
+	newest, middle := strings.Index(got, "<title>Newest</title>"), strings.Index(got, "<title>Middle</title>")
+	if newest == -1 || middle == -1 || newest > middle {
+		t.Errorf("writeFeed() = %v, want Newest before Middle", got)
+	}
+	if strings.Contains(got, "<title>Old</title>") {
+		t.Errorf("writeFeed() = %v, want at most 2 entries", got)
+	}
+	if !strings.Contains(got, "<feed xmlns=\"http://www.w3.org/2005/Atom\"><title></title><link href=\"https://example.com/feed.xml\"") ||
+		!strings.Contains(got, "<updated>2021-04-01T00:00:00Z</updated><id>https://example.com</id>") {
+		t.Errorf("writeFeed() = %v, want the feed updated with its newest entry", got)
+	}
+}
@@ -0,0 +1,435 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Returns the functions available to every template. Functions which read files
+// record the file as a dependency of the page at p, if p isn't empty.
+//
+// Dates:
+//   date LAYOUT VALUE      formats a time or an RFC3339 or YYYY-MM-DD string using the Go layout
+//   toTime VALUE           parses an RFC3339 or YYYY-MM-DD string as a time
+//   now                    the current time
+// URLs:
+//   absURL PATH            the absolute URL of the path within the site
+//   relURL PATH            the path from the root of the domain, including any path in the domain
+//   slugify STRING         the string in lowercase, with each run of other characters replaced with '-'
+// Strings:
+//   lower, upper, title, trim, trimPrefix, trimSuffix, replace, contains, hasPrefix,
+//   hasSuffix, split, join, repeat
+//   truncate N STRING      the first N characters of the string, followed by '…' if it was cut
+//   plainify HTML          the HTML with its tags removed
+//   default DEFAULT VALUE  the value, or the default if the value is empty
+// Math, for integers and floats:
+//   add, sub, mul, div, mod
+// Collections:
+//   list VALUES...         a list of the values
+//   dict KEY VALUE...      a map of each key to the value following it
+//   first N LIST           the first N elements of the list
+//   last N LIST            the last N elements of the list
+//   after N LIST           the elements of the list after the first N
+//   reverse LIST           the list in reverse order
+//   in LIST VALUE          true if the list contains the value
+// HTML:
+//   markdownify STRING     the markdown rendered as HTML
+//   safeHTML STRING        the string as HTML which isn't escaped
+//   jsonify VALUE          the value encoded as JSON
+//   readFile PATH          the contents of the file at the path relative to the root directory
+//   asset PATH             the published URL of the asset at the path relative to the root
+//                          directory, with its subresource integrity hash as .Integrity
+//   bundle NAME            the published URL and integrity hash of the bundle in the config
+//   image PATH ALT [SIZES] an img element for the image, with a srcset of its resized copies
+func (bh *BlogHead) funcMap(p string) template.FuncMap {
+	return template.FuncMap{
+		"date":   formatDate,
+		"toTime": toTime,
+		"now":    time.Now,
+
+		"absURL":  bh.absURL,
+		"relURL":  bh.relURL,
+		"slugify": slugify,
+
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"title":      titleCase,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":       join,
+		"repeat":     func(n int, s string) string { return strings.Repeat(s, n) },
+		"truncate":   truncate,
+		"plainify":   plainify,
+		"default":    defaultValue,
+
+		"add": func(a, b interface{}) (interface{}, error) { return arithmetic("add", a, b) },
+		"sub": func(a, b interface{}) (interface{}, error) { return arithmetic("sub", a, b) },
+		"mul": func(a, b interface{}) (interface{}, error) { return arithmetic("mul", a, b) },
+		"div": func(a, b interface{}) (interface{}, error) { return arithmetic("div", a, b) },
+		"mod": func(a, b interface{}) (interface{}, error) { return arithmetic("mod", a, b) },
+
+		"list":    func(values ...interface{}) []interface{} { return values },
+		"dict":    dict,
+		"first":   first,
+		"last":    last,
+		"after":   after,
+		"reverse": reverse,
+		"in":      in,
+
+		"markdownify": markdownify,
+		"safeHTML":    func(s string) template.HTML { return template.HTML(s) },
+		"jsonify":     jsonify,
+		"readFile": func(name string) (string, error) {
+			return bh.readFile(p, name)
+		},
+		"asset": func(name string) (*assetRef, error) {
+			return bh.asset(p, name)
+		},
+		"bundle": func(name string) (*assetRef, error) {
+			return bh.bundleRef(p, name)
+		},
+		"image": func(name, alt string, sizes ...string) (template.HTML, error) {
+			return bh.imageHTML(p, name, alt, sizes...)
+		},
+	}
+}
+
+// Converts a time or an RFC3339 or YYYY-MM-DD string to a time
+func toTime(value interface{}) (time.Time, error) {
+	switch val := value.(type) {
+	case time.Time:
+		return val, nil
+	case string:
+		if t, err := time.Parse(time.RFC3339, val); err == nil {
+			return t, nil
+		}
+		if t, err := time.Parse("2006-01-02", val); err == nil {
+			return t, nil
+		}
+		return time.Time{}, errors.New(fmt.Sprintf("%q is not an RFC3339 or YYYY-MM-DD date", val))
+	default:
+		return time.Time{}, errors.New(fmt.Sprintf("%v is not a date", value))
+	}
+}
+
+// Formats the date using the layout. An empty value is formatted as an empty string
+func formatDate(layout string, value interface{}) (string, error) {
+	if value == nil || value == "" {
+		return "", nil
+	}
+	t, err := toTime(value)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(layout), nil
+}
+
+// Returns the absolute URL of p within the site. URLs which
+// already have a scheme are returned unchanged
+func (bh *BlogHead) absURL(p string) string {
+	if strings.Contains(p, "://") {
+		return p
+	}
+	u := bh.siteURL(p)
+	if strings.HasSuffix(p, "/") && !strings.HasSuffix(u, "/") {
+		u += "/"
+	}
+	return u
+}
+
+// Returns the path of p from the root of the site's domain, which
+// includes any path in the configured domain
+func (bh *BlogHead) relURL(p string) string {
+	if strings.Contains(p, "://") {
+		return p
+	}
+	base := "/"
+	if i := strings.Index(bh.config.Domain, "/"); i != -1 {
+		base = bh.config.Domain[i:]
+	}
+	u := path.Join(base, p)
+	if strings.HasSuffix(p, "/") && !strings.HasSuffix(u, "/") {
+		u += "/"
+	}
+	return u
+}
+
+// Capitalizes the first letter of each word
+func titleCase(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		r, size := utf8.DecodeRuneInString(w)
+		words[i] = strings.ToUpper(string(r)) + w[size:]
+	}
+	return strings.Join(words, " ")
+}
+
+// Joins the elements of the list, which may be a list of any type, with sep
+func join(sep string, list interface{}) (string, error) {
+	v, err := listValue(list)
+	if err != nil {
+		return "", err
+	}
+	strs := make([]string, v.Len())
+	for i := range strs {
+		strs[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(strs, sep), nil
+}
+
+// Returns the first n characters of s. If s is cut, any trailing
+// whitespace is removed and an ellipsis is added
+func truncate(n int, s string) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimRightFunc(string(runes[:n]), func(r rune) bool {
+		return r == ' ' || r == '\n' || r == '\t'
+	}) + "…"
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// Removes each HTML tag from s
+func plainify(s interface{}) string {
+	return htmlTag.ReplaceAllString(fmt.Sprint(s), "")
+}
+
+// Returns the value, or def if the value is the zero value of its type
+func defaultValue(def, value interface{}) interface{} {
+	if value == nil {
+		return def
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String, reflect.Array:
+		if v.Len() == 0 {
+			return def
+		}
+	default:
+		if v.IsZero() {
+			return def
+		}
+	}
+	return value
+}
+
+// Converts a number from template data, which may be any integer or float type, to a float
+func toFloat(value interface{}) (float64, bool, error) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true, nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false, nil
+	default:
+		return 0, false, errors.New(fmt.Sprintf("%v is not a number", value))
+	}
+}
+
+// Applies the operation to a and b. The result is an int if both
+// numbers are integers and the result is a whole number
+func arithmetic(op string, a, b interface{}) (interface{}, error) {
+	x, xInt, err := toFloat(a)
+	if err != nil {
+		return nil, err
+	}
+	y, yInt, err := toFloat(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var result float64
+	switch op {
+	case "add":
+		result = x + y
+	case "sub":
+		result = x - y
+	case "mul":
+		result = x * y
+	case "div", "mod":
+		if y == 0 {
+			return nil, errors.New(op + ": division by zero")
+		}
+		if op == "div" {
+			result = x / y
+		} else {
+			result = math.Mod(x, y)
+		}
+	}
+
+	if xInt && yInt && result == math.Trunc(result) {
+		return int(result), nil
+	}
+	return result, nil
+}
+
+// Creates a map from a list of keys, each followed by its value
+func dict(values ...interface{}) (map[string]interface{}, error) {
+	if len(values)%2 != 0 {
+		return nil, errors.New("dict requires a value for each key")
+	}
+	m := make(map[string]interface{})
+	for i := 0; i < len(values); i += 2 {
+		key, ok := values[i].(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("dict keys must be strings, got %v", values[i]))
+		}
+		m[key] = values[i+1]
+	}
+	return m, nil
+}
+
+// Returns the reflected value of list if it is a slice or an array
+func listValue(list interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return v, errors.New(fmt.Sprintf("%v is not a list", list))
+	}
+	return v, nil
+}
+
+// Returns the elements of the list from i to j, limited to the bounds of the list
+func sliceList(list interface{}, i, j int) (interface{}, error) {
+	v, err := listValue(list)
+	if err != nil {
+		return nil, err
+	}
+	if i < 0 {
+		i = 0
+	}
+	if j > v.Len() {
+		j = v.Len()
+	}
+	if i > j {
+		i = j
+	}
+	return v.Slice(i, j).Interface(), nil
+}
+
+// Returns the first n elements of the list
+func first(n int, list interface{}) (interface{}, error) {
+	return sliceList(list, 0, n)
+}
+
+// Returns the last n elements of the list
+func last(n int, list interface{}) (interface{}, error) {
+	v, err := listValue(list)
+	if err != nil {
+		return nil, err
+	}
+	return sliceList(list, v.Len()-n, v.Len())
+}
+
+// Returns the elements of the list after the first n
+func after(n int, list interface{}) (interface{}, error) {
+	v, err := listValue(list)
+	if err != nil {
+		return nil, err
+	}
+	return sliceList(list, n, v.Len())
+}
+
+// Returns a copy of the list in reverse order
+func reverse(list interface{}) (interface{}, error) {
+	v, err := listValue(list)
+	if err != nil {
+		return nil, err
+	}
+	out := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), v.Len(), v.Len())
+	for i := 0; i < v.Len(); i++ {
+		out.Index(v.Len() - 1 - i).Set(v.Index(i))
+	}
+	return out.Interface(), nil
+}
+
+// Determine if the list contains the value. If list is a string,
+// determine if the value is a substring of it
+func in(list interface{}, value interface{}) (bool, error) {
+	if s, ok := list.(string); ok {
+		return strings.Contains(s, fmt.Sprint(value)), nil
+	}
+	v, err := listValue(list)
+	if err != nil {
+		return false, err
+	}
+	for i := 0; i < v.Len(); i++ {
+		if reflect.DeepEqual(v.Index(i).Interface(), value) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Renders the markdown to HTML
+func markdownify(s string) (template.HTML, error) {
+	b, err := renderMarkdown([]byte(s))
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(b), nil
+}
+
+// Encodes the value as JSON, which can be used within a script
+func jsonify(value interface{}) (template.JS, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return template.JS(b), nil
+}
+
+// Reads the file at name, which is relative to the root directory. The file
+// must be within the root directory. The file is a dependency of the page at p
+func (bh *BlogHead) readFile(p, name string) (string, error) {
+	file := filepath.Join(bh.Root, filepath.FromSlash(path.Clean("/"+name)))
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	if p != "" {
+		bh.saveDependencies(p, file)
+	}
+	return string(b), nil
+}
+
+// Returns each file read by the files with readFile. Names which aren't a string,
+// or which don't exist, are skipped
+func (bh *BlogHead) templateReadFiles(files []string) ([]string, error) {
+	read := []string{}
+	for _, f := range files {
+		t, err := bh.parseFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range stringArgs(t, "readFile") {
+			p := filepath.Join(bh.Root, filepath.FromSlash(path.Clean("/"+name)))
+			if _, err := os.Stat(p); err == nil {
+				read = appendUnique(read, p)
+			}
+		}
+	}
+	return read, nil
+}
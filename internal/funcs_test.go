@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBlogHead_funcMap(t *testing.T) {
+	bh := makeTempSite(t)
+	bh.config.Domain = "example.com/blog"
+
+	if err := ioutil.WriteFile(path.Join(bh.Root, "snippet.txt"), []byte("Snippet"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	data := map[string]interface{}{
+		"updated": "2021-01-02T15:04:05Z",
+		"day":     "2021-01-02",
+		"time":    time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+		"tags":    []interface{}{"go", "web", "css"},
+		"words":   []string{"a", "b", "c"},
+		"count":   float64(3),
+		"html":    "<p>Some <em>text</em></p>",
+		"empty":   "",
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr bool
+	}{
+		// Dates
+		{name: "date", text: `{{ date "January 2, 2006" .updated }}`, want: "January 2, 2021"},
+		{name: "date from YYYY-MM-DD", text: `{{ date "Jan 2" .day }}`, want: "Jan 2"},
+		{name: "date from time", text: `{{ date "2006" .time }}`, want: "2021"},
+		{name: "date of empty value", text: `{{ date "2006" .missing }}`, want: ""},
+		{name: "date of invalid value", text: `{{ date "2006" "yesterday" }}`, wantErr: true},
+		{name: "toTime", text: `{{ (toTime .updated).Year }}`, want: "2021"},
+		{name: "now", text: `{{ if (now).IsZero }}zero{{ else }}now{{ end }}`, want: "now"},
+
+		// URLs
+		{name: "absURL", text: `{{ absURL "posts/" }}`, want: "https://example.com/blog/posts/"},
+		{name: "absURL with scheme", text: `{{ absURL "https://other.com/" }}`, want: "https://other.com/"},
+		{name: "relURL", text: `{{ relURL "style.css" }}`, want: "/blog/style.css"},
+		{name: "slugify", text: `{{ slugify "Hello, World" }}`, want: "hello-world"},
+
+		// Strings
+		{name: "lower", text: `{{ lower "ABC" }}`, want: "abc"},
+		{name: "upper", text: `{{ upper "abc" }}`, want: "ABC"},
+		{name: "title", text: `{{ title "hello world" }}`, want: "Hello World"},
+		{name: "trim", text: `{{ trim "  a  " }}`, want: "a"},
+		{name: "trimPrefix", text: `{{ trimPrefix "a" "abc" }}`, want: "bc"},
+		{name: "trimSuffix", text: `{{ trimSuffix "c" "abc" }}`, want: "ab"},
+		{name: "replace", text: `{{ replace "a" "b" "aaa" }}`, want: "bbb"},
+		{name: "contains", text: `{{ contains "b" "abc" }}`, want: "true"},
+		{name: "hasPrefix", text: `{{ hasPrefix "a" "abc" }}`, want: "true"},
+		{name: "hasSuffix", text: `{{ hasSuffix "a" "abc" }}`, want: "false"},
+		{name: "split", text: `{{ index (split "," "a,b") 1 }}`, want: "b"},
+		{name: "join", text: `{{ join ", " .tags }}`, want: "go, web, css"},
+		{name: "repeat", text: `{{ repeat 3 "a" }}`, want: "aaa"},
+		{name: "truncate", text: `{{ truncate 8 "Hello there, world" }}`, want: "Hello th…"},
+		{name: "truncate short string", text: `{{ truncate 8 "Hello" }}`, want: "Hello"},
+		{name: "plainify", text: `{{ plainify .html }}`, want: "Some text"},
+		{name: "default", text: `{{ default "none" .empty }}`, want: "none"},
+		{name: "default with value", text: `{{ default "none" .day }}`, want: "2021-01-02"},
+
+		// Math
+		{name: "add", text: `{{ add 1 2 }}`, want: "3"},
+		{name: "add float from json", text: `{{ add .count 1 }}`, want: "4"},
+		{name: "sub", text: `{{ sub 1 2 }}`, want: "-1"},
+		{name: "mul", text: `{{ mul 2 1.5 }}`, want: "3"},
+		{name: "div", text: `{{ div 7 2 }}`, want: "3.5"},
+		{name: "div by zero", text: `{{ div 7 0 }}`, wantErr: true},
+		{name: "mod", text: `{{ mod 7 2 }}`, want: "1"},
+		{name: "not a number", text: `{{ add "a" 1 }}`, wantErr: true},
+
+		// Collections
+		{name: "list", text: `{{ len (list 1 2 3) }}`, want: "3"},
+		{name: "dict", text: `{{ (dict "a" 1 "b" 2).b }}`, want: "2"},
+		{name: "dict without a value", text: `{{ dict "a" }}`, wantErr: true},
+		{name: "first", text: `{{ first 2 .words }}`, want: "[a b]"},
+		{name: "first more than the list", text: `{{ first 5 .words }}`, want: "[a b c]"},
+		{name: "last", text: `{{ last 1 .tags }}`, want: "[css]"},
+		{name: "after", text: `{{ after 1 .words }}`, want: "[b c]"},
+		{name: "reverse", text: `{{ reverse .words }}`, want: "[c b a]"},
+		{name: "in", text: `{{ in .tags "web" }}`, want: "true"},
+		{name: "in string", text: `{{ in "abc" "d" }}`, want: "false"},
+		{name: "not a list", text: `{{ first 1 .count }}`, wantErr: true},
+
+		// HTML
+		{name: "markdownify", text: `{{ markdownify "*hi*" }}`, want: "<p><em>hi</em></p>\n"},
+		{name: "safeHTML", text: `{{ safeHTML .html }}`, want: "<p>Some <em>text</em></p>"},
+		{name: "escaped without safeHTML", text: `{{ .html }}`, want: "&lt;p&gt;Some &lt;em&gt;text&lt;/em&gt;&lt;/p&gt;"},
+		{name: "jsonify", text: `<script>var tags = {{ jsonify .tags }};</script>`, want: `<script>var tags = ["go","web","css"];</script>`},
+		{name: "readFile", text: `{{ readFile "snippet.txt" }}`, want: "Snippet"},
+		{name: "readFile outside of root", text: `{{ readFile "../www/index.html" }}`, wantErr: true},
+		{name: "asset", text: `{{ asset "snippet.txt" }}`, want: "/blog/snippet.txt"},
+		{name: "asset which is a page", text: `{{ asset "index.html" }}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bh.execute("", tt.text, "", nil, data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("execute() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("execute() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlogHead_readFile_dependency(t *testing.T) {
+	bh := makeTempSite(t)
+
+	page := path.Join(bh.Root, "about.html")
+	if _, err := bh.readFile(page, "index.html"); err != nil {
+		t.Fatalf("readFile() error = %v", err)
+	}
+
+	deps := bh.dependents(path.Join(bh.Root, "index.html"))
+	if strings.Join(deps, ",") != page {
+		t.Errorf("dependents() = %v, want %v", deps, page)
+	}
+}
+
+func TestBlogHead_Start_readFile(t *testing.T) {
+	bh := makeTempSite(t)
+
+	write := func(name, text string) {
+		if err := ioutil.WriteFile(path.Join(bh.Root, name), []byte(text), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("r.txt", "one")
+	write("page.html", `{{ readFile "r.txt" }}`)
+
+	// The page is rebuilt when the file it reads changes
+	for _, text := range []string{"one", "two"} {
+		write("r.txt", text)
+		if err := bh.Start(); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+		if got := string(unwrap(ioutil.ReadFile(path.Join(bh.Output, "page.html"))).([]byte)); got != text {
+			t.Errorf("Start() wrote %v, want %v", got, text)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A revision of an article, available to templates in .Page.Revisions
+// and in each of .Articles as .Revisions
+type revision struct {
+	Date time.Time `json:"date"`
+	// The subject of the commit, if the history was read from git
+	Message string `json:"message,omitempty"`
+	// The hash of the article's content, if the history was recorded by bloghead
+	Hash string `json:"hash,omitempty"`
+}
+
+// The history is stored next to the output directory, like the manifest
+func (bh *BlogHead) historyPath() string {
+	return path.Join(path.Dir(bh.Output), "."+path.Base(bh.Output)+"_history.json")
+}
+
+// Returns the source files of the article at page, whose changes are revisions of
+// the article. These are the content.html of an HTML article, or a markdown article's file
+func (bh *BlogHead) articleSources(page string) []string {
+	if isMarkdown(page) {
+		return []string{page}
+	}
+	return []string{path.Join(bh.contentDir(page), "content.html")}
+}
+
+// Returns the hash of the content of the article at page. The front matter of
+// a markdown article isn't part of its content
+func (bh *BlogHead) articleContentHash(page string) (string, error) {
+	h := sha256.New()
+	for _, p := range bh.articleSources(page) {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return "", err
+		}
+		if isMarkdown(p) {
+			if _, b, err = splitFrontMatter(b); err != nil {
+				return "", err
+			}
+		}
+		h.Write(b)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Reads the revisions recorded by previous builds, oldest first, keyed by the article's page
+func (bh *BlogHead) readHistory() map[string][]revision {
+	history := make(map[string][]revision)
+	b, err := ioutil.ReadFile(bh.historyPath())
+	if err != nil {
+		return history
+	}
+	if err := json.Unmarshal(b, &history); err != nil || history == nil {
+		return make(map[string][]revision)
+	}
+	return history
+}
+
+// Records a revision of each article whose content changed since the last build.
+// The first revision of an article is dated by its published or updated metadata,
+// and each later revision by the build it was found in. Articles which were removed
+// are dropped from the history
+func (bh *BlogHead) recordHistory() error {
+	history := bh.readHistory()
+	next := make(map[string][]revision)
+	changed := false
+
+	for _, page := range bh.config.Articles {
+		abs, err := filepath.Abs(page)
+		if err != nil {
+			return err
+		}
+
+		hash, err := bh.articleContentHash(abs)
+		if err != nil {
+			return err
+		}
+
+		revisions := history[abs]
+		if len(revisions) == 0 || revisions[len(revisions)-1].Hash != hash {
+			date := bh.now()
+			if len(revisions) == 0 {
+				meta, err := getTemplateData(abs)
+				if err != nil {
+					return err
+				}
+				if t, err := toTime(meta["published"]); err == nil {
+					date = t
+				} else if t, err := toTime(meta["updated"]); err == nil {
+					date = t
+				}
+			}
+
+			revisions = append(revisions, revision{Date: date.UTC(), Hash: hash})
+			changed = true
+		}
+		next[abs] = revisions
+	}
+
+	bh.recorded = next
+	bh.revisionCache = make(map[string][]revision)
+	if !changed && len(next) == len(history) {
+		return nil
+	}
+
+	return bh.writeHistory(next)
+}
+
+func (bh *BlogHead) writeHistory(history map[string][]revision) error {
+	b, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(bh.historyPath(), b, 0644)
+}
+
+// Moves the recorded revisions of the article at page to the article at target, after
+// the article is moved. If target is empty, the revisions are removed with the article
+func (bh *BlogHead) moveHistory(page, target string) error {
+	history := bh.readHistory()
+	revisions, ok := history[page]
+	if !ok {
+		return nil
+	}
+
+	delete(history, page)
+	if target != "" {
+		history[target] = revisions
+	}
+	return bh.writeHistory(history)
+}
+
+// Reads the commits which changed the files from git, newest first. Returns
+// nothing if git isn't installed, or the root directory isn't in a git repository
+func (bh *BlogHead) gitHistory(files []string) []revision {
+	args := append([]string{"-C", bh.Root, "log", "--format=%aI%x00%s", "--"}, files...)
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return nil
+	}
+
+	revisions := []revision{}
+	for _, line := range strings.Split(string(bytes.TrimSpace(out)), "\n") {
+		fields := strings.SplitN(line, "\x00", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		date, err := time.Parse(time.RFC3339, fields[0])
+		if err != nil {
+			continue
+		}
+		revisions = append(revisions, revision{Date: date, Message: fields[1]})
+	}
+	return revisions
+}
+
+// Returns the revisions of the article at page, newest first. The history is read from
+// git when the article's files have been committed, and otherwise from the revisions
+// recorded by recordHistory. The revisions are cached until the history is recorded again
+func (bh *BlogHead) revisions(page string) []revision {
+	bh.historyMu.Lock()
+	defer bh.historyMu.Unlock()
+
+	if revisions, ok := bh.revisionCache[page]; ok {
+		return revisions
+	}
+
+	revisions := bh.gitHistory(bh.articleSources(page))
+	if len(revisions) == 0 {
+		recorded := bh.recorded[page]
+		revisions = make([]revision, len(recorded))
+		for i, r := range recorded {
+			revisions[len(recorded)-1-i] = r
+		}
+	}
+	sort.SliceStable(revisions, func(i, j int) bool {
+		return revisions[i].Date.After(revisions[j].Date)
+	})
+
+	if bh.revisionCache == nil {
+		bh.revisionCache = make(map[string][]revision)
+	}
+	bh.revisionCache[page] = revisions
+	return revisions
+}
+
+// Returns the dates the article at page, with the metadata meta, was published and last
+// updated. The article was published when its first revision was made, unless its metadata
+// says otherwise, and updated when its latest revision was made, if that's later. An
+// invalid date in the metadata is treated as missing
+func (bh *BlogHead) articleDates(page string, meta map[string]interface{}) (time.Time, time.Time) {
+	updated, _ := toTime(meta["updated"])
+	published, _ := toTime(meta["published"])
+
+	revisions := bh.revisions(page)
+	if n := len(revisions); n > 0 {
+		if published.IsZero() {
+			published = revisions[n-1].Date
+		}
+		if revisions[0].Date.After(updated) {
+			updated = revisions[0].Date
+		}
+	}
+	return published, updated
+}
+
+// Determine if the page at p is one of the site's articles
+func (bh *BlogHead) isArticle(p string) bool {
+	for _, page := range bh.config.Articles {
+		if abs, err := filepath.Abs(page); err == nil && abs == p {
+			return true
+		}
+	}
+	return false
+}
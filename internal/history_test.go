@@ -0,0 +1,218 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBlogHead_recordHistory(t *testing.T) {
+	bh := makeTempSite(t)
+	page := path.Join(bh.Root, "post.md")
+	bh.config.Articles = []string{page}
+
+	write := func(text string) {
+		if err := ioutil.WriteFile(page, []byte(text), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	record := func(now time.Time) *article {
+		bh.buildTime = now
+		if err := bh.recordHistory(); err != nil {
+			t.Fatalf("recordHistory() error = %v", err)
+		}
+		return unwrap(bh.readArticle(page)).(*article)
+	}
+
+	published := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	edited := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	// The first revision is dated by the metadata
+	write("---\ntitle: Post\nupdated: 2021-01-01T00:00:00Z\n---\nFirst")
+	a := record(time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC))
+	if !a.Published.Equal(published) || !a.Updated.Equal(published) || len(a.Revisions) != 1 {
+		t.Errorf("recordHistory() published %v, updated %v with %v revision(s)", a.Published, a.Updated, len(a.Revisions))
+	}
+
+	// Changing the front matter isn't a revision
+	write("---\ntitle: Renamed\nupdated: 2021-01-01T00:00:00Z\n---\nFirst")
+	if a := record(edited); !a.Updated.Equal(published) || len(a.Revisions) != 1 {
+		t.Errorf("recordHistory() updated %v with %v revision(s), want no new revision", a.Updated, len(a.Revisions))
+	}
+
+	// Changing the content is
+	write("---\ntitle: Renamed\nupdated: 2021-01-01T00:00:00Z\n---\nSecond")
+	a = record(edited)
+	if !a.Published.Equal(published) || !a.Updated.Equal(edited) || len(a.Revisions) != 2 || !a.Revisions[0].Date.Equal(edited) {
+		t.Errorf("recordHistory() published %v, updated %v with revisions %v", a.Published, a.Updated, a.Revisions)
+	}
+
+	// The history is kept between builds
+	bh.recorded = nil
+	if history := bh.readHistory(); len(history[page]) != 2 {
+		t.Errorf("readHistory() = %v, want 2 revisions", history)
+	}
+}
+
+func TestBlogHead_revisions_git(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+
+	bh := makeTempSite(t)
+	page := path.Join(bh.Root, "post.md")
+	bh.config.Articles = []string{page}
+
+	git := func(date string, args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", bh.Root, "-c", "user.name=Ann", "-c", "user.email=ann@example.com"}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	commit := func(text, date, message string) {
+		if err := ioutil.WriteFile(page, []byte(text), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		git(date, "add", "post.md")
+		git(date, "commit", "-q", "-m", message)
+	}
+
+	git("2021-01-01T00:00:00Z", "init", "-q")
+	commit("---\ntitle: Post\n---\nFirst", "2021-01-01T00:00:00Z", "Add a post")
+	commit("---\ntitle: Post\n---\nSecond", "2021-02-01T00:00:00Z", "Fix a typo")
+
+	if err := bh.recordHistory(); err != nil {
+		t.Fatalf("recordHistory() error = %v", err)
+	}
+	a := unwrap(bh.readArticle(page)).(*article)
+
+	if want := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC); !a.Published.Equal(want) {
+		t.Errorf("readArticle() published %v, want %v", a.Published, want)
+	}
+	if want := time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC); !a.Updated.Equal(want) {
+		t.Errorf("readArticle() updated %v, want %v", a.Updated, want)
+	}
+	if len(a.Revisions) != 2 || a.Revisions[0].Message != "Fix a typo" || a.Revisions[1].Message != "Add a post" {
+		t.Errorf("readArticle() revisions = %v, want both commits", a.Revisions)
+	}
+}
+
+func TestBlogHead_Start_historyDates(t *testing.T) {
+	bh := makeTempSite(t)
+	bh.config.Domain = "example.com"
+	page := path.Join(bh.Root, "post.md")
+	bh.config.Articles = []string{page}
+
+	write := func(p, text string) {
+		if err := ioutil.WriteFile(p, []byte(text), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	build := func() {
+		if err := bh.Start(); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+	}
+
+	write(path.Join(bh.tmplDir, "post.html"), "{{ .published }}|{{ .updated }}|{{ .Page.Updated.Format \"2006\" }}")
+	write(page, "---\ntitle: Post\ntemplate: post.html\npublished: 2021-01-01T00:00:00Z\nupdated: 2021-01-01T00:00:00Z\n---\nFirst")
+	build()
+
+	// Changing the content records a revision, which updates the page and its sitemap entry
+	write(page, "---\ntitle: Post\ntemplate: post.html\npublished: 2021-01-01T00:00:00Z\nupdated: 2021-01-01T00:00:00Z\n---\nSecond")
+	build()
+
+	updated := bh.recorded[page][1].Date.Format(time.RFC3339)
+	want := "2021-01-01T00:00:00Z|" + updated + "|" + bh.recorded[page][1].Date.Format("2006")
+	if got := string(unwrap(ioutil.ReadFile(path.Join(bh.Output, "post.html"))).([]byte)); got != want {
+		t.Errorf("Start() wrote the article as %v, want %v", got, want)
+	}
+
+	urls, err := bh.sitemapURLs([]string{page}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 1 || urls[0].LastMod != updated {
+		t.Errorf("sitemapURLs() = %v, want lastmod %v", urls, updated)
+	}
+}
+
+func TestBlogHead_Start_dateOnly(t *testing.T) {
+	bh := makeTempSite(t)
+	page := path.Join(bh.Root, "post.md")
+	html := path.Join(bh.Root, "page.html")
+	bh.config.Articles = []string{page, html}
+
+	write := func(p, text string) {
+		f := unwrap(createFile(p)).(*os.File)
+		if _, err := f.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+	build := func() {
+		if err := bh.Start(); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+	}
+
+	write(path.Join(bh.tmplDir, "post.html"), `{{ .published }}|{{ .Page.Published.Format "2006-01-02" }}`)
+	write(path.Join(bh.tmplDir, ".data", "page.html", "content.html"), "Page")
+	write(path.Join(bh.Root, "all.html"), `{{ range .Articles }}{{ .Published.Format "2006-01-02" }} {{ end }}`)
+	write(html, "Page")
+	write(metaPath(html), `{"title": "Page"}`)
+	write(page, "---\ntitle: Post\ntemplate: post.html\n---\nPost")
+	build()
+
+	// The articles' dates are set after their first revision was recorded. A quoted
+	// date in front matter, and a date in a data file, are strings without a time
+	write(metaPath(html), `{"title": "Page", "published": "2024-01-03"}`)
+	write(page, "---\ntitle: Post\ntemplate: post.html\npublished: \"2024-01-02\"\n---\nPost")
+	build()
+
+	want := map[string]string{
+		"post.html": "2024-01-02T00:00:00Z|2024-01-02",
+		"all.html":  "2024-01-03 2024-01-02 ",
+	}
+	for name, text := range want {
+		if got := string(unwrap(ioutil.ReadFile(path.Join(bh.Output, name))).([]byte)); got != text {
+			t.Errorf("Start() wrote %v as %v, want %v", name, got, text)
+		}
+	}
+}
+
+func TestBlogHead_MoveArticle_history(t *testing.T) {
+	bh := makeArticleSite(t)
+	second := path.Join(bh.Root, "posts/second.md")
+	moved := path.Join(bh.Root, "notes/second.md")
+
+	info, err := os.Stat(bh.historyPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("recordHistory() wrote the history with the mode %v, want %v", info.Mode().Perm(), os.FileMode(0644))
+	}
+	revisions := bh.readHistory()[second]
+
+	// The revisions are kept when the article is moved, and removed with it
+	if _, err := bh.MoveArticleToDir("posts/second.md", "notes", false); err != nil {
+		t.Fatalf("MoveArticleToDir() error = %v", err)
+	}
+	history := bh.readHistory()
+	if _, ok := history[second]; ok || len(revisions) != 1 || !reflect.DeepEqual(history[moved], revisions) {
+		t.Errorf("MoveArticleToDir() left the history %v, want %v at %v", history, revisions, moved)
+	}
+
+	if _, err := bh.RemoveArticle("notes/second.md", false); err != nil {
+		t.Fatalf("RemoveArticle() error = %v", err)
+	}
+	if _, ok := bh.readHistory()[moved]; ok {
+		t.Errorf("RemoveArticle() didn't remove the article's history")
+	}
+}
@@ -0,0 +1,415 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The JPEG quality of resized images, unless imageQuality is set in the config
+const defaultImageQuality = 85
+
+// The key of the resize settings in the inputs of a resized image's manifest entry,
+// so that the image is written again when the settings change
+const imageSettingsKey = "image settings"
+
+// The dimensions and content hash of an image, and whether its WebP copies are written
+type imageInfo struct {
+	Config image.Config
+	Hash   string
+	WebP   bool
+}
+
+// A resized or WebP copy of an image
+type imageVariant struct {
+	Width  int
+	Height int
+	// The path of the variant in the output directory without a fingerprint,
+	// which is used as the key of its manifest entry
+	Key string
+	// The path the variant is written to
+	Output string
+}
+
+// Determine if resized copies of the image at p are written. GIFs aren't
+// resized, since they may be animated
+func (bh *BlogHead) isResizedImage(p string) bool {
+	if bh.config == nil || len(bh.config.ImageWidths) == 0 {
+		return false
+	}
+
+	switch strings.ToLower(path.Ext(p)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+// Determine if WebP copies of the image at p are written. Only PNG images are converted,
+// since a lossless copy of a JPEG photo is larger than the photo. An image isn't converted
+// if the root directory has a file with the name of its WebP copy
+func (bh *BlogHead) isWebPImage(p string) bool {
+	if bh.config == nil || !bh.config.ImageWebP || strings.ToLower(path.Ext(p)) != ".png" {
+		return false
+	}
+	return !fileExists(path.Join(bh.Root, trimExt(bh.sourcePath(p))+".webp"))
+}
+
+// Determine if resized or WebP copies of the image at p are written
+func (bh *BlogHead) hasImageVariants(p string) bool {
+	return bh.isResizedImage(p) || bh.isWebPImage(p)
+}
+
+// Returns the JPEG quality of resized images
+func (bh *BlogHead) imageQuality() int {
+	if bh.config.ImageQuality > 0 {
+		return bh.config.ImageQuality
+	}
+	return defaultImageQuality
+}
+
+// Returns the settings used to resize images, which are part of the key of a cached image
+func (bh *BlogHead) imageSettings() string {
+	return "quality=" + strconv.Itoa(bh.imageQuality())
+}
+
+// The directory which keeps each resized image between builds. It is stored
+// next to the output directory, like the manifest, so that it isn't published
+func (bh *BlogHead) imageCacheDir() string {
+	return path.Join(path.Dir(bh.Output), "."+path.Base(bh.Output)+"_images")
+}
+
+// Returns the variants of the image at p. A variant is made for each configured width
+// smaller than the image, and if the image's WebP copies are written, a WebP copy is made
+// of each of these and of the image itself
+func (bh *BlogHead) imageVariants(p string, info *imageInfo) []imageVariant {
+	width, height := info.Config.Width, info.Config.Height
+
+	widths := []int{}
+	if bh.isResizedImage(p) {
+		widths = append(widths, bh.config.ImageWidths...)
+		sort.Ints(widths)
+	}
+
+	variants := []imageVariant{}
+	add := func(w, h int, name string) {
+		variants = append(variants, imageVariant{
+			Width:  w,
+			Height: h,
+			Key:    path.Join(bh.Output, bh.sourcePath(name)),
+			Output: bh.assetPath(name, info.Hash),
+		})
+	}
+	for _, w := range widths {
+		if w <= 0 || w >= width {
+			continue
+		}
+
+		h := int(math.Round(float64(height) * float64(w) / float64(width)))
+		if h < 1 {
+			h = 1
+		}
+
+		name := trimExt(p) + "-" + strconv.Itoa(w) + "w"
+		add(w, h, name+path.Ext(p))
+		if info.WebP {
+			add(w, h, name+".webp")
+		}
+	}
+	if info.WebP {
+		add(width, height, trimExt(p)+".webp")
+	}
+	return variants
+}
+
+// Returns the dimensions and content hash of the image at p. Whether the image's WebP copies
+// are written is decided by whether the WebP copy of the image is smaller than the image. The
+// result is found once for each build and shared by the pages which use the image
+func (bh *BlogHead) imageInfo(p string) (*imageInfo, error) {
+	bh.imagesMu.Lock()
+	defer bh.imagesMu.Unlock()
+
+	if info, ok := bh.images[p]; ok {
+		return info, nil
+	}
+
+	config, hash, size, err := readImageConfig(p)
+	if err != nil {
+		return nil, err
+	}
+	info := &imageInfo{Config: config, Hash: hash}
+
+	if bh.isWebPImage(p) {
+		var src image.Image
+		b, err := bh.imageVariantContent(p, hash, imageVariant{Width: config.Width, Height: config.Height, Output: trimExt(p) + ".webp"}, &src)
+		if err != nil {
+			return nil, err
+		}
+		info.WebP = len(b) < size
+	}
+
+	if bh.images == nil {
+		bh.images = make(map[string]*imageInfo)
+	}
+	bh.images[p] = info
+	return info, nil
+}
+
+// Forgets the images read by imageInfo, so that the next build reads them again
+func (bh *BlogHead) resetImages() {
+	bh.imagesMu.Lock()
+	bh.images = nil
+	bh.imagesMu.Unlock()
+}
+
+// Reads the dimensions of the image at p, along with the hash and size of its content
+func readImageConfig(p string) (image.Config, string, int, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return image.Config{}, "", 0, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return image.Config{}, "", 0, err
+	}
+
+	sum := sha256.Sum256(b)
+	return config, hex.EncodeToString(sum[:]), len(b), nil
+}
+
+// Writes each variant of the image at p which changed since the last build, and adds
+// an entry for each variant to the next manifest. hash is the hash of the image's content
+func (bh *BlogHead) buildImageVariants(p, hash string, manifest, next *buildManifest) error {
+	info, err := bh.imageInfo(p)
+	if err != nil {
+		return err
+	}
+
+	inputs := map[string]string{p: hash, imageSettingsKey: bh.imageSettings()}
+
+	// The image is only decoded if a variant needs to be resized
+	var src image.Image
+	for _, v := range bh.imageVariants(p, info) {
+		if entry, ok := manifest.Entries[v.Key]; ok && entry.Output == v.Output && manifest.upToDate(v.Key, inputs) {
+			next.Entries[v.Key] = entry
+			continue
+		}
+
+		if err := bh.writeImageVariant(p, hash, v, &src); err != nil {
+			return err
+		}
+		next.Entries[v.Key] = &manifestEntry{v.Output, inputs}
+	}
+	return nil
+}
+
+// Writes each variant of the image at p. Returns the paths which were written
+func (bh *BlogHead) writeImageVariants(p string) ([]string, error) {
+	info, err := bh.imageInfo(p)
+	if err != nil {
+		return nil, err
+	}
+
+	written := []string{}
+	var src image.Image
+	for _, v := range bh.imageVariants(p, info) {
+		if err := bh.writeImageVariant(p, info.Hash, v, &src); err != nil {
+			return nil, err
+		}
+		written = append(written, v.Output)
+	}
+	return written, nil
+}
+
+// Writes the variant v of the image at p, with the content hash
+func (bh *BlogHead) writeImageVariant(p, hash string, v imageVariant, src *image.Image) error {
+	b, err := bh.imageVariantContent(p, hash, v, src)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(v.Output, b)
+}
+
+// Returns the content of the variant v of the image at p, with the content hash. The variant
+// is read from the image cache if it was written with the same settings before. Otherwise, the
+// image is decoded into src, if it hasn't been already, and resized or converted
+func (bh *BlogHead) imageVariantContent(p, hash string, v imageVariant, src *image.Image) ([]byte, error) {
+	// The quality doesn't change a lossless WebP copy
+	ext, settings := path.Ext(v.Output), bh.imageSettings()
+	if ext == ".webp" {
+		settings = "webp"
+	}
+	key := sha256.Sum256([]byte(fmt.Sprintf("%v %v %v", hash, v.Width, settings)))
+	cached := path.Join(bh.imageCacheDir(), hex.EncodeToString(key[:16])+ext)
+
+	b, err := ioutil.ReadFile(cached)
+	if !os.IsNotExist(err) {
+		return b, err
+	}
+
+	if *src == nil {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		*src, _, err = image.Decode(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	img := *src
+	if bounds := img.Bounds(); bounds.Dx() != v.Width || bounds.Dy() != v.Height {
+		img = resizeImage(img, v.Width, v.Height)
+	}
+	if b, err = encodeImage(img, ext, bh.imageQuality()); err != nil {
+		return nil, err
+	}
+	if err = writeFileAtomic(cached, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Writes the file at p by writing a temporary file and renaming it, so that
+// an interrupted build never leaves a partial image in the cache
+func writeFileAtomic(p string, b []byte) error {
+	f, err := createFile(p + ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(p+".tmp", p)
+}
+
+// Encodes the image in the format given by the extension
+func encodeImage(img image.Image, ext string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case ".png":
+		err = png.Encode(&buf, img)
+	case ".webp":
+		return encodeWebP(img)
+	default:
+		return nil, errors.New(fmt.Sprintf("images with the %v extension can't be resized", ext))
+	}
+	return buf.Bytes(), err
+}
+
+// Resizes the image to width by height pixels. Each pixel is the average of the
+// pixels it covers in the source image, which keeps detail when shrinking photos
+func resizeImage(src image.Image, width, height int) *image.RGBA {
+	b := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, (y+1)*sh/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, (x+1)*sw/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(row[sx*4+c])
+					}
+				}
+			}
+
+			n := (y1 - y0) * (x1 - x0)
+			i := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+
+	return dst
+}
+
+// Returns an img element for the image at name, which is relative to the root
+// directory. The srcset lists each of the image's resized variants, for the browser
+// to choose from using sizes, which is 100vw unless it is given. If the image has WebP
+// copies, the img is wrapped in a picture element with a source listing the copies.
+// The image is a dependency of the page at p
+func (bh *BlogHead) imageHTML(p, name, alt string, sizes ...string) (template.HTML, error) {
+	ref, err := bh.asset(p, name)
+	if err != nil {
+		return "", err
+	}
+
+	file := bh.assetFile(name)
+	info, err := bh.imageInfo(file)
+	if err != nil {
+		return "", errors.New(name + ": " + err.Error())
+	}
+	config := info.Config
+
+	srcset, webp := []string{}, []string{}
+	for _, v := range bh.imageVariants(file, info) {
+		src := fmt.Sprintf("%v %vw", bh.relURL(trimPath(bh.Output, v.Output)), v.Width)
+		if path.Ext(v.Output) == ".webp" {
+			webp = append(webp, src)
+		} else {
+			srcset = append(srcset, src)
+		}
+	}
+
+	size := "100vw"
+	if len(sizes) > 0 {
+		size = strings.Join(sizes, ", ")
+	}
+
+	var attrs strings.Builder
+	if len(srcset) > 0 {
+		srcset = append(srcset, fmt.Sprintf("%v %vw", ref.URL, config.Width))
+		fmt.Fprintf(&attrs, ` srcset="%v" sizes="%v"`,
+			template.HTMLEscapeString(strings.Join(srcset, ", ")), template.HTMLEscapeString(size))
+	}
+
+	img := fmt.Sprintf(`<img src="%v"%v width="%v" height="%v" alt="%v" loading="lazy">`,
+		template.HTMLEscapeString(ref.URL), attrs.String(), config.Width, config.Height, template.HTMLEscapeString(alt))
+	if len(webp) == 0 {
+		return template.HTML(img), nil
+	}
+
+	return template.HTML(fmt.Sprintf(`<picture><source type="image/webp" srcset="%v" sizes="%v">%v</picture>`,
+		template.HTMLEscapeString(strings.Join(webp, ", ")), template.HTMLEscapeString(size), img)), nil
+}
@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestBlogHead_Start_images(t *testing.T) {
+	bh := makeTempSite(t)
+	bh.config.ImageWidths = []int{200, 40}
+
+	img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	for x := 0; x < 100; x++ {
+		for y := 0; y < 50; y++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 0, 255})
+		}
+	}
+	f := unwrap(createFile(path.Join(bh.Root, "images/photo.png"))).(*os.File)
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	if err := ioutil.WriteFile(path.Join(bh.Root, "page.html"), []byte(`{{ image "images/photo.png" "A <photo>" "(min-width: 800px) 50vw" "100vw" }}`), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// Only widths smaller than the image are written
+	variant := unwrap(os.Open(path.Join(bh.Output, "images/photo-40w.png"))).(*os.File)
+	config, _, err := image.DecodeConfig(variant)
+	_ = variant.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Width != 40 || config.Height != 20 {
+		t.Errorf("Start() wrote a %vx%v image, want 40x20", config.Width, config.Height)
+	}
+	if _, err := os.Stat(path.Join(bh.Output, "images/photo-200w.png")); !os.IsNotExist(err) {
+		t.Errorf("Start() wrote an image larger than the original")
+	}
+
+	want := `<img src="/images/photo.png" srcset="/images/photo-40w.png 40w, /images/photo.png 100w" ` +
+		`sizes="(min-width: 800px) 50vw, 100vw" width="100" height="50" alt="A &lt;photo&gt;" loading="lazy">`
+	if got := string(unwrap(ioutil.ReadFile(path.Join(bh.Output, "page.html"))).([]byte)); got != want {
+		t.Errorf("Start() wrote the page %v, want %v", got, want)
+	}
+
+	// Resized images are kept in the cache between builds
+	cached := unwrap(ioutil.ReadDir(bh.imageCacheDir())).([]os.FileInfo)
+	if len(cached) != 1 {
+		t.Fatalf("Start() cached %v image(s), want 1", len(cached))
+	}
+	if err := os.RemoveAll(bh.Output); err != nil {
+		t.Fatal(err)
+	}
+	bh.Force = true
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if _, err := os.Stat(path.Join(bh.Output, "images/photo-40w.png")); err != nil {
+		t.Errorf("Start() didn't write the cached image: %v", err)
+	}
+	if after := unwrap(ioutil.ReadDir(bh.imageCacheDir())).([]os.FileInfo); len(after) != 1 || !after[0].ModTime().Equal(cached[0].ModTime()) {
+		t.Errorf("Start() resized the image again instead of using the cache")
+	}
+}
+
+func Test_resizeImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	src.Set(0, 0, color.RGBA{0, 0, 0, 255})
+	src.Set(1, 0, color.RGBA{100, 0, 0, 255})
+	src.Set(0, 1, color.RGBA{0, 200, 0, 255})
+	src.Set(1, 1, color.RGBA{100, 200, 40, 255})
+
+	got := resizeImage(src, 1, 1).RGBAAt(0, 0)
+	if want := (color.RGBA{50, 100, 10, 255}); got != want {
+		t.Errorf("resizeImage() = %v, want %v", got, want)
+	}
+}
+
+func TestBlogHead_Start_imageChanged(t *testing.T) {
+	bh := makeTempSite(t)
+	bh.config.Fingerprint = true
+
+	writeImage := func(width int) {
+		f := unwrap(createFile(path.Join(bh.Root, "p.png"))).(*os.File)
+		if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, width, 50))); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+	writeImage(100)
+
+	page := path.Join(bh.Root, "page.html")
+	if err := ioutil.WriteFile(page, []byte(`{{ image "p.png" "alt" "100vw" }}`), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	before := string(unwrap(ioutil.ReadFile(path.Join(bh.Output, "page.html"))).([]byte))
+
+	// The page is rebuilt with the image's new name and size
+	writeImage(80)
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	after := string(unwrap(ioutil.ReadFile(path.Join(bh.Output, "page.html"))).([]byte))
+	if after == before || !strings.Contains(after, `width="80"`) {
+		t.Errorf("Start() didn't rebuild the page after the image changed, got %v", after)
+	}
+
+	entry := bh.readManifest().Entries[path.Join(bh.Root, "p.png")]
+	if entry == nil || !strings.Contains(after, trimPath(bh.Output, entry.Output)) {
+		t.Errorf("Start() wrote %v, which doesn't link to the image's output %v", after, entry)
+	}
+}
+
+func TestBlogHead_Start_imagesWebP(t *testing.T) {
+	bh := makeTempSite(t)
+	bh.config.ImageWidths = []int{40}
+	bh.config.ImageWebP = true
+
+	writeImage := func(name string, pixel func(x, y int) color.RGBA) {
+		img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+		for x := 0; x < 100; x++ {
+			for y := 0; y < 50; y++ {
+				img.Set(x, y, pixel(x, y))
+			}
+		}
+		f := unwrap(createFile(path.Join(bh.Root, name))).(*os.File)
+		if err := png.Encode(f, img); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+	writeImage("photo.png", func(x, y int) color.RGBA {
+		v := uint8(math.Sin(float64(x)/7)*60 + math.Cos(float64(y)/5)*60 + 128)
+		return color.RGBA{v, v / 2, 255 - v, 255}
+	})
+	// A smooth gradient is smaller as a PNG, so it isn't converted
+	writeImage("gradient.png", func(x, y int) color.RGBA {
+		return color.RGBA{uint8(x), uint8(y), 0, 255}
+	})
+
+	if err := ioutil.WriteFile(path.Join(bh.Root, "page.html"), []byte(`{{ image "photo.png" "alt" }}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	for name, width := range map[string]int{"photo.webp": 100, "photo-40w.webp": 40} {
+		b, err := ioutil.ReadFile(path.Join(bh.Output, name))
+		if err != nil {
+			t.Fatalf("Start() didn't write %v: %v", name, err)
+		}
+		decoded, err := decodeTestWebP(b)
+		if err != nil {
+			t.Fatalf("Start() wrote %v, which can't be decoded: %v", name, err)
+		}
+		if decoded.Bounds().Dx() != width {
+			t.Errorf("Start() wrote %v %v pixels wide, want %v", name, decoded.Bounds().Dx(), width)
+		}
+	}
+
+	want := `<picture><source type="image/webp" srcset="/photo-40w.webp 40w, /photo.webp 100w" sizes="100vw">` +
+		`<img src="/photo.png" srcset="/photo-40w.png 40w, /photo.png 100w" sizes="100vw" width="100" height="50" alt="alt" loading="lazy"></picture>`
+	if got := string(unwrap(ioutil.ReadFile(path.Join(bh.Output, "page.html"))).([]byte)); got != want {
+		t.Errorf("Start() wrote the page %v, want %v", got, want)
+	}
+
+	if _, err := os.Stat(path.Join(bh.Output, "gradient.webp")); !os.IsNotExist(err) {
+		t.Errorf("Start() wrote a WebP copy which is larger than the image")
+	}
+
+	// The WebP copies are removed when they are turned off
+	bh.config.ImageWebP = false
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if _, err := os.Stat(path.Join(bh.Output, "photo.webp")); !os.IsNotExist(err) {
+		t.Errorf("Start() kept the WebP copy after imageWebP was turned off")
+	}
+}
+
+func TestBlogHead_imageInfo(t *testing.T) {
+	bh := makeTempSite(t)
+	p := path.Join(bh.Root, "p.png")
+	writeImage := func(width int) {
+		f := unwrap(createFile(p)).(*os.File)
+		if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, width, 10))); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+	writeImage(20)
+	first := unwrap(bh.imageInfo(p)).(*imageInfo)
+
+	// The image is read once for each build, however many pages use it
+	writeImage(30)
+	if got := unwrap(bh.imageInfo(p)).(*imageInfo); got != first {
+		t.Errorf("imageInfo() read the image again during the build")
+	}
+
+	bh.resetImages()
+	if got := unwrap(bh.imageInfo(p)).(*imageInfo); got.Config.Width != 30 {
+		t.Errorf("imageInfo() after resetImages() = %v pixels wide, want 30", got.Config.Width)
+	}
+}
@@ -0,0 +1,271 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The number of articles on each page of a list page when neither
+// the page nor the config sets the page size
+const defaultPageSize = 10
+
+// A list page is a page with the metadata "type": "list". Its template is executed
+// once for each page of the site's articles, with the articles of the page available
+// as .pagination. The first page is written to the page's output path, and the following
+// pages are written to page/2/index.html, page/3/index.html and so on, in the directory of
+// the page if it is an index.html, otherwise in a directory with the name of the page.
+// The metadata "pageSize" sets the number of articles per page, and "sort" sets their
+// order, which is one of "newest" (the default), "oldest" or "title"
+func isListPage(meta map[string]interface{}) bool {
+	return metaString(meta, "type") == "list"
+}
+
+// The articles shown on one page of a list page, and the links to the other pages
+type pagination struct {
+	// The number of this page, starting from 1
+	Page int
+	// The number of pages
+	Pages int
+	// The number of articles on each page
+	PageSize int
+	// The number of articles on all pages
+	Total int
+	// The articles on this page
+	Articles []*article
+
+	// The URLs of this page, the first and last pages, and the previous and
+	// next pages. Prev and Next are empty on the first and last pages
+	Link  string
+	First string
+	Last  string
+	Prev  string
+	Next  string
+}
+
+// Compiles and writes each page of the list page at p. Pages left over from
+// a previous build which listed more articles are removed
+func (bh *BlogHead) compileAndWriteList(p string, meta map[string]interface{}) error {
+	files, err := bh.feedFiles()
+	if err != nil {
+		return err
+	}
+	// The list is written again when any of the articles change
+	bh.saveDependencies(p, files...)
+
+	articles, err := bh.siteArticles()
+	if err != nil {
+		return err
+	}
+
+	size, err := bh.listPageSize(meta)
+	if err != nil {
+		return err
+	}
+
+	if err := sortArticles(articles, metaString(meta, "sort")); err != nil {
+		return err
+	}
+
+	pages := paginate(articles, size)
+	written := []string{}
+	for i, pg := range pages {
+		pg.Link = bh.listPageURL(p, i+1)
+		pg.First = bh.listPageURL(p, 1)
+		pg.Last = bh.listPageURL(p, len(pages))
+		if i > 0 {
+			pg.Prev = bh.listPageURL(p, i)
+		}
+		if i < len(pages)-1 {
+			pg.Next = bh.listPageURL(p, i+2)
+		}
+
+		b, err := bh.compilePage(p, pg)
+		if err != nil {
+			return err
+		}
+
+		out, err := createFile(bh.listPagePath(p, i+1))
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(bh.minifyPage(b))
+		_ = out.Close()
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			written = append(written, bh.listPagePath(p, i+1))
+		}
+	}
+
+	return removeOutputs(bh.setListPages(p, written))
+}
+
+// Returns the number of articles on each page of the list page with the metadata
+func (bh *BlogHead) listPageSize(meta map[string]interface{}) (int, error) {
+	size := defaultPageSize
+	if bh.config.PageSize > 0 {
+		size = bh.config.PageSize
+	}
+
+	switch val := meta["pageSize"].(type) {
+	case nil:
+	case float64:
+		size = int(val)
+	case int:
+		size = val
+	case int64:
+		size = int(val)
+	case string:
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return 0, errors.New("pageSize must be a number: " + err.Error())
+		}
+		size = n
+	default:
+		return 0, errors.New(fmt.Sprintf("pageSize must be a number, got %v", val))
+	}
+
+	if size < 1 {
+		return 0, errors.New(fmt.Sprintf("pageSize must be at least 1, got %v", size))
+	}
+	return size, nil
+}
+
+// Sorts the articles in the order named by order
+func sortArticles(articles []*article, order string) error {
+	switch order {
+	case "", "newest":
+		sort.SliceStable(articles, func(i, j int) bool {
+			return articles[i].Date().After(articles[j].Date())
+		})
+	case "oldest":
+		sort.SliceStable(articles, func(i, j int) bool {
+			return articles[i].Date().Before(articles[j].Date())
+		})
+	case "title":
+		sort.SliceStable(articles, func(i, j int) bool {
+			return strings.ToLower(articles[i].Title) < strings.ToLower(articles[j].Title)
+		})
+	default:
+		return errors.New(fmt.Sprintf("Unknown sort order %v. Valid orders are newest, oldest and title", order))
+	}
+	return nil
+}
+
+// Splits the articles into pages of size articles. There is always at least one page,
+// so that a list page is still written when the site doesn't have any articles
+func paginate(articles []*article, size int) []*pagination {
+	count := (len(articles) + size - 1) / size
+	if count == 0 {
+		count = 1
+	}
+
+	pages := make([]*pagination, count)
+	for i := range pages {
+		start, end := i*size, (i+1)*size
+		if end > len(articles) {
+			end = len(articles)
+		}
+
+		pages[i] = &pagination{
+			Page:     i + 1,
+			Pages:    count,
+			PageSize: size,
+			Total:    len(articles),
+			Articles: articles[start:end],
+		}
+	}
+	return pages
+}
+
+// Returns the directory which contains the pages after the first page of the
+// list page written to out. The directory of an index.html is used, otherwise
+// the pages are in a directory with the name of the page
+func listPageDir(out string) string {
+	if path.Base(out) == "index.html" {
+		return path.Dir(out)
+	}
+	return trimExt(out)
+}
+
+// Returns the output path of page n of the list page at p
+func (bh *BlogHead) listPagePath(p string, n int) string {
+	out := bh.outputPath(p)
+	if n == 1 {
+		return out
+	}
+	return path.Join(listPageDir(out), "page", strconv.Itoa(n), "index.html")
+}
+
+// Returns the URL of page n of the list page at p
+func (bh *BlogHead) listPageURL(p string, n int) string {
+	return bh.outputURL(bh.listPagePath(p, n))
+}
+
+// Records the outputs of the second and later pages of the list page at p, or
+// forgets them if outputs is nil. Returns the previously recorded outputs which
+// are no longer used, so that only pages written by the list page are removed
+func (bh *BlogHead) setListPages(p string, outputs []string) []string {
+	bh.listPagesMu.Lock()
+	defer bh.listPagesMu.Unlock()
+
+	used := make(map[string]bool)
+	for _, out := range outputs {
+		used[out] = true
+	}
+	stale := []string{}
+	for _, out := range bh.listPages[p] {
+		if !used[out] {
+			stale = append(stale, out)
+		}
+	}
+
+	if outputs == nil {
+		delete(bh.listPages, p)
+	} else if bh.listPages == nil {
+		bh.listPages = map[string][]string{p: outputs}
+	} else {
+		bh.listPages[p] = outputs
+	}
+	return stale
+}
+
+// Returns the recorded outputs of the second and later pages of the list page at p
+func (bh *BlogHead) listPageOutputs(p string) []string {
+	bh.listPagesMu.Lock()
+	defer bh.listPagesMu.Unlock()
+	return bh.listPages[p]
+}
+
+// Returns the recorded pages of each list page which is in entries
+func (bh *BlogHead) recordedListPages(entries map[string]*manifestEntry) map[string][]string {
+	bh.listPagesMu.Lock()
+	defer bh.listPagesMu.Unlock()
+
+	recorded := make(map[string][]string)
+	for p, outputs := range bh.listPages {
+		if _, ok := entries[p]; ok {
+			recorded[p] = outputs
+		}
+	}
+	return recorded
+}
+
+// Removes each of the outputs of a list page, along with the page's
+// directory if it is empty
+func removeOutputs(outputs []string) error {
+	for _, out := range outputs {
+		if err := os.Remove(out); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		// The directory is only removed if it is empty
+		_ = os.Remove(path.Dir(out))
+	}
+	return nil
+}
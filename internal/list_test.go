@@ -0,0 +1,276 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_paginate(t *testing.T) {
+	a, b, c := &article{Title: "a"}, &article{Title: "b"}, &article{Title: "c"}
+	tests := []struct {
+		name     string
+		articles []*article
+		size     int
+		want     [][]*article
+	}{
+		{
+			name:     "No articles",
+			articles: []*article{},
+			size:     2,
+			want:     [][]*article{{}},
+		},
+		{
+			name:     "Full pages",
+			articles: []*article{a, b},
+			size:     1,
+			want:     [][]*article{{a}, {b}},
+		},
+		{
+			name:     "Last page is partial",
+			articles: []*article{a, b, c},
+			size:     2,
+			want:     [][]*article{{a, b}, {c}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := paginate(tt.articles, tt.size)
+			if len(got) != len(tt.want) {
+				t.Fatalf("paginate() returned %v pages, want %v", len(got), len(tt.want))
+			}
+			for i, pg := range got {
+				if pg.Page != i+1 || pg.Pages != len(tt.want) || pg.Total != len(tt.articles) {
+					t.Errorf("paginate() page %v = %+v", i+1, pg)
+				}
+				if !reflect.DeepEqual(pg.Articles, tt.want[i]) {
+					t.Errorf("paginate() page %v articles = %v, want %v", i+1, pg.Articles, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_sortArticles(t *testing.T) {
+	older := &article{Title: "b", Published: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	newer := &article{Title: "a", Published: time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)}
+	tests := []struct {
+		name    string
+		order   string
+		want    []*article
+		wantErr bool
+	}{
+		{
+			name:  "Newest first by default",
+			order: "",
+			want:  []*article{newer, older},
+		},
+		{
+			name:  "Oldest first",
+			order: "oldest",
+			want:  []*article{older, newer},
+		},
+		{
+			name:  "By title",
+			order: "title",
+			want:  []*article{newer, older},
+		},
+		{
+			name:    "Unknown order",
+			order:   "random",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			articles := []*article{older, newer}
+			err := sortArticles(articles, tt.order)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("sortArticles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(articles, tt.want) {
+				t.Errorf("sortArticles() = %v, want %v", articles, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlogHead_listPageURL(t *testing.T) {
+	bh := &BlogHead{Root: "/site", Output: "/www", config: &BlogConfig{Domain: "example.com"}}
+	tests := []struct {
+		name string
+		p    string
+		n    int
+		path string
+		url  string
+	}{
+		{
+			name: "First page of an index",
+			p:    "/site/index.html",
+			n:    1,
+			path: "/www/index.html",
+			url:  "https://example.com/",
+		},
+		{
+			name: "Later page of an index",
+			p:    "/site/blog/index.html",
+			n:    2,
+			path: "/www/blog/page/2/index.html",
+			url:  "https://example.com/blog/page/2/",
+		},
+		{
+			name: "Later page of a named page",
+			p:    "/site/archive.md",
+			n:    3,
+			path: "/www/archive/page/3/index.html",
+			url:  "https://example.com/archive/page/3/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bh.listPagePath(tt.p, tt.n); got != tt.path {
+				t.Errorf("listPagePath() = %v, want %v", got, tt.path)
+			}
+			if got := bh.listPageURL(tt.p, tt.n); got != tt.url {
+				t.Errorf("listPageURL() = %v, want %v", got, tt.url)
+			}
+		})
+	}
+}
+
+func TestBlogHead_compileAndWriteList(t *testing.T) {
+	bh := makeTempSite(t)
+	bh.config.Domain = "example.com"
+
+	for i, title := range []string{"One", "Two", "Three"} {
+		p := path.Join(bh.Root, title+".md")
+		text := "---\ntitle: " + title + "\npublished: 2021-0" + string(rune('1'+i)) + "-01T00:00:00Z\n---\n" + title
+		if err := ioutil.WriteFile(p, []byte(text), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		bh.config.Articles = append(bh.config.Articles, p)
+	}
+
+	index := path.Join(bh.Root, "index.html")
+	if err := ioutil.WriteFile(index, []byte("{{ .pagination.Page }}/{{ .pagination.Pages }}:"+
+		"{{ range .pagination.Articles }} {{ .Title }}{{ end }} [{{ .pagination.Prev }}|{{ .pagination.Next }}]"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(metaPath(index), []byte(`{"type": "list", "pageSize": 2}`), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	// A page left over from a build with more articles
+	stale := path.Join(bh.Output, "page", "3", "index.html")
+	f := unwrap(createFile(stale)).(*os.File)
+	_ = f.Close()
+	bh.setListPages(index, []string{path.Join(bh.Output, "page", "2", "index.html"), stale})
+
+	if err := bh.compileAndWriteHTML(index); err != nil {
+		t.Fatalf("compileAndWriteHTML() error = %v", err)
+	}
+
+	read := func(p string) string {
+		return string(unwrap(ioutil.ReadFile(path.Join(bh.Output, p))).([]byte))
+	}
+
+	if got, want := read("index.html"), "1/2: Three Two [|https://example.com/page/2/]"; got != want {
+		t.Errorf("index.html = %v, want %v", got, want)
+	}
+	if got, want := read("page/2/index.html"), "2/2: One [https://example.com/|]"; got != want {
+		t.Errorf("page/2/index.html = %v, want %v", got, want)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("Expected %v to be removed", stale)
+	}
+}
+
+func TestBlogHead_Start_concurrentLists(t *testing.T) {
+	bh := makeTempSite(t)
+	bh.Jobs = 4
+
+	write := func(name, text string) {
+		f := unwrap(createFile(path.Join(bh.Root, name))).(*os.File)
+		if _, err := f.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+
+	for i, title := range []string{"A", "B", "C"} {
+		name := title + ".html"
+		date := time.Date(2021, time.Month(i+1), 1, 0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+		write(name, "<h1>"+title+"</h1>")
+		write(title+"_meta.json", `{"title": "`+title+`", "published": "`+date+`"}`)
+		write(path.Join(".templates/.data", name, "content.html"), "Content "+title)
+		bh.config.Articles = append(bh.config.Articles, path.Join(bh.Root, name))
+	}
+
+	// Each list sorts its own copy of the articles, and doesn't change the order of the others
+	list := "{{ range .pagination.Articles }}{{ .Title }}={{ .Content }} {{ end }}"
+	write("newest.html", list)
+	write("newest_meta.json", `{"type": "list"}`)
+	write("oldest.html", list)
+	write("oldest_meta.json", `{"type": "list", "sort": "oldest"}`)
+	write("all.html", "{{ range .Articles }}{{ .Title }} {{ end }}")
+
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	want := map[string]string{
+		"newest.html": "C=Content C B=Content B A=Content A ",
+		"oldest.html": "A=Content A B=Content B C=Content C ",
+		"all.html":    "C B A ",
+	}
+	for name, text := range want {
+		if got := string(unwrap(ioutil.ReadFile(path.Join(bh.Output, name))).([]byte)); got != text {
+			t.Errorf("%v = %v, want %v", name, got, text)
+		}
+	}
+}
+
+func TestBlogHead_Start_removeListPages(t *testing.T) {
+	bh := makeTempSite(t)
+
+	write := func(name, text string) {
+		f := unwrap(createFile(path.Join(bh.Root, name))).(*os.File)
+		if _, err := f.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+	for _, title := range []string{"A", "B"} {
+		write(title+".md", "---\ntitle: "+title+"\n---\n"+title)
+		bh.config.Articles = append(bh.config.Articles, path.Join(bh.Root, title+".md"))
+	}
+	write("blog.html", "{{ .pagination.Page }}")
+	write("blog_meta.json", `{"type": "list", "pageSize": 1}`)
+	// A page which is at the path of a page of about.html, if it were a list page
+	write("about/page/2/index.html", "Not a list page")
+
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// Only the outputs written by a list page are removed with it
+	for _, name := range []string{"about.html", "blog.html", "blog_meta.json"} {
+		if err := os.Remove(path.Join(bh.Root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	if _, err := os.Stat(path.Join(bh.Output, "about", "page", "2", "index.html")); err != nil {
+		t.Errorf("Expected the output of another page to be kept, got %v", err)
+	}
+	if _, err := os.Stat(path.Join(bh.Output, "blog", "page", "2", "index.html")); !os.IsNotExist(err) {
+		t.Errorf("Expected the pages of a removed list page to be deleted, got %v", err)
+	}
+}
@@ -0,0 +1,302 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// The build manifest records the inputs of every file written by the previous
+// build, along with a hash of each input's content. On the next build, only the
+// files with inputs that have changed need to be written again
+type buildManifest struct {
+	Root   string `json:"root"`
+	Output string `json:"output"`
+	// Whether the pages were minified. Every page is built again if this changes
+	Minify bool `json:"minify"`
+	// The articles which weren't built. Every page is built again if this changes,
+	// since the feeds, listings and any page using .Articles may include them
+	Hidden []string `json:"hidden"`
+
+	// Entries are keyed by the source page or, for generated files such
+	// as feed.xml, by the path of the output file
+	Entries map[string]*manifestEntry `json:"entries"`
+	// The outputs of the second and later pages of each list page, keyed by the list page.
+	// Only these are removed when a list page has fewer pages, or is removed
+	ListPages map[string][]string `json:"listPages,omitempty"`
+}
+
+type manifestEntry struct {
+	Output string            `json:"output"`
+	Inputs map[string]string `json:"inputs"`
+}
+
+// The manifest is stored next to the output directory so that it isn't published
+func (bh *BlogHead) manifestPath() string {
+	return path.Join(path.Dir(bh.Output), "."+path.Base(bh.Output)+"_manifest.json")
+}
+
+func (bh *BlogHead) newManifest() *buildManifest {
+	return &buildManifest{
+		Root:      bh.Root,
+		Output:    bh.Output,
+		Minify:    bh.minify(),
+		Hidden:    bh.hidden,
+		Entries:   make(map[string]*manifestEntry),
+		ListPages: make(map[string][]string),
+	}
+}
+
+// Read the manifest of the previous build. If the manifest doesn't exist, can't be
+// read, or was created for a different site or with different minification, an empty
+// manifest is returned so that every file is built. An empty manifest is also returned if bh.Force is set.
+// If different articles were hidden, every file is built, since any page may list the articles
+func (bh *BlogHead) readManifest() *buildManifest {
+	if bh.Force {
+		return bh.newManifest()
+	}
+
+	b, err := ioutil.ReadFile(bh.manifestPath())
+	if err != nil {
+		return bh.newManifest()
+	}
+
+	m := &buildManifest{}
+	if err := json.Unmarshal(b, m); err != nil || m.Root != bh.Root || m.Output != bh.Output || m.Entries == nil || m.Minify != bh.minify() {
+		return bh.newManifest()
+	}
+
+	if m.ListPages == nil {
+		m.ListPages = make(map[string][]string)
+	}
+
+	// The previous entries are kept, without their inputs, so that
+	// the output of articles which are now hidden is removed
+	if strings.Join(m.Hidden, "\n") != strings.Join(bh.hidden, "\n") {
+		for _, entry := range m.Entries {
+			entry.Inputs = nil
+		}
+	}
+
+	return m
+}
+
+func (bh *BlogHead) writeManifest(m *buildManifest) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	f, err := createFile(bh.manifestPath())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(b); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Determine if the entry for key was written with the same inputs
+// and the output file still exists
+func (m *buildManifest) upToDate(key string, inputs map[string]string) bool {
+	entry, ok := m.Entries[key]
+	if !ok || len(entry.Inputs) != len(inputs) {
+		return false
+	}
+
+	for p, hash := range inputs {
+		if entry.Inputs[p] != hash {
+			return false
+		}
+	}
+
+	_, err := os.Stat(entry.Output)
+	return err == nil
+}
+
+// Remove the output of each entry in the previous manifest m which is not in the
+// next manifest, or which has a new output, such as a fingerprinted asset which
+// changed. Only files within the output directory are removed
+func (bh *BlogHead) removeStaleOutput(m, next *buildManifest) error {
+	// An output can move between entries, such as when a file in the
+	// root directory starts or stops overriding one of the theme's assets
+	used := make(map[string]bool)
+	for _, entry := range next.Entries {
+		used[entry.Output] = true
+	}
+
+	for key, entry := range m.Entries {
+		if n, ok := next.Entries[key]; ok && n.Output == entry.Output {
+			continue
+		}
+		if used[entry.Output] {
+			continue
+		}
+
+		if trimPath(bh.Output+"/", entry.Output) == entry.Output {
+			continue
+		}
+
+		if err := os.Remove(entry.Output); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// The pages of a list page which are no longer written
+	for p, outputs := range m.ListPages {
+		current := make(map[string]bool)
+		for _, out := range next.ListPages[p] {
+			current[out] = true
+		}
+
+		stale := []string{}
+		for _, out := range outputs {
+			if !current[out] && !used[out] && trimPath(bh.Output+"/", out) != out {
+				stale = append(stale, out)
+			}
+		}
+		if err := removeOutputs(stale); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Hashes the page, its data file, and each template, asset and file read by the page. A list
+// page also uses the inputs of the feed, since it lists the site's articles.
+// The page's dependencies are saved as they are found
+func (bh *BlogHead) pageInputs(p string) (map[string]string, error) {
+	files := []string{p}
+
+	meta, err := getTemplateData(p)
+	if err != nil {
+		return nil, err
+	}
+
+	templates, err := bh.pageTemplates(p, meta)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, templates...)
+
+	// The assets used by the page, and the configuration, which sets whether they are
+	// fingerprinted. The markdown body isn't a template, so only its templates are checked
+	parsed := templates
+	if !isMarkdown(p) {
+		parsed = append([]string{p}, templates...)
+	}
+	assets, err := bh.templateAssets(parsed)
+	if err != nil {
+		return nil, err
+	}
+	if len(assets) > 0 && bh.configFile != "" {
+		assets = append(assets, bh.configFile)
+	}
+	read, err := bh.templateReadFiles(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isMarkdown(p) {
+		if _, err := os.Stat(metaPath(p)); err == nil {
+			files = append(files, metaPath(p))
+		}
+	}
+
+	// A list page uses the same files as the feed
+	if isListPage(meta) {
+		articles, err := bh.feedFiles()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, articles...)
+	}
+
+	// The files used by the page's .Site, .Data and .Articles. The markdown
+	// body isn't a template, so only a markdown page's templates are checked
+	used := files
+	if isMarkdown(p) {
+		used = files[1:]
+	}
+	inputs, dirs, err := bh.contextFiles(used)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, inputs...)
+	files = append(files, assets...)
+	files = append(files, read...)
+
+	bh.saveDependencies(p, files[1:]...)
+	bh.saveDependencies(p, dirs...)
+
+	return hashFiles(files...)
+}
+
+// Hashes each of the inputs used to write feed.xml
+func (bh *BlogHead) feedInputs() (map[string]string, error) {
+	files, err := bh.feedFiles()
+	if err != nil {
+		return nil, err
+	}
+	return hashFiles(files...)
+}
+
+// Returns the configuration file and the files of each article, which
+// are all of the inputs used to write feed.xml. For an HTML article, these are
+// the page, its data file, its content.html and each template used by content.html
+func (bh *BlogHead) feedFiles() ([]string, error) {
+	files := []string{}
+	if bh.configFile != "" {
+		files = append(files, bh.configFile)
+	}
+
+	for _, page := range bh.config.Articles {
+		abs, err := filepath.Abs(page)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, abs)
+		if isMarkdown(abs) {
+			continue
+		}
+
+		content := path.Join(bh.tmplDir, ".data", path.Base(abs), "content.html")
+		templates, err := bh.gatherTemplates(content)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, metaPath(abs), content)
+		files = append(files, templates...)
+	}
+
+	return files, nil
+}
+
+// Returns the sha256 hash of each file, keyed by the file's path
+func hashFiles(files ...string) (map[string]string, error) {
+	hashes := make(map[string]string)
+	for _, p := range files {
+		if _, ok := hashes[p]; ok {
+			continue
+		}
+
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+
+		sum := sha256.Sum256(b)
+		hashes[p] = hex.EncodeToString(sum[:])
+	}
+	return hashes, nil
+}
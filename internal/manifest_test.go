@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// Creates a site in a temporary directory with a template and two pages
+func makeTempSite(t *testing.T) *BlogHead {
+	dir := unwrap(ioutil.TempDir("", "bloghead_site")).(string)
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	root := path.Join(dir, "html")
+	files := map[string]string{
+		".templates/head.html": "<head>{{ .title }}</head>",
+		"index.html":           "{{ template \"head.html\" . }}<h1>Index</h1>",
+		"index_meta.json":      "{\"title\": \"Index\"}",
+		"about.html":           "<h1>About</h1>",
+	}
+	for name, text := range files {
+		f := unwrap(createFile(path.Join(root, name))).(*os.File)
+		if _, err := f.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+
+	return &BlogHead{
+		Root:      root,
+		Output:    path.Join(dir, "www"),
+		tmplDir:   path.Join(root, ".templates") + "/",
+		config:    &BlogConfig{Blueprints: make(map[string]string)},
+		templates: make(map[string][]string),
+	}
+}
+
+func TestBlogHead_Start_incremental(t *testing.T) {
+	bh := makeTempSite(t)
+
+	build := func() int {
+		if err := bh.Start(); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+		return len(bh.Stats().PageTimes)
+	}
+
+	if got := build(); got != 2 {
+		t.Errorf("First build compiled %v pages, want 2", got)
+	}
+
+	if got := build(); got != 0 {
+		t.Errorf("Build without changes compiled %v pages, want 0", got)
+	}
+
+	// Changing a template rebuilds the pages which use it
+	if err := ioutil.WriteFile(path.Join(bh.tmplDir, "head.html"), []byte("<head></head>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := build(); got != 1 {
+		t.Errorf("Build after changing a template compiled %v pages, want 1", got)
+	}
+
+	// Changing a page's data rebuilds the page
+	if err := ioutil.WriteFile(path.Join(bh.Root, "index_meta.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := build(); got != 1 {
+		t.Errorf("Build after changing a data file compiled %v pages, want 1", got)
+	}
+
+	// Removed output is written again
+	if err := os.Remove(path.Join(bh.Output, "about.html")); err != nil {
+		t.Fatal(err)
+	}
+	if got := build(); got != 1 {
+		t.Errorf("Build after removing output compiled %v pages, want 1", got)
+	}
+
+	// Removing a page removes its output
+	if err := os.Remove(path.Join(bh.Root, "about.html")); err != nil {
+		t.Fatal(err)
+	}
+	build()
+	if _, err := os.Stat(path.Join(bh.Output, "about.html")); !os.IsNotExist(err) {
+		t.Errorf("Expected the output of a removed page to be deleted, got %v", err)
+	}
+
+	// Forcing a build compiles every page
+	bh.Force = true
+	if got := build(); got != 1 {
+		t.Errorf("Forced build compiled %v pages, want 1", got)
+	}
+}
@@ -0,0 +1,276 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/pelletier/go-toml"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+	"gopkg.in/yaml.v2"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+)
+
+// The markdown renderer used for all markdown pages. Supports GitHub flavored
+// markdown (tables, strikethrough, autolinks, task lists) and footnotes. Raw HTML
+// is passed through, since the author of the site is also the author of the markdown
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM, extension.Footnote),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	goldmark.WithRendererOptions(html.WithUnsafe()),
+)
+
+// Front matter delimiters. YAML front matter is enclosed in '---' lines
+// and TOML front matter is enclosed in '+++' lines
+const (
+	yamlDelim = "---"
+	tomlDelim = "+++"
+)
+
+// Determine if the file at the path p is a markdown file
+func isMarkdown(p string) bool {
+	ext := path.Ext(p)
+	return ext == ".md" || ext == ".markdown"
+}
+
+// Compiles a markdown page. The markdown body is rendered to HTML and made
+// available to the page's layout as .content, along with each front matter key.
+// The layout is set by the front matter's 'layout' or 'template' key. If the front
+// matter doesn't specify a layout, the rendered HTML is returned as is.
+// The pagination of a list page is available as .pagination
+func (bh *BlogHead) compileMarkdown(p string, pg *pagination) ([]byte, error) {
+	meta, content, err := readMarkdown(p)
+	if err != nil {
+		return nil, err
+	}
+
+	name := pageLayout(p, meta)
+	if name == "" {
+		return content, nil
+	}
+
+	// The page's layout and its dependencies are the dependencies of the page
+	templates, err := bh.pageTemplates(p, meta)
+	if err != nil {
+		return nil, errors.New(p + ": " + err.Error())
+	}
+
+	bh.saveDependencies(p, templates...)
+
+	inputs, dirs, err := bh.contextFiles(templates)
+	if err != nil {
+		return nil, err
+	}
+	bh.saveDependencies(p, append(inputs, dirs...)...)
+
+	data, err := bh.templateContext(p, meta, templates)
+	if err != nil {
+		return nil, err
+	}
+	data["content"] = template.HTML(content)
+	if pg != nil {
+		data["pagination"] = pg
+	}
+
+	return bh.execute(p, "", name, templates, data)
+}
+
+// Returns the path of the named template in the templates directory, or the
+// theme's, followed by the paths of each template it uses
+func (bh *BlogHead) layoutTemplates(name string) ([]string, error) {
+	layout := bh.templatePath(name)
+	if _, err := os.Stat(layout); err != nil {
+		return nil, errors.New(fmt.Sprintf("template %v could not be found: %v", name, err))
+	}
+
+	templates, err := bh.gatherTemplates(layout)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]string{layout}, templates...), nil
+}
+
+// Reads only the front matter of the markdown file at p
+func readFrontMatter(p string) (map[string]interface{}, error) {
+	text, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, _, err := splitFrontMatter(text)
+	if err != nil {
+		return nil, errors.New(p + ": " + err.Error())
+	}
+
+	return meta, nil
+}
+
+// Reads the markdown file at p and returns its front matter and the rendered HTML body
+func readMarkdown(p string) (map[string]interface{}, []byte, error) {
+	text, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	meta, body, err := splitFrontMatter(text)
+	if err != nil {
+		return nil, nil, errors.New(p + ": " + err.Error())
+	}
+
+	content, err := renderMarkdown(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return meta, content, nil
+}
+
+// Renders the markdown source to HTML
+func renderMarkdown(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert(src, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Separates the front matter from the body of a markdown file. The front matter
+// must start on the first line of the file. If there is no front matter, an
+// empty map is returned along with the original text
+func splitFrontMatter(text []byte) (map[string]interface{}, []byte, error) {
+	meta := make(map[string]interface{})
+
+	var delim string
+	switch {
+	case bytes.HasPrefix(text, []byte(yamlDelim)):
+		delim = yamlDelim
+	case bytes.HasPrefix(text, []byte(tomlDelim)):
+		delim = tomlDelim
+	default:
+		return meta, text, nil
+	}
+
+	// The opening delimiter must be on a line of its own
+	rest := text[len(delim):]
+	nl := bytes.IndexByte(rest, '\n')
+	if nl == -1 || len(bytes.TrimSpace(rest[:nl])) != 0 {
+		return meta, text, nil
+	}
+	rest = rest[nl+1:]
+
+	// Find the closing delimiter
+	for offset := 0; offset < len(rest); {
+		end := bytes.IndexByte(rest[offset:], '\n')
+		if end == -1 {
+			end = len(rest) - offset
+		}
+
+		if string(bytes.TrimSpace(rest[offset:offset+end])) == delim {
+			header := rest[:offset]
+			body := []byte{}
+			if offset+end+1 < len(rest) {
+				body = rest[offset+end+1:]
+			}
+
+			if err := parseFrontMatter(header, delim, meta); err != nil {
+				return nil, nil, err
+			}
+			return meta, body, nil
+		}
+
+		offset += end + 1
+	}
+
+	return nil, nil, errors.New("front matter is missing the closing " + delim + " delimiter")
+}
+
+// Parses the front matter header into the meta map using the format
+// which corresponds to the delimiter
+func parseFrontMatter(header []byte, delim string, meta map[string]interface{}) error {
+	switch delim {
+	case yamlDelim:
+		values := make(map[string]interface{})
+		if err := yaml.Unmarshal(header, &values); err != nil {
+			return err
+		}
+		for k, v := range values {
+			meta[k] = normalizeValue(v)
+		}
+	case tomlDelim:
+		tree, err := toml.LoadBytes(header)
+		if err != nil {
+			return err
+		}
+		for k, v := range tree.ToMap() {
+			meta[k] = normalizeValue(v)
+		}
+	}
+	return nil
+}
+
+// Converts values decoded from YAML or TOML so that they are consistent with
+// values decoded from a _meta.json file: maps use string keys and dates are
+// formatted as RFC3339 strings
+func normalizeValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{})
+		for k, v := range val {
+			m[fmt.Sprint(k)] = normalizeValue(v)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{})
+		for k, v := range val {
+			m[k] = normalizeValue(v)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(val))
+		for i, v := range val {
+			l[i] = normalizeValue(v)
+		}
+		return l
+	case time.Time:
+		return val.Format(time.RFC3339)
+	default:
+		return v
+	}
+}
+
+// Writes the metadata as front matter in the given format, either yaml or toml.
+// meta must be a struct value, since toml can only marshal structs
+func marshalFrontMatter(meta interface{}, format string) ([]byte, error) {
+	var (
+		delim string
+		b     []byte
+		err   error
+	)
+
+	switch format {
+	case "", "yaml":
+		delim = yamlDelim
+		b, err = yaml.Marshal(meta)
+	case "toml":
+		delim = tomlDelim
+		b, err = toml.Marshal(meta)
+	default:
+		return nil, errors.New("Unknown front matter format " + format + ". Valid formats are yaml and toml")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(delim + "\n")
+	buf.Write(b)
+	buf.WriteString(delim + "\n")
+	return buf.Bytes(), nil
+}
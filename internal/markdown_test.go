@@ -0,0 +1,179 @@
+package internal
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_splitFrontMatter(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		wantMeta map[string]interface{}
+		wantBody string
+		wantErr  bool
+	}{
+		{
+			name:     "Text without front matter is returned as is",
+			text:     "# Hello\n",
+			wantMeta: map[string]interface{}{},
+			wantBody: "# Hello\n",
+		},
+		{
+			name:     "YAML front matter",
+			text:     "---\ntitle: Hello\ntags:\n  - a\n  - b\n---\n# Hello\n",
+			wantMeta: map[string]interface{}{"title": "Hello", "tags": []interface{}{"a", "b"}},
+			wantBody: "# Hello\n",
+		},
+		{
+			name:     "TOML front matter",
+			text:     "+++\ntitle = \"Hello\"\nupdated = 2021-01-02T15:04:05Z\n+++\n# Hello\n",
+			wantMeta: map[string]interface{}{"title": "Hello", "updated": "2021-01-02T15:04:05Z"},
+			wantBody: "# Hello\n",
+		},
+		{
+			name:     "Empty front matter and body",
+			text:     "---\n---",
+			wantMeta: map[string]interface{}{},
+			wantBody: "",
+		},
+		{
+			name:     "A horizontal rule is not front matter",
+			text:     "--- not front matter\n",
+			wantMeta: map[string]interface{}{},
+			wantBody: "--- not front matter\n",
+		},
+		{
+			name:    "Unclosed front matter",
+			text:    "---\ntitle: Hello\n# Hello\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, body, err := splitFrontMatter([]byte(tt.text))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("splitFrontMatter() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(meta, tt.wantMeta) {
+				t.Errorf("splitFrontMatter() meta = %v, want %v", meta, tt.wantMeta)
+			}
+			if string(body) != tt.wantBody {
+				t.Errorf("splitFrontMatter() body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func Test_renderMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "Headings have ids",
+			src:  "# Hello World\n",
+			want: []string{`<h1 id="hello-world">Hello World</h1>`},
+		},
+		{
+			name: "Fenced code blocks",
+			src:  "```go\nfmt.Println()\n```\n",
+			want: []string{`<pre><code class="language-go">fmt.Println()`},
+		},
+		{
+			name: "Tables",
+			src:  "| a | b |\n|---|---|\n| 1 | 2 |\n",
+			want: []string{"<table>", "<th>a</th>", "<td>2</td>"},
+		},
+		{
+			name: "Footnotes",
+			src:  "Text[^1]\n\n[^1]: A note\n",
+			want: []string{`<sup id="fnref:1">`, `<div class="footnotes" role="doc-endnotes">`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderMarkdown([]byte(tt.src))
+			if err != nil {
+				t.Errorf("renderMarkdown() error = %v", err)
+				return
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(got), want) {
+					t.Errorf("renderMarkdown() = %s, want it to contain %s", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBlogHead_compileMarkdown(t *testing.T) {
+	cwd := unwrap(os.Getwd()).(string)
+
+	tests := []struct {
+		name    string
+		fields  BHFields
+		p       string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "Markdown is rendered into the page's template",
+			fields: makeTestBH("markdown"),
+			p:      path.Join(cwd, "../testdata/markdown/post.md"),
+			want: `<title>Hello, Markdown!</title>
+<h1 id="hello">Hello</h1>
+<table>
+<thead>
+<tr>
+<th>a</th>
+<th>b</th>
+</tr>
+</thead>
+<tbody>
+<tr>
+<td>1</td>
+<td>2</td>
+</tr>
+</tbody>
+</table>
+
+`,
+		},
+		{
+			name:   "Markdown without a template is rendered as is",
+			fields: makeTestBH("markdown"),
+			p:      path.Join(cwd, "../testdata/markdown/notes.md"),
+			want:   "<p>Some <em>notes</em>.</p>\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bh := &BlogHead{
+				Root:       tt.fields.Root,
+				Output:     tt.fields.Output,
+				tmplDir:    tt.fields.tmplDir,
+				configFile: tt.fields.configFile,
+				config:     tt.fields.config,
+				templates:  tt.fields.templates,
+				watcher:    tt.fields.watcher,
+			}
+			got, err := bh.compileMarkdown(tt.p, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("compileMarkdown() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("compileMarkdown() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,445 @@
+package internal
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Characters in a stylesheet which whitespace can be removed before or after.
+// Whitespace before ':' and '(' is significant in selectors and media queries
+const (
+	cssSpaceBefore = "{};,>)"
+	cssSpaceAfter  = "{};,>:("
+)
+
+// Removes the comments and unnecessary whitespace from the stylesheet. Strings are
+// copied unchanged. Whitespace around '+' and '-' is kept, since calc() needs it
+func minifyCSS(src []byte) []byte {
+	var buf bytes.Buffer
+	space := false
+
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '"' || c == '\'':
+			end := stringEnd(src, i)
+			if space {
+				writeSpace(&buf, cssSpaceAfter)
+			}
+			space = false
+			buf.Write(src[i:end])
+			i = end - 1
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end == -1 {
+				i = len(src)
+			} else {
+				i += end + 3
+			}
+			space = true
+		case isSpace(c):
+			space = true
+		default:
+			if strings.IndexByte(cssSpaceBefore, c) != -1 {
+				space = false
+				// The last declaration in a block doesn't need a semicolon
+				if c == '}' && buf.Len() > 0 && buf.Bytes()[buf.Len()-1] == ';' {
+					buf.Truncate(buf.Len() - 1)
+				}
+			}
+			if space {
+				writeSpace(&buf, cssSpaceAfter)
+				space = false
+			}
+			buf.WriteByte(c)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// Removes the comments and unnecessary whitespace from the script. Strings, template
+// literals and regular expressions are copied unchanged. Line breaks are kept where
+// they may end a statement, so that the meaning of the script doesn't change
+func minifyJS(src []byte) []byte {
+	var buf bytes.Buffer
+	space, newline := false, false
+
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+
+		if isSpace(c) || (c == '/' && i+1 < len(src) && (src[i+1] == '/' || src[i+1] == '*')) {
+			switch {
+			case c == '/' && src[i+1] == '/':
+				end := bytes.IndexByte(src[i:], '\n')
+				if end == -1 {
+					i = len(src)
+				} else {
+					i += end - 1
+				}
+			case c == '/':
+				end := bytes.Index(src[i+2:], []byte("*/"))
+				if end == -1 {
+					end = len(src) - i - 2
+				}
+				if bytes.IndexByte(src[i+2:i+2+end], '\n') != -1 {
+					newline = true
+				}
+				i += end + 3
+			case c == '\n':
+				newline = true
+			}
+			space = true
+			continue
+		}
+
+		if space && buf.Len() > 0 {
+			last := buf.Bytes()[buf.Len()-1]
+			switch {
+			case newline && strings.IndexByte("{;,([", last) == -1 && strings.IndexByte("});,]", c) == -1:
+				buf.WriteByte('\n')
+			case isWordByte(last) && isWordByte(c),
+				(last == '+' || last == '-') && last == c:
+				buf.WriteByte(' ')
+			}
+		}
+		space, newline = false, false
+
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			end := stringEnd(src, i)
+			buf.Write(src[i:end])
+			i = end - 1
+		case c == '/' && regexpAllowed(buf.Bytes()):
+			end := regexpEnd(src, i)
+			buf.Write(src[i:end])
+			i = end - 1
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// Writes a single space to the buffer, unless the last byte written is
+// one of the characters which don't need to be followed by whitespace
+func writeSpace(buf *bytes.Buffer, chars string) {
+	if buf.Len() == 0 || strings.IndexByte(chars, buf.Bytes()[buf.Len()-1]) != -1 {
+		return
+	}
+	buf.WriteByte(' ')
+}
+
+// Returns the index after the end of the string starting at src[i], where
+// src[i] is the quote character. Backslash escapes are skipped
+func stringEnd(src []byte, i int) int {
+	quote := src[i]
+	for j := i + 1; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			j++
+		case quote:
+			return j + 1
+		}
+	}
+	return len(src)
+}
+
+// Returns the index after the end of the regular expression literal starting at src[i],
+// including its flags. A '/' within a character class doesn't end the expression
+func regexpEnd(src []byte, i int) int {
+	class := false
+	for j := i + 1; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			j++
+		case '[':
+			class = true
+		case ']':
+			class = false
+		case '\n':
+			return j
+		case '/':
+			if class {
+				continue
+			}
+			for j++; j < len(src) && isWordByte(src[j]); j++ {
+			}
+			return j
+		}
+	}
+	return len(src)
+}
+
+// Determine if a '/' following the script written so far starts a regular
+// expression rather than being the division operator
+func regexpAllowed(out []byte) bool {
+	if len(out) == 0 {
+		return true
+	}
+
+	last := out[len(out)-1]
+	if strings.IndexByte("(,=:[!&|?{};+-*%<>~^\n", last) != -1 {
+		return true
+	}
+	if !isWordByte(last) {
+		return false
+	}
+
+	// A regular expression can follow a keyword, but not a name
+	start := len(out)
+	for start > 0 && isWordByte(out[start-1]) {
+		start--
+	}
+	switch string(out[start:]) {
+	case "return", "typeof", "case", "do", "else", "in", "instanceof", "new", "delete", "void", "throw", "yield", "await":
+		return true
+	}
+	return false
+}
+
+// Returns a copy of src with each ASCII letter in lowercase. Unlike bytes.ToLower,
+// the length of the copy is always the same as src
+func asciiLower(src []byte) []byte {
+	lower := make([]byte, len(src))
+	for i, c := range src {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		lower[i] = c
+	}
+	return lower
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// Determine if c can be part of an identifier, keyword or number
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// Elements with content which is copied unchanged when minifying HTML. The
+// content of a style element is minified as CSS
+var htmlRawElements = map[string]bool{
+	"pre": true, "textarea": true, "script": true, "style": true,
+}
+
+// Elements which are displayed as blocks, so whitespace around their tags isn't rendered
+var htmlBlockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "body": true, "dd": true,
+	"div": true, "dl": true, "dt": true, "fieldset": true, "figcaption": true, "figure": true,
+	"footer": true, "form": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true,
+	"h6": true, "head": true, "header": true, "hr": true, "html": true, "li": true, "link": true,
+	"main": true, "meta": true, "nav": true, "ol": true, "p": true, "pre": true, "section": true, "table": true,
+	"tbody": true, "td": true, "tfoot": true, "th": true, "thead": true, "title": true, "tr": true,
+	"ul": true, "!doctype": true,
+}
+
+// End tags which can always be left out of valid HTML, since the element is
+// closed by the next sibling or the end of its parent
+var htmlOptionalEndTags = map[string]bool{
+	"html": true, "body": true, "li": true, "dt": true, "dd": true, "option": true,
+	"thead": true, "tbody": true, "tfoot": true, "tr": true, "td": true, "th": true,
+}
+
+// Minifies the HTML page. Comments are removed, except for conditional comments, each
+// run of whitespace is collapsed into a single space, and whitespace around the tags
+// of block elements is removed. Quotes are removed from attribute values which don't
+// need them, and end tags which are optional are left out. The content of pre,
+// textarea and script elements is unchanged
+func minifyHTML(src []byte) []byte {
+	var buf bytes.Buffer
+	lower := asciiLower(src)
+	space := false
+	// Whitespace is removed at the start of the page and after a block element's tag
+	trim := true
+
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+
+		if isSpace(c) {
+			space = !trim
+			continue
+		}
+
+		if c != '<' || i+1 == len(src) {
+			if space {
+				buf.WriteByte(' ')
+			}
+			space, trim = false, false
+			buf.WriteByte(c)
+			continue
+		}
+
+		// Comments, except for conditional comments used by old browsers
+		if bytes.HasPrefix(src[i:], []byte("<!--")) && !bytes.HasPrefix(src[i:], []byte("<!--[if")) {
+			end := bytes.Index(src[i+4:], []byte("-->"))
+			if end == -1 {
+				i = len(src)
+			} else {
+				i += end + 6
+			}
+			continue
+		}
+
+		tag, name, closing, end := minifyTag(src, i)
+		if tag == nil {
+			if space {
+				buf.WriteByte(' ')
+			}
+			space, trim = false, false
+			buf.WriteByte(c)
+			continue
+		}
+		i = end - 1
+
+		block := htmlBlockElements[name]
+		if space && !block {
+			buf.WriteByte(' ')
+		}
+		space, trim = false, block
+
+		if closing && htmlOptionalEndTags[name] {
+			continue
+		}
+		buf.Write(tag)
+
+		// Copy the content of raw elements up to their end tag
+		if !closing && htmlRawElements[name] {
+			close := bytes.Index(lower[end:], []byte("</"+name))
+			if close == -1 {
+				close = len(src) - end
+			}
+			content := src[end : end+close]
+			if name == "style" {
+				content = minifyCSS(content)
+			}
+			buf.Write(content)
+			i = end + close - 1
+			trim = false
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// Minifies the tag starting at src[i]. Returns the minified tag, the tag's name in
+// lowercase, whether it is an end tag, and the index after the tag. If src[i] isn't
+// the start of a tag, the returned tag is nil
+func minifyTag(src []byte, i int) ([]byte, string, bool, int) {
+	j := i + 1
+	closing := j < len(src) && src[j] == '/'
+	if closing {
+		j++
+	}
+
+	// Declarations, such as the doctype, are kept with their whitespace collapsed
+	if !closing && j < len(src) && (src[j] == '!' || src[j] == '?') {
+		end := bytes.IndexByte(src[j:], '>')
+		if end == -1 {
+			return nil, "", false, 0
+		}
+		fields := bytes.Fields(src[i+1 : j+end])
+		name := strings.ToLower(string(fields[0]))
+		return append(append([]byte("<"), bytes.Join(fields, []byte(" "))...), '>'), name, false, j + end + 1
+	}
+
+	start := j
+	for j < len(src) && (isWordByte(src[j]) || src[j] == '-' || src[j] == ':') {
+		j++
+	}
+	if j == start || !(('a' <= src[start] && src[start] <= 'z') || ('A' <= src[start] && src[start] <= 'Z')) {
+		return nil, "", false, 0
+	}
+	name := strings.ToLower(string(src[start:j]))
+
+	var tag bytes.Buffer
+	tag.Write(src[i:j])
+	// An unquoted value must be separated from '/>', or the '/' would be part of the value
+	unquoted := false
+
+	for j < len(src) {
+		for j < len(src) && isSpace(src[j]) {
+			j++
+		}
+		if j == len(src) {
+			return nil, "", false, 0
+		}
+		if src[j] == '>' {
+			tag.WriteByte('>')
+			return tag.Bytes(), name, closing, j + 1
+		}
+		if src[j] == '/' && j+1 < len(src) && src[j+1] == '>' {
+			if unquoted {
+				tag.WriteByte(' ')
+			}
+			tag.WriteString("/>")
+			return tag.Bytes(), name, closing, j + 2
+		}
+
+		// The attribute's name
+		attr := j
+		for j < len(src) && !isSpace(src[j]) && src[j] != '=' && src[j] != '>' &&
+			!(src[j] == '/' && j+1 < len(src) && src[j+1] == '>') {
+			j++
+		}
+		if j == attr {
+			// A stray '=' or '/'
+			j++
+			continue
+		}
+		tag.WriteByte(' ')
+		tag.Write(src[attr:j])
+		unquoted = false
+
+		k := j
+		for k < len(src) && isSpace(src[k]) {
+			k++
+		}
+		if k == len(src) || src[k] != '=' {
+			continue
+		}
+		for k++; k < len(src) && isSpace(src[k]); k++ {
+		}
+		if k == len(src) {
+			return nil, "", false, 0
+		}
+
+		// The attribute's value
+		var value []byte
+		if src[k] == '"' || src[k] == '\'' {
+			end := bytes.IndexByte(src[k+1:], src[k])
+			if end == -1 {
+				return nil, "", false, 0
+			}
+			value = src[k+1 : k+1+end]
+			j = k + end + 2
+		} else {
+			j = k
+			for j < len(src) && !isSpace(src[j]) && src[j] != '>' {
+				j++
+			}
+			value = src[k:j]
+		}
+
+		tag.WriteByte('=')
+		if len(value) > 0 && bytes.IndexAny(value, " \t\n\r\f\"'`=<>") == -1 && value[len(value)-1] != '/' {
+			tag.Write(value)
+			unquoted = true
+		} else if bytes.IndexByte(value, '"') == -1 {
+			tag.WriteByte('"')
+			tag.Write(value)
+			tag.WriteByte('"')
+		} else {
+			tag.WriteByte('\'')
+			tag.Write(value)
+			tag.WriteByte('\'')
+		}
+	}
+
+	return nil, "", false, 0
+}
@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"io/ioutil"
+	"path"
+	"testing"
+)
+
+func Test_minifyCSS(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "Whitespace and comments",
+			src:  "/* Header */\nbody {\n  color: red;\n  margin: 0 auto;\n}\n",
+			want: "body{color:red;margin:0 auto}",
+		},
+		{
+			name: "Selectors",
+			src:  "ul > li,\na :hover { }",
+			want: "ul>li,a :hover{}",
+		},
+		{
+			name: "Strings are unchanged",
+			src:  "a::after { content: \"  /* not a comment */  \"; }",
+			want: "a::after{content:\"  /* not a comment */  \"}",
+		},
+		{
+			name: "Media queries and calc",
+			src:  "@media screen and (max-width: 600px) {\n  div { width: calc(100% - 2em); }\n}",
+			want: "@media screen and (max-width:600px){div{width:calc(100% - 2em)}}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(minifyCSS([]byte(tt.src))); got != tt.want {
+				t.Errorf("minifyCSS() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_minifyJS(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "Whitespace and comments",
+			src:  "// Add\nfunction add(a, b) {\n  /* sum */\n  return a + b;\n}\n",
+			want: "function add(a,b){return a+b;}",
+		},
+		{
+			name: "Line breaks which may end a statement are kept",
+			src:  "let a = 1\nlet b = a\n++b",
+			want: "let a=1\nlet b=a\n++b",
+		},
+		{
+			name: "Strings and template literals are unchanged",
+			src:  "var s = 'a // b' + \"c /* d */\" + `e  ${f}`;",
+			want: "var s='a // b'+\"c /* d */\"+`e  ${f}`;",
+		},
+		{
+			name: "Regular expressions",
+			src:  "var re = /[/]+ \\/ /g; x = a / b / c; if (/ +/.test(s)) return / x/",
+			want: "var re=/[/]+ \\/ /g;x=a/b/c;if(/ +/.test(s))return/ x/",
+		},
+		{
+			name: "Operators which would combine",
+			src:  "a = b + +c - -d",
+			want: "a=b+ +c- -d",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(minifyJS([]byte(tt.src))); got != tt.want {
+				t.Errorf("minifyJS() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_minifyHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "Whitespace around block elements",
+			src:  "<!DOCTYPE   html>\n<html>\n  <head>\n    <title> Blog </title>\n  </head>\n  <body>\n    <p>Some  <b>bold</b>\n text</p>\n  </body>\n</html>\n",
+			want: "<!DOCTYPE html><html><head><title>Blog</title></head><body><p>Some <b>bold</b> text</p>",
+		},
+		{
+			name: "Comments",
+			src:  "<p>a<!-- note --> b</p><!--[if IE]><p>IE</p><![endif]-->",
+			want: "<p>a b</p><!--[if IE]><p>IE</p><![endif]-->",
+		},
+		{
+			name: "Attributes",
+			src:  "<a  href=\"/posts/\"\n class=\"nav link\" data-x='say \"hi\"' title=\"\" hidden>x</a><img src=\"a.png\" />",
+			want: "<a href=\"/posts/\" class=\"nav link\" data-x='say \"hi\"' title=\"\" hidden>x</a><img src=a.png />",
+		},
+		{
+			name: "Optional end tags",
+			src:  "<ul>\n  <li>One</li>\n  <li>Two</li>\n</ul>",
+			want: "<ul><li>One<li>Two</ul>",
+		},
+		{
+			name: "Preformatted text and scripts are unchanged",
+			src:  "<pre>  a\n   b  </pre>\n<textarea>\n x </textarea> <script>\n  if (a < b) { x() }  // <b>\n</script>",
+			want: "<pre>  a\n   b  </pre><textarea>\n x </textarea> <script>\n  if (a < b) { x() }  // <b>\n</script>",
+		},
+		{
+			name: "Styles are minified",
+			src:  "<style>\n  body {\n    color: red;\n  }\n</STYLE>",
+			want: "<style>body{color:red}</STYLE>",
+		},
+		{
+			name: "Text which isn't a tag",
+			src:  "<p>1 < 2 and 3 >  2</p>",
+			want: "<p>1 < 2 and 3 > 2</p>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(minifyHTML([]byte(tt.src))); got != tt.want {
+				t.Errorf("minifyHTML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlogHead_Start_minify(t *testing.T) {
+	bh := makeTempSite(t)
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// Turning on minification builds every page again
+	bh.Minify = true
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if built := len(bh.Stats().PageTimes); built != 2 {
+		t.Errorf("Start() built %v page(s), want every page", built)
+	}
+
+	b := unwrap(ioutil.ReadFile(path.Join(bh.Output, "index.html"))).([]byte)
+	if want := "<head>Index</head><h1>Index</h1>"; string(b) != want {
+		t.Errorf("Start() wrote %v, want %v", string(b), want)
+	}
+	if stats := bh.Stats(); stats.MinifiedPages != 2 {
+		t.Errorf("Start() minified %v page(s), want 2", stats.MinifiedPages)
+	}
+}
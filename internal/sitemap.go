@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"encoding/xml"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// The maximum number of URLs in a sitemap. Larger sites are split into
+// several sitemaps, which are listed by a sitemap index at sitemap.xml
+const sitemapLimit = 50000
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapXML struct {
+	XMLName   xml.Name     `xml:"urlset"`
+	Namespace string       `xml:"xmlns,attr"`
+	URLs      []sitemapURL `xml:"url"`
+}
+
+type sitemapIndexXML struct {
+	XMLName   xml.Name     `xml:"sitemapindex"`
+	Namespace string       `xml:"xmlns,attr"`
+	Sitemaps  []sitemapURL `xml:"sitemap"`
+}
+
+// Returns the URL of the file at out in the output directory. The URL of
+// an index.html file is the URL of its directory
+func (bh *BlogHead) outputURL(out string) string {
+	rel := strings.TrimPrefix(out, bh.Output)
+	if path.Base(rel) == "index.html" {
+		return strings.TrimSuffix(bh.siteURL(path.Dir(rel)), "/") + "/"
+	}
+	return bh.siteURL(rel)
+}
+
+// Determine if the page with the metadata should be left out of the sitemap,
+// which is set with 'noindex: true' or 'sitemap: false'
+func excludedFromSitemap(meta map[string]interface{}) bool {
+	noindex, _ := meta["noindex"].(bool)
+	sitemap, ok := meta["sitemap"].(bool)
+	return noindex || (ok && !sitemap)
+}
+
+// Returns the URL of each page, and of each generated page in generated, sorted by URL.
+// A page was last modified at its 'updated' date, or when its file was modified. An
+// article's updated date includes its history. A generated page was last modified
+// when it was written
+func (bh *BlogHead) sitemapURLs(pages, generated []string) ([]sitemapURL, error) {
+	urls := []sitemapURL{}
+	for _, p := range pages {
+		meta, err := getTemplateData(p)
+		if err != nil {
+			return nil, err
+		}
+		if excludedFromSitemap(meta) {
+			continue
+		}
+
+		modified, err := toTime(meta["updated"])
+		if bh.isArticle(p) {
+			if _, updated := bh.articleDates(p, meta); !updated.IsZero() {
+				modified, err = updated, nil
+			}
+		}
+		if err != nil {
+			info, err := os.Stat(p)
+			if err != nil {
+				return nil, err
+			}
+			modified = info.ModTime()
+		}
+
+		urls = append(urls, sitemapURL{bh.outputURL(bh.outputPath(p)), modified.UTC().Format(time.RFC3339)})
+	}
+
+	for _, out := range generated {
+		info, err := os.Stat(out)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, sitemapURL{bh.outputURL(out), info.ModTime().UTC().Format(time.RFC3339)})
+	}
+
+	sort.Slice(urls, func(i, j int) bool {
+		return urls[i].Loc < urls[j].Loc
+	})
+	return urls, nil
+}
+
+// Writes the URLs to sitemap.xml in the output directory. If there are more than limit
+// URLs, they are written to sitemap-1.xml, sitemap-2.xml and so on, and sitemap.xml is
+// written as an index of the sitemaps. robots.txt is written with the location of the
+// sitemap, unless the root directory has its own robots.txt. Returns the paths written
+func (bh *BlogHead) writeSitemap(urls []sitemapURL, limit int) ([]string, error) {
+	written := []string{}
+	index := path.Join(bh.Output, "sitemap.xml")
+
+	if len(urls) <= limit {
+		if err := writeXML(index, sitemapXML{Namespace: sitemapNamespace, URLs: urls}); err != nil {
+			return nil, err
+		}
+		written = append(written, index)
+	} else {
+		doc := sitemapIndexXML{Namespace: sitemapNamespace}
+		for i := 0; i*limit < len(urls); i++ {
+			end := (i + 1) * limit
+			if end > len(urls) {
+				end = len(urls)
+			}
+
+			p := path.Join(bh.Output, "sitemap-"+strconv.Itoa(i+1)+".xml")
+			if err := writeXML(p, sitemapXML{Namespace: sitemapNamespace, URLs: urls[i*limit : end]}); err != nil {
+				return nil, err
+			}
+			written = append(written, p)
+
+			// A sitemap was last modified when its newest page was
+			lastMod := ""
+			for _, u := range urls[i*limit : end] {
+				if u.LastMod > lastMod {
+					lastMod = u.LastMod
+				}
+			}
+			doc.Sitemaps = append(doc.Sitemaps, sitemapURL{bh.outputURL(p), lastMod})
+		}
+
+		if err := writeXML(index, doc); err != nil {
+			return nil, err
+		}
+		written = append(written, index)
+	}
+
+	if _, err := os.Stat(path.Join(bh.Root, "robots.txt")); os.IsNotExist(err) {
+		robots := path.Join(bh.Output, "robots.txt")
+		f, err := createFile(robots)
+		if err != nil {
+			return nil, err
+		}
+		_, err = f.WriteString("User-agent: *\nAllow: /\n\nSitemap: " + bh.outputURL(index) + "\n")
+		_ = f.Close()
+		if err != nil {
+			return nil, err
+		}
+		written = append(written, robots)
+	}
+
+	return written, nil
+}
+
+// Writes the sitemap of the pages and the taxonomy pages in the next manifest, and adds
+// an entry for each file written to the next manifest. The sitemap is written on every
+// build, since the pages' dates can change without their inputs changing. Nothing is
+// written if the site's domain isn't set, since the sitemap must use absolute URLs
+func (bh *BlogHead) buildSitemap(pages []string, next *buildManifest) error {
+	if bh.config.Domain == "" {
+		return nil
+	}
+
+	generated := []string{}
+	for key, entry := range next.Entries {
+		if bh.isTaxonomyOutput(key) && path.Ext(entry.Output) == ".html" {
+			generated = append(generated, entry.Output)
+		}
+	}
+
+	urls, err := bh.sitemapURLs(pages, generated)
+	if err != nil {
+		return err
+	}
+
+	written, err := bh.writeSitemap(urls, sitemapLimit)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range written {
+		next.Entries[p] = &manifestEntry{p, nil}
+	}
+	return nil
+}
+
+// Writes the document to the file at p as XML
+func writeXML(p string, doc interface{}) error {
+	f, err := createFile(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(f)
+	encoder.Indent("", "  ")
+	return encoder.Encode(doc)
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestBlogHead_Start_sitemap(t *testing.T) {
+	bh := makeTempSite(t)
+	bh.config.Domain = "example.com"
+
+	files := map[string]string{
+		"posts/first.md":         "---\ntitle: First\nupdated: 2021-01-02T15:04:05Z\n---\n# First\n",
+		"private.html":           "<h1>Private</h1>",
+		"private_meta.json":      `{"noindex": true}`,
+		"drafts/index.html":      "<h1>Drafts</h1>",
+		"drafts/index_meta.json": `{"sitemap": false}`,
+	}
+	for name, text := range files {
+		f := unwrap(createFile(path.Join(bh.Root, name))).(*os.File)
+		if _, err := f.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	doc := sitemapXML{}
+	if err := xml.Unmarshal(unwrap(ioutil.ReadFile(path.Join(bh.Output, "sitemap.xml"))).([]byte), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	locs := []string{}
+	for _, u := range doc.URLs {
+		locs = append(locs, u.Loc)
+		if u.LastMod == "" {
+			t.Errorf("Start() wrote %v without a lastmod", u.Loc)
+		}
+	}
+	want := []string{"https://example.com/", "https://example.com/about.html", "https://example.com/posts/first.html"}
+	if !reflect.DeepEqual(locs, want) {
+		t.Errorf("Start() wrote the sitemap URLs %v, want %v", locs, want)
+	}
+	if doc.URLs[2].LastMod != "2021-01-02T15:04:05Z" {
+		t.Errorf("Start() wrote lastmod %v, want the updated date", doc.URLs[2].LastMod)
+	}
+
+	robots := string(unwrap(ioutil.ReadFile(path.Join(bh.Output, "robots.txt"))).([]byte))
+	if want := "User-agent: *\nAllow: /\n\nSitemap: https://example.com/sitemap.xml\n"; robots != want {
+		t.Errorf("Start() wrote robots.txt %q, want %q", robots, want)
+	}
+}
+
+func TestBlogHead_writeSitemap_index(t *testing.T) {
+	bh := makeTempSite(t)
+	bh.config.Domain = "example.com"
+
+	// The site's own robots.txt is copied instead
+	if err := ioutil.WriteFile(path.Join(bh.Root, "robots.txt"), []byte("User-agent: *\n"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	urls := []sitemapURL{
+		{"https://example.com/a.html", "2021-01-01T00:00:00Z"},
+		{"https://example.com/b.html", "2021-01-03T00:00:00Z"},
+		{"https://example.com/c.html", "2021-01-02T00:00:00Z"},
+	}
+	written, err := bh.writeSitemap(urls, 2)
+	if err != nil {
+		t.Fatalf("writeSitemap() error = %v", err)
+	}
+
+	want := []string{
+		path.Join(bh.Output, "sitemap-1.xml"),
+		path.Join(bh.Output, "sitemap-2.xml"),
+		path.Join(bh.Output, "sitemap.xml"),
+	}
+	if !reflect.DeepEqual(written, want) {
+		t.Errorf("writeSitemap() = %v, want %v", written, want)
+	}
+
+	index := sitemapIndexXML{}
+	if err := xml.Unmarshal(unwrap(ioutil.ReadFile(path.Join(bh.Output, "sitemap.xml"))).([]byte), &index); err != nil {
+		t.Fatal(err)
+	}
+	wantIndex := []sitemapURL{
+		{"https://example.com/sitemap-1.xml", "2021-01-03T00:00:00Z"},
+		{"https://example.com/sitemap-2.xml", "2021-01-02T00:00:00Z"},
+	}
+	if !reflect.DeepEqual(index.Sitemaps, wantIndex) {
+		t.Errorf("writeSitemap() wrote the index %v, want %v", index.Sitemaps, wantIndex)
+	}
+}
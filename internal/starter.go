@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// The starter theme written by 'bloghead init --starter'. Files in its templates
+// directory are written to the site's .templates directory, since files starting
+// with a dot can't be embedded
+//
+//go:embed starter
+var starterTheme embed.FS
+
+// Writes the starter theme into the root directory. Files which already exist are
+// kept. Returns the theme's blueprints, keyed by name, with the absolute path of each
+func writeStarter(root string, out io.Writer) (map[string]string, error) {
+	blueprints := make(map[string]string)
+
+	err := fs.WalkDir(starterTheme, "starter", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel := strings.TrimPrefix(p, "starter/")
+		if strings.HasPrefix(rel, "templates/") {
+			rel = "." + rel
+		}
+		dest, err := filepath.Abs(path.Join(root, rel))
+		if err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(rel, ".templates/blueprints/") {
+			blueprints[trimExt(path.Base(rel))] = dest
+		}
+
+		if _, err := os.Stat(dest); err == nil {
+			_, err = fmt.Fprintf(out, "Kept the existing %v\n", dest)
+			return err
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		b, err := starterTheme.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		f, err := createFile(dest)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(b)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	})
+
+	return blueprints, err
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func Test_initSite(t *testing.T) {
+	dir := unwrap(ioutil.TempDir("", "bloghead_init")).(string)
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	// Values given as options aren't prompted for
+	filename := path.Join(dir, ".bloghead")
+	in := strings.NewReader("\n\nann@example.com\nBlog\nNotes\n")
+	var out bytes.Buffer
+	if err := initSite(filename, InitOptions{Author: "Ann", Domain: "example.com"}, in, &out); err != nil {
+		t.Fatalf("initSite() error = %v", err)
+	}
+	if strings.Contains(out.String(), "Site author") || strings.Contains(out.String(), "Site domain") {
+		t.Errorf("initSite() prompted for a value given as an option:\n%v", out.String())
+	}
+
+	config := unwrap(ReadConfig(filename)).(*BlogConfig)
+	if config.Root != "./html" || config.Output != "./www" || config.Author != "Ann" || config.Email != "ann@example.com" ||
+		config.Domain != "example.com" || config.Title != "Blog" || config.SubTitle != "Notes" {
+		t.Errorf("initSite() wrote the config %+v", config)
+	}
+	for _, d := range []string{"html", "www", "html/.templates"} {
+		if info, err := os.Stat(path.Join(dir, d)); err != nil || !info.IsDir() {
+			t.Errorf("initSite() didn't create %v", d)
+		}
+	}
+}
+
+func Test_initSite_starter(t *testing.T) {
+	dir := unwrap(ioutil.TempDir("", "bloghead_init")).(string)
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	// Nothing is read from stdin with defaults
+	filename := path.Join(dir, ".bloghead")
+	opts := InitOptions{Title: "Blog", Domain: "example.com", Defaults: true, Starter: true}
+	if err := initSite(filename, opts, strings.NewReader(""), ioutil.Discard); err != nil {
+		t.Fatalf("initSite() error = %v", err)
+	}
+
+	root := path.Join(dir, "html")
+	config := unwrap(ReadConfig(filename)).(*BlogConfig)
+	if want := path.Join(root, ".templates/blueprints/article.html"); config.Blueprints["article"] != want {
+		t.Errorf("initSite() wrote the blueprints %v, want the article blueprint", config.Blueprints)
+	}
+
+	// The starter site builds, including an article using the blueprint
+	bh := &BlogHead{
+		Root:       root,
+		Output:     path.Join(dir, "www"),
+		tmplDir:    path.Join(root, ".templates") + "/",
+		configFile: filename,
+		config:     config,
+		templates:  make(map[string][]string),
+	}
+	article := path.Join(root, "first.md")
+	if err := bh.addNewMarkdownArticle("article", article, "yaml"); err != nil {
+		t.Fatalf("addNewMarkdownArticle() error = %v", err)
+	}
+	bh.config.Articles = []string{article}
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	index := string(unwrap(ioutil.ReadFile(path.Join(bh.Output, "index.html"))).([]byte))
+	if !strings.Contains(index, "<title>Blog</title>") || !strings.Contains(index, `<a href="https://example.com/first.html">first</a>`) {
+		t.Errorf("Start() wrote the index %v, want the starter index listing the article", index)
+	}
+	if _, err := os.Stat(path.Join(bh.Output, "first.html")); err != nil {
+		t.Errorf("Start() didn't write the article: %v", err)
+	}
+	if _, err := os.Stat(path.Join(bh.Output, "css/style.css")); err != nil {
+		t.Errorf("Start() didn't copy the stylesheet: %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// The status of an article, which determines whether it is published
+const (
+	statusPublished = "published"
+	// The article has 'draft: true'
+	statusDraft = "draft"
+	// The article's publishDate is in the future
+	statusScheduled = "scheduled"
+	// The article's expiryDate has passed
+	statusExpired = "expired"
+)
+
+// Returns the status of the article with the metadata at the time t. A draft is
+// always a draft, even if it is also scheduled or expired
+func articleStatus(meta map[string]interface{}, t time.Time) (string, error) {
+	if draft, _ := meta["draft"].(bool); draft {
+		return statusDraft, nil
+	}
+
+	if value, ok := meta["publishDate"]; ok && value != "" {
+		date, err := toTime(value)
+		if err != nil {
+			return "", errors.New("publishDate: " + err.Error())
+		}
+		if date.After(t) {
+			return statusScheduled, nil
+		}
+	}
+
+	if value, ok := meta["expiryDate"]; ok && value != "" {
+		date, err := toTime(value)
+		if err != nil {
+			return "", errors.New("expiryDate: " + err.Error())
+		}
+		if !date.After(t) {
+			return statusExpired, nil
+		}
+	}
+
+	return statusPublished, nil
+}
+
+// Determine if articles with the status are built. Drafts are built if bh.Drafts
+// is set, and scheduled articles if bh.Future is set. Expired articles are never built
+func (bh *BlogHead) isBuilt(status string) bool {
+	switch status {
+	case statusPublished:
+		return true
+	case statusDraft:
+		return bh.Drafts
+	case statusScheduled:
+		return bh.Future
+	}
+	return false
+}
+
+// The time which scheduled and expired articles are compared with
+func (bh *BlogHead) now() time.Time {
+	if bh.buildTime.IsZero() {
+		return time.Now()
+	}
+	return bh.buildTime
+}
+
+// Returns the status of the article at page, which is an absolute path
+func (bh *BlogHead) pageStatus(page string) (string, error) {
+	meta, err := getTemplateData(page)
+	if err != nil {
+		return "", err
+	}
+
+	status, err := articleStatus(meta, bh.now())
+	if err != nil {
+		return "", errors.New(page + ": " + err.Error())
+	}
+	return status, nil
+}
+
+// Returns the absolute path of each article which isn't built, sorted by path.
+// These articles are left out of the output, the feeds and every listing
+func (bh *BlogHead) hiddenArticles() ([]string, error) {
+	hidden := []string{}
+	for _, page := range bh.config.Articles {
+		abs, err := filepath.Abs(page)
+		if err != nil {
+			return nil, err
+		}
+
+		status, err := bh.pageStatus(abs)
+		if err != nil {
+			return nil, err
+		}
+		if !bh.isBuilt(status) {
+			hidden = append(hidden, abs)
+		}
+	}
+
+	sort.Strings(hidden)
+	return hidden, nil
+}
+
+// ListArticles prints each article with its status and date, newest first
+func (bh *BlogHead) ListArticles() error {
+	return bh.listArticles(os.Stdout)
+}
+
+// Writes each article with its status, date and title to w, newest first. A
+// scheduled article's date is its publishDate, and an expired article's is its expiryDate
+func (bh *BlogHead) listArticles(w io.Writer) error {
+	type row struct {
+		status string
+		date   time.Time
+		title  string
+		page   string
+	}
+
+	rows := []row{}
+	for _, page := range bh.config.Articles {
+		abs, err := filepath.Abs(page)
+		if err != nil {
+			return err
+		}
+
+		meta, err := getTemplateData(abs)
+		if err != nil {
+			return err
+		}
+		status, err := articleStatus(meta, bh.now())
+		if err != nil {
+			return errors.New(page + ": " + err.Error())
+		}
+
+		key := "published"
+		switch status {
+		case statusScheduled:
+			key = "publishDate"
+		case statusExpired:
+			key = "expiryDate"
+		}
+		// An invalid or missing date is left as the zero time
+		date, _ := toTime(meta[key])
+
+		rows = append(rows, row{status, date, metaString(meta, "title"), page})
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].date.After(rows[j].date)
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, r := range rows {
+		date := "-"
+		if !r.date.IsZero() {
+			date = r.date.Format("2006-01-02")
+		}
+		title := r.title
+		if title == "" {
+			title = "-"
+		}
+		if _, err := fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", r.status, date, title, strings.TrimPrefix(r.page, "./")); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
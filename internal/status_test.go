@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_articleStatus(t *testing.T) {
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		meta    map[string]interface{}
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "No metadata",
+			meta: nil,
+			want: statusPublished,
+		},
+		{
+			name: "Draft",
+			meta: map[string]interface{}{"draft": true, "publishDate": "2021-01-01"},
+			want: statusDraft,
+		},
+		{
+			name: "Scheduled",
+			meta: map[string]interface{}{"publishDate": "2021-06-01T00:00:01Z"},
+			want: statusScheduled,
+		},
+		{
+			name: "Published after its publishDate",
+			meta: map[string]interface{}{"draft": false, "publishDate": "2021-06-01", "expiryDate": "2021-07-01"},
+			want: statusPublished,
+		},
+		{
+			name: "Expired",
+			meta: map[string]interface{}{"expiryDate": "2021-06-01T00:00:00Z"},
+			want: statusExpired,
+		},
+		{
+			name:    "Invalid date",
+			meta:    map[string]interface{}{"publishDate": "June"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := articleStatus(tt.meta, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("articleStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("articleStatus() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Adds a published, a draft, a scheduled and an expired article to the site
+func addStatusArticles(t *testing.T, bh *BlogHead) {
+	articles := []struct {
+		name string
+		text string
+	}{
+		{"published.md", "---\ntitle: Published\npublished: 2021-02-01T00:00:00Z\n---\nPublished"},
+		{"draft.md", "---\ntitle: Draft\ndraft: true\n---\nDraft"},
+		{"scheduled.md", "---\ntitle: Scheduled\npublishDate: 2999-01-01\n---\nScheduled"},
+		{"expired.md", "---\ntitle: Expired\nexpiryDate: 2021-01-01\n---\nExpired"},
+	}
+	for _, a := range articles {
+		p := path.Join(bh.Root, a.name)
+		if err := ioutil.WriteFile(p, []byte(a.text), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		bh.config.Articles = append(bh.config.Articles, p)
+	}
+}
+
+func TestBlogHead_Start_drafts(t *testing.T) {
+	bh := makeTempSite(t)
+	bh.config.Domain = "example.com"
+	addStatusArticles(t, bh)
+
+	exists := func(name string) bool {
+		_, err := os.Stat(path.Join(bh.Output, name))
+		return err == nil
+	}
+	feed := func() string {
+		return string(unwrap(ioutil.ReadFile(path.Join(bh.Output, "feed.xml"))).([]byte))
+	}
+
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if !exists("published.html") || exists("draft.html") || exists("scheduled.html") || exists("expired.html") {
+		t.Errorf("Start() wrote a hidden article, or didn't write the published article")
+	}
+	if got := feed(); !strings.Contains(got, "<title>Published</title>") || strings.Contains(got, "<title>Draft</title>") {
+		t.Errorf("Start() wrote the feed %v, want only the published article", got)
+	}
+
+	// Previewing drafts and scheduled articles builds them, but expired articles are never built
+	bh.Drafts, bh.Future = true, true
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if !exists("draft.html") || !exists("scheduled.html") || exists("expired.html") {
+		t.Errorf("Start() didn't write the drafts and scheduled articles")
+	}
+	if got := feed(); !strings.Contains(got, "<title>Draft</title>") || !strings.Contains(got, "<title>Scheduled</title>") {
+		t.Errorf("Start() wrote the feed %v, want the drafts and scheduled articles", got)
+	}
+
+	// The output of articles which are hidden again is removed
+	bh.Drafts, bh.Future = false, false
+	if err := bh.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if exists("draft.html") || exists("scheduled.html") {
+		t.Errorf("Start() didn't remove the output of hidden articles")
+	}
+	if got := feed(); strings.Contains(got, "<title>Draft</title>") {
+		t.Errorf("Start() wrote the feed %v, want only the published article", got)
+	}
+}
+
+func TestBlogHead_listArticles(t *testing.T) {
+	bh := makeTempSite(t)
+	addStatusArticles(t, bh)
+
+	var buf bytes.Buffer
+	if err := bh.listArticles(&buf); err != nil {
+		t.Fatalf("listArticles() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := [][]string{
+		{"scheduled", "2999-01-01", "Scheduled"},
+		{"published", "2021-02-01", "Published"},
+		{"expired", "2021-01-01", "Expired"},
+		{"draft", "-", "Draft"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("listArticles() wrote %v line(s), want %v:\n%v", len(lines), len(want), buf.String())
+	}
+	for i, fields := range want {
+		if got := strings.Fields(lines[i]); len(got) != 4 || got[0] != fields[0] || got[1] != fields[1] || got[2] != fields[2] {
+			t.Errorf("listArticles() line %v = %q, want %v", i+1, lines[i], fields)
+		}
+	}
+}
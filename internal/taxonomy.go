@@ -0,0 +1,368 @@
+package internal
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// The template used for a taxonomy's index page when the templates
+// directory doesn't contain one. The page lists each term of the taxonomy
+const defaultTaxonomyTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <title>{{ .title }}</title>
+</head>
+<body>
+<h1>{{ .title }}</h1>
+<ul>
+{{- range .terms }}
+    <li><a href="{{ .Link }}">{{ .Name }}</a> ({{ len .Articles }})</li>
+{{- end }}
+</ul>
+</body>
+</html>
+`
+
+// The template used for the page of a single term when the templates directory
+// doesn't contain one. The page lists each article with the term and links to its feed
+const defaultTermTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <title>{{ .title }}</title>
+    <link rel="alternate" type="application/atom+xml" href="{{ .term.Feed }}">
+</head>
+<body>
+<h1>{{ .title }}</h1>
+<ul>
+{{- range .term.Articles }}
+    <li>
+        <a href="{{ .Link }}">{{ .Title }}</a>
+        {{- if not .Published.IsZero }} <time>{{ .Published.Format "January 2, 2006" }}</time>{{ end }}
+        {{- if .Summary }}<p>{{ .Summary }}</p>{{ end }}
+    </li>
+{{- end }}
+</ul>
+<a href="{{ .term.Feed }}">Feed</a>
+</body>
+</html>
+`
+
+// A taxonomy groups the site's articles by one of their fields, such as their tags.
+// An index page listing the terms of the taxonomy is written to <name>/index.html,
+// and each term has a page listing its articles and an atom feed in <name>/<term>/
+type taxonomy struct {
+	// The plural name of the taxonomy. The index page is compiled from the template
+	// '<name>.html' in the templates directory, if it exists
+	name string
+	// The singular name of the taxonomy. Each term's page is compiled from
+	// the template '<singular>.html' in the templates directory, if it exists
+	singular string
+	// Returns the terms of the article
+	terms func(bh *BlogHead, a *article) []string
+}
+
+var taxonomies = []taxonomy{
+	{
+		name:     "tags",
+		singular: "tag",
+		terms: func(bh *BlogHead, a *article) []string {
+			return a.Tags
+		},
+	},
+	{
+		name:     "authors",
+		singular: "author",
+		terms: func(bh *BlogHead, a *article) []string {
+			// Articles without an author were written by the site's author
+			if a.Author != "" {
+				return []string{a.Author}
+			}
+			if bh.config.Author != "" {
+				return []string{bh.config.Author}
+			}
+			return nil
+		},
+	},
+}
+
+// A single term of a taxonomy and the articles which have it
+type taxonomyTerm struct {
+	Name string
+	Slug string
+	// The URL of the term's page
+	Link string
+	// The URL of the term's atom feed
+	Feed string
+	// The articles with the term, from newest to oldest
+	Articles []*article
+}
+
+// Groups the articles, which must be sorted from newest to oldest, by the terms of
+// the taxonomy. Terms with the same slug are the same term, and the name of the term
+// is the first name found. The terms are sorted by name
+func (bh *BlogHead) taxonomyTerms(tax taxonomy, articles []*article) []*taxonomyTerm {
+	bySlug := make(map[string]*taxonomyTerm)
+	terms := []*taxonomyTerm{}
+
+	for _, a := range articles {
+		for _, name := range tax.terms(bh, a) {
+			slug := slugify(name)
+			if slug == "" {
+				continue
+			}
+
+			term, ok := bySlug[slug]
+			if !ok {
+				term = &taxonomyTerm{
+					Name:     name,
+					Slug:     slug,
+					Link:     bh.siteURL(path.Join(tax.name, slug)) + "/",
+					Feed:     bh.siteURL(path.Join(tax.name, slug, defaultFeedPath)),
+					Articles: []*article{},
+				}
+				bySlug[slug] = term
+				terms = append(terms, term)
+			}
+
+			// An article which lists the same term twice is only included once
+			if n := len(term.Articles); n == 0 || term.Articles[n-1] != a {
+				term.Articles = append(term.Articles, a)
+			}
+		}
+	}
+
+	sort.Slice(terms, func(i, j int) bool {
+		return strings.ToLower(terms[i].Name) < strings.ToLower(terms[j].Name)
+	})
+
+	return terms
+}
+
+// Writes the index page of each taxonomy, and the page and feed of each of its terms.
+// A taxonomy without any terms is not written. Returns the path of each file written
+func (bh *BlogHead) writeTaxonomies() ([]string, error) {
+	articles, err := bh.readArticles()
+	if err != nil {
+		return nil, err
+	}
+
+	written := []string{}
+	for _, tax := range taxonomies {
+		terms := bh.taxonomyTerms(tax, articles)
+		if len(terms) == 0 {
+			continue
+		}
+
+		dir := path.Join(bh.Output, tax.name)
+		index := path.Join(dir, "index.html")
+		if err := bh.writeTaxonomyPage(index, tax.name+".html", defaultTaxonomyTemplate, map[string]interface{}{
+			"title":    strings.ToUpper(tax.name[:1]) + tax.name[1:],
+			"taxonomy": tax.name,
+			"terms":    terms,
+		}); err != nil {
+			return nil, err
+		}
+		written = append(written, index)
+
+		for _, term := range terms {
+			page := path.Join(dir, term.Slug, "index.html")
+			if err := bh.writeTaxonomyPage(page, tax.singular+".html", defaultTermTemplate, map[string]interface{}{
+				"title":    term.Name,
+				"taxonomy": tax.name,
+				"term":     term,
+			}); err != nil {
+				return nil, err
+			}
+
+			feed := bh.newSiteFeed(term.Articles)
+			feed.Title = strings.TrimPrefix(bh.config.Title+": "+term.Name, ": ")
+			feed.Link = term.Link
+
+			feedPath := path.Join(dir, term.Slug, defaultFeedPath)
+			if err := bh.writeFeedFile(feedPath, feed, writeAtom); err != nil {
+				return nil, err
+			}
+
+			written = append(written, page, feedPath)
+		}
+	}
+
+	return written, nil
+}
+
+// Compiles the named template with the data and writes it to p. If the template
+// doesn't exist in the templates directory or the theme's, the fallback is used
+func (bh *BlogHead) writeTaxonomyPage(p, name, fallback string, data map[string]interface{}) error {
+	text, layout, templates := fallback, "", []string{}
+	if _, err := os.Stat(bh.templatePath(name)); err == nil {
+		if templates, err = bh.layoutTemplates(name); err != nil {
+			return err
+		}
+		text, layout = "", name
+	}
+
+	data, err := bh.templateContext("", data, templates)
+	if err != nil {
+		return err
+	}
+
+	b, err := bh.execute("", text, layout, templates, data)
+	if err != nil {
+		return err
+	}
+
+	f, err := createFile(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(bh.minifyPage(b))
+	return err
+}
+
+// Writes the taxonomies if any of their inputs changed since the last build,
+// and records the inputs of each written file in the next manifest
+func (bh *BlogHead) buildTaxonomies(manifest, next *buildManifest) error {
+	inputs, err := bh.taxonomyInputs()
+
+	previous := []string{}
+	for key := range manifest.Entries {
+		if bh.isTaxonomyOutput(key) {
+			previous = append(previous, key)
+		}
+	}
+
+	upToDate := err == nil && len(previous) > 0
+	for _, p := range previous {
+		if !manifest.upToDate(p, inputs) {
+			upToDate = false
+		}
+	}
+
+	if upToDate {
+		for _, p := range previous {
+			next.Entries[p] = manifest.Entries[p]
+		}
+		return nil
+	}
+
+	written := []string{}
+	if err == nil {
+		written, err = bh.writeTaxonomies()
+	}
+
+	if err != nil {
+		// Keep the previous files, but write them again during the next build
+		for _, p := range previous {
+			next.Entries[p] = &manifestEntry{p, nil}
+		}
+		return &PageError{"taxonomies", err}
+	}
+
+	for _, p := range written {
+		next.Entries[p] = &manifestEntry{p, inputs}
+	}
+	return nil
+}
+
+// Hashes each of the inputs used to write the taxonomies. These are the inputs of
+// the feed, since both are written from the articles, and the taxonomy templates
+func (bh *BlogHead) taxonomyInputs() (map[string]string, error) {
+	files, err := bh.feedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	templates, err := bh.taxonomyTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	inputs, _, err := bh.contextFiles(templates)
+	if err != nil {
+		return nil, err
+	}
+
+	files = append(files, templates...)
+	return hashFiles(append(files, inputs...)...)
+}
+
+// Returns the name of each template which replaces one of the default taxonomy templates
+func taxonomyTemplateNames() []string {
+	names := []string{}
+	for _, tax := range taxonomies {
+		names = append(names, tax.name+".html", tax.singular+".html")
+	}
+	return names
+}
+
+// Returns the path of each template in the templates directory, and in the theme's,
+// which replaces one of the default taxonomy templates, whether or not it exists
+func (bh *BlogHead) taxonomyTemplatePaths() []string {
+	paths := []string{}
+	for _, name := range taxonomyTemplateNames() {
+		paths = append(paths, path.Join(bh.tmplDir, name))
+		if bh.themeTmplDir != "" {
+			paths = append(paths, path.Join(bh.themeTmplDir, name))
+		}
+	}
+	return paths
+}
+
+// Returns each taxonomy template which exists in the templates directory or the
+// theme's, followed by the templates they use
+func (bh *BlogHead) taxonomyTemplates() ([]string, error) {
+	templates := []string{}
+	for _, name := range taxonomyTemplateNames() {
+		p := bh.templatePath(name)
+		if _, err := os.Stat(p); err != nil {
+			continue
+		}
+
+		used, err := bh.gatherTemplates(p)
+		if err != nil {
+			return nil, err
+		}
+
+		templates = appendUnique(templates, p)
+		for _, tmpl := range used {
+			templates = appendUnique(templates, tmpl)
+		}
+	}
+	return templates, nil
+}
+
+// Determine if p is a file in the output directory written for a taxonomy
+func (bh *BlogHead) isTaxonomyOutput(p string) bool {
+	for _, tax := range taxonomies {
+		if strings.HasPrefix(p, path.Join(bh.Output, tax.name)+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the name as a lowercase string which can be used in a URL. Letters
+// and digits are kept, and every other run of characters is replaced with a '-'
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteRune('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_slugify(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  string
+		want string
+	}{
+		{
+			name: "Lowercase",
+			arg:  "Go",
+			want: "go",
+		},
+		{
+			name: "Spaces and punctuation",
+			arg:  "  Static Sites, Generators! ",
+			want: "static-sites-generators",
+		},
+		{
+			name: "Unicode letters",
+			arg:  "Café Crème",
+			want: "café-crème",
+		},
+		{
+			name: "No letters",
+			arg:  "--",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := slugify(tt.arg); got != tt.want {
+				t.Errorf("slugify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlogHead_taxonomyTerms(t *testing.T) {
+	bh := &BlogHead{Output: "/www", config: &BlogConfig{Domain: "example.com", Author: "Site Author"}}
+
+	first := &article{Title: "First", Tags: []string{"Go", "web"}}
+	second := &article{Title: "Second", Tags: []string{"go", "go"}, Author: "Guest"}
+
+	tags := bh.taxonomyTerms(taxonomies[0], []*article{first, second})
+	if len(tags) != 2 {
+		t.Fatalf("taxonomyTerms() returned %v terms, want 2", len(tags))
+	}
+	if tags[0].Name != "Go" || tags[0].Slug != "go" || !reflect.DeepEqual(tags[0].Articles, []*article{first, second}) {
+		t.Errorf("taxonomyTerms() first term = %+v, want Go with both articles", tags[0])
+	}
+	if tags[0].Link != "https://example.com/tags/go/" || tags[0].Feed != "https://example.com/tags/go/feed.xml" {
+		t.Errorf("taxonomyTerms() links = %v %v", tags[0].Link, tags[0].Feed)
+	}
+	if tags[1].Name != "web" || !reflect.DeepEqual(tags[1].Articles, []*article{first}) {
+		t.Errorf("taxonomyTerms() second term = %+v, want web with the first article", tags[1])
+	}
+
+	authors := bh.taxonomyTerms(taxonomies[1], []*article{first, second})
+	names := []string{}
+	for _, term := range authors {
+		names = append(names, term.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"Guest", "Site Author"}) {
+		t.Errorf("taxonomyTerms() authors = %v, want [Guest Site Author]", names)
+	}
+}
+
+func TestBlogHead_writeTaxonomies(t *testing.T) {
+	bh := makeTempSite(t)
+	bh.config.Domain = "example.com"
+	bh.config.Title = "Blog"
+
+	articles := []struct {
+		name string
+		text string
+	}{
+		{"first.md", "---\ntitle: First\npublished: 2021-02-01T00:00:00Z\ntags: [Go, Web]\nauthor: Ann\n---\nFirst"},
+		{"second.md", "---\ntitle: Second\npublished: 2021-01-01T00:00:00Z\ncategories: go\nauthor: Ben\n---\nSecond"},
+	}
+	for _, a := range articles {
+		p := path.Join(bh.Root, a.name)
+		if err := ioutil.WriteFile(p, []byte(a.text), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		bh.config.Articles = append(bh.config.Articles, p)
+	}
+
+	// The tag page template is replaced, the others use the defaults
+	tmpl := path.Join(bh.tmplDir, "tag.html")
+	if err := ioutil.WriteFile(tmpl, []byte("{{ .title }}:{{ range .term.Articles }} {{ .Title }}{{ end }}"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := bh.writeTaxonomies()
+	if err != nil {
+		t.Fatalf("writeTaxonomies() error = %v", err)
+	}
+	if len(written) != 10 {
+		t.Errorf("writeTaxonomies() wrote %v files, want 10: %v", len(written), written)
+	}
+
+	read := func(p string) string {
+		return string(unwrap(ioutil.ReadFile(path.Join(bh.Output, p))).([]byte))
+	}
+
+	if got := read("tags/go/index.html"); got != "Go: First Second" {
+		t.Errorf("tags/go/index.html = %v, want the overridden template", got)
+	}
+	if got := read("tags/index.html"); !strings.Contains(got, `<a href="https://example.com/tags/web/">Web</a> (1)`) {
+		t.Errorf("tags/index.html = %v, want a link to the web tag", got)
+	}
+	if got := read("authors/ann/index.html"); !strings.Contains(got, `<a href="https://example.com/first.html">First</a>`) {
+		t.Errorf("authors/ann/index.html = %v, want a link to the first article", got)
+	}
+	if got := read("tags/web/feed.xml"); !strings.Contains(got, "<title>Blog: Web</title>") || strings.Contains(got, "<title>Second</title>") {
+		t.Errorf("tags/web/feed.xml = %v, want a feed of the first article", got)
+	}
+}
@@ -0,0 +1,225 @@
+package internal
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// The themes built into bloghead, keyed by name. The files of each are in a directory
+// with the theme's name. A built-in theme is used when the config's theme names it
+// and there is no directory with that name
+var builtinThemes = map[string]embed.FS{
+	"starter": starterTheme,
+}
+
+// The directory a theme keeps its templates and blueprints in. Every other
+// file in a theme, other than pages, is an asset
+const themeTemplatesDir = "templates"
+
+// The directory which built-in themes are written to, so that their files can be
+// read and watched like any other theme. It is stored next to the output directory
+func (bh *BlogHead) themeCacheDir() string {
+	return path.Join(path.Dir(bh.Output), "."+path.Base(bh.Output)+"_themes")
+}
+
+// Finds the directory of the theme named in the config. The theme is a directory
+// relative to the working directory or, if there is no such directory, a built-in
+// theme, which is written to the theme cache. Sets bh.themeDir, which is empty if
+// the site doesn't use a theme
+func (bh *BlogHead) loadTheme() error {
+	bh.themeDir, bh.themeTmplDir = "", ""
+	if bh.config == nil || bh.config.Theme == "" {
+		return nil
+	}
+
+	dir, err := filepath.Abs(bh.config.Theme)
+	if err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		theme, ok := builtinThemes[bh.config.Theme]
+		if !ok {
+			return errors.New(fmt.Sprintf("theme %v could not be found. It must be a directory or one of the built-in themes", bh.config.Theme))
+		}
+		dir = path.Join(bh.themeCacheDir(), bh.config.Theme)
+		if err := extractTheme(theme, bh.config.Theme, dir); err != nil {
+			return err
+		}
+	}
+
+	bh.themeDir = dir
+	bh.themeTmplDir = path.Join(dir, themeTemplatesDir) + "/"
+	return nil
+}
+
+// Writes the files of the embedded theme in the directory name to dir. Files which
+// haven't changed aren't written, so that their modification times are kept
+func extractTheme(theme embed.FS, name, dir string) error {
+	return fs.WalkDir(theme, name, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		b, err := theme.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		dest := path.Join(dir, strings.TrimPrefix(p, name+"/"))
+		if existing, err := ioutil.ReadFile(dest); err == nil && bytes.Equal(existing, b) {
+			return nil
+		}
+		return writeFileAtomic(dest, b)
+	})
+}
+
+// Determine if p is one of the theme's files
+func (bh *BlogHead) isThemeFile(p string) bool {
+	return bh.themeDir != "" && strings.HasPrefix(p, bh.themeDir+"/")
+}
+
+// Determine if p is a template, in the site's templates directory or the theme's
+func (bh *BlogHead) isTemplateFile(p string) bool {
+	return trimPath(bh.tmplDir, p) != p || (bh.themeTmplDir != "" && trimPath(bh.themeTmplDir, p) != p)
+}
+
+// Returns the name of the template at p, which is its path relative to the
+// templates directory it is in. Returns p if it isn't a template
+func (bh *BlogHead) templateName(p string) string {
+	if rel := trimPath(bh.tmplDir, p); rel != p {
+		return rel
+	}
+	if bh.themeTmplDir != "" {
+		return trimPath(bh.themeTmplDir, p)
+	}
+	return p
+}
+
+// Returns the path of the named template. A template in the site's templates directory
+// overrides the theme's template with the same name. If neither exists, the path in the
+// site's templates directory is returned
+func (bh *BlogHead) templatePath(name string) string {
+	p := path.Join(bh.tmplDir, name)
+	if bh.themeTmplDir == "" {
+		return p
+	}
+	if _, err := os.Stat(p); err == nil {
+		return p
+	}
+	if themed := path.Join(bh.themeTmplDir, name); fileExists(themed) {
+		return themed
+	}
+	return p
+}
+
+// Returns the path of the asset at name, which is relative to the root directory. An
+// asset in the root directory overrides the theme's asset with the same name
+func (bh *BlogHead) assetFile(name string) string {
+	p := path.Join(bh.Root, path.Clean("/"+name))
+	if bh.themeDir == "" || fileExists(p) {
+		return p
+	}
+	if themed := path.Join(bh.themeDir, path.Clean("/"+name)); fileExists(themed) {
+		return themed
+	}
+	return p
+}
+
+// Returns the path of the file at p relative to the root directory, or to the theme
+// directory if it is one of the theme's files
+func (bh *BlogHead) sourcePath(p string) string {
+	if bh.isThemeFile(p) {
+		return trimPath(bh.themeDir, p)
+	}
+	return trimPath(bh.Root, p)
+}
+
+// Returns the file in the other layer which the file at p overrides or is overridden by:
+// the theme's template or asset with the same name as a file in the site, or the site's
+// template or asset with the same name as a file in the theme. Returns an empty string
+// if the site doesn't use a theme. The returned file may not exist
+func (bh *BlogHead) themeCounterpart(p string) string {
+	if bh.themeDir == "" {
+		return ""
+	}
+
+	switch {
+	case trimPath(bh.tmplDir, p) != p:
+		return path.Join(bh.themeTmplDir, trimPath(bh.tmplDir, p))
+	case trimPath(bh.themeTmplDir, p) != p:
+		return path.Join(bh.tmplDir, trimPath(bh.themeTmplDir, p))
+	case bh.isThemeFile(p):
+		return path.Join(bh.Root, trimPath(bh.themeDir, p))
+	case trimPath(bh.Root+"/", p) != p:
+		return path.Join(bh.themeDir, trimPath(bh.Root, p))
+	}
+	return ""
+}
+
+// Determine if the file at p is one of the theme's assets. The theme's templates and
+// pages aren't assets, and neither are assets overridden by a file in the root directory
+func (bh *BlogHead) isThemeAsset(p string, info os.FileInfo) bool {
+	if info.IsDir() || !bh.isThemeFile(p) || trimPath(bh.themeTmplDir, p) != p {
+		return false
+	}
+
+	rel := trimPath(bh.themeDir+"/", p)
+	if path.Ext(p) == ".html" || isMarkdown(p) || strings.HasSuffix(p, "_meta.json") {
+		return false
+	}
+	for _, name := range strings.Split(rel, "/") {
+		if strings.HasPrefix(name, ".") {
+			return false
+		}
+	}
+
+	return !fileExists(path.Join(bh.Root, rel))
+}
+
+// Returns each of the theme's assets which isn't overridden by the site
+func (bh *BlogHead) themeAssets() ([]string, error) {
+	assets := []string{}
+	if bh.themeDir == "" {
+		return assets, nil
+	}
+
+	err := filepath.Walk(bh.themeDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if bh.isThemeAsset(p, info) {
+			assets = append(assets, p)
+		}
+		return nil
+	})
+	return assets, err
+}
+
+// Returns the path of the named blueprint. Blueprints created with 'bloghead create'
+// are listed in the config, and the theme's blueprints are in its blueprints directory
+func (bh *BlogHead) blueprintPath(name string) (string, bool) {
+	if p, ok := bh.config.Blueprints[name]; ok {
+		return p, true
+	}
+	if bh.themeTmplDir != "" {
+		if p := path.Join(bh.themeTmplDir, "blueprints", name+".html"); fileExists(p) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// Determine if there is a file at p
+func fileExists(p string) bool {
+	info, err := os.Stat(p)
+	return err == nil && !info.IsDir()
+}
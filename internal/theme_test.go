@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// Creates a site using a theme which provides the head and nav templates,
+// a stylesheet and a page which isn't part of the site
+func makeThemeSite(t *testing.T) *BlogHead {
+	bh := makeTempSite(t)
+	theme := path.Join(path.Dir(bh.Root), "theme")
+	files := map[string]string{
+		"templates/head.html":            "<head>Theme {{ .title }}</head>",
+		"templates/nav.html":             "<nav>Theme</nav>",
+		"templates/blueprints/post.html": "<article></article>",
+		"css/style.css":                  "body {}",
+		"index.html":                     "<h1>Theme</h1>",
+	}
+	for name, text := range files {
+		writeTestFile(t, path.Join(theme, name), text)
+	}
+	writeTestFile(t, path.Join(bh.Root, "index.html"), "{{ template \"head.html\" . }}{{ template \"nav.html\" }}<h1>Index</h1>")
+
+	bh.config.Theme = theme
+	return bh
+}
+
+func writeTestFile(t *testing.T, p, text string) string {
+	f := unwrap(createFile(p)).(*os.File)
+	defer f.Close()
+	if _, err := f.WriteString(text); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestBlogHead_loadTheme(t *testing.T) {
+	bh := makeTempSite(t)
+
+	// Directories named like a built-in theme are used instead of it, so run from the site's directory
+	wd := unwrap(os.Getwd()).(string)
+	if err := os.Chdir(path.Dir(bh.Root)); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	bh.config.Theme = "starter"
+	if err := bh.loadTheme(); err != nil {
+		t.Fatalf("loadTheme() error = %v", err)
+	}
+	if want := path.Join(bh.themeCacheDir(), "starter"); bh.themeDir != want {
+		t.Errorf("loadTheme() themeDir = %v, want %v", bh.themeDir, want)
+	}
+	if p := bh.templatePath("base.html"); p != path.Join(bh.themeTmplDir, "base.html") {
+		t.Errorf("templatePath() = %v, want the built-in theme's template", p)
+	}
+	if p, ok := bh.blueprintPath("article"); !ok || !fileExists(p) {
+		t.Errorf("blueprintPath() = %v, %v, want the built-in theme's blueprint", p, ok)
+	}
+
+	bh.config.Theme = "missing"
+	if err := bh.loadTheme(); err == nil {
+		t.Errorf("loadTheme() expected an error for a theme which doesn't exist")
+	}
+}
+
+func TestBlogHead_Start_theme(t *testing.T) {
+	bh := makeThemeSite(t)
+	read := func(name string) string {
+		b, err := ioutil.ReadFile(path.Join(bh.Output, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	build := func() {
+		if err := bh.Start(); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+	}
+
+	// The site's head overrides the theme's, and the theme's nav is used
+	build()
+	if got := read("index.html"); got != "<head>Index</head><nav>Theme</nav><h1>Index</h1>" {
+		t.Errorf("Start() wrote %v", got)
+	}
+	if got := read("css/style.css"); got != "body {}" {
+		t.Errorf("Start() wrote the theme's stylesheet as %v", got)
+	}
+	if _, err := os.Stat(path.Join(bh.Output, "templates")); !os.IsNotExist(err) {
+		t.Errorf("Start() expected the theme's templates not to be copied")
+	}
+
+	// Removing the site's template falls back to the theme's
+	if err := os.Remove(path.Join(bh.tmplDir, "head.html")); err != nil {
+		t.Fatal(err)
+	}
+	build()
+	if got := read("index.html"); got != "<head>Theme Index</head><nav>Theme</nav><h1>Index</h1>" {
+		t.Errorf("Start() wrote %v after the site's template was removed", got)
+	}
+
+	// An asset in the root directory overrides the theme's, which is used again once it is removed
+	style := writeTestFile(t, path.Join(bh.Root, "css/style.css"), "body { color: red; }")
+	build()
+	if got := read("css/style.css"); got != "body { color: red; }" {
+		t.Errorf("Start() wrote the overridden stylesheet as %v", got)
+	}
+	if err := os.Remove(style); err != nil {
+		t.Fatal(err)
+	}
+	build()
+	if got := read("css/style.css"); got != "body {}" {
+		t.Errorf("Start() wrote the stylesheet as %v after the site's was removed", got)
+	}
+}
+
+func Test_siteWatcher_handleChanges_theme(t *testing.T) {
+	bh := makeThemeSite(t)
+	if err := os.Remove(path.Join(bh.tmplDir, "head.html")); err != nil {
+		t.Fatal(err)
+	}
+	if err := bh.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	bh.watcher = unwrap(fsnotify.NewWatcher()).(*fsnotify.Watcher)
+	defer bh.watcher.Close()
+
+	w := &siteWatcher{
+		bh:       bh,
+		pages:    make(map[string]bool),
+		failed:   make(map[string]bool),
+		assets:   make(map[string]string),
+		variants: make(map[string][]string),
+		bundles:  make(map[string]string),
+		hidden:   make(map[string]bool),
+	}
+	for _, dir := range []string{bh.Root, bh.themeDir} {
+		if _, _, err := w.addDir(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	index := func() string {
+		b, _ := ioutil.ReadFile(path.Join(bh.Output, "index.html"))
+		return string(b)
+	}
+
+	// Changing the theme's template rebuilds the pages which use it
+	nav := writeTestFile(t, path.Join(bh.themeTmplDir, "nav.html"), "<nav>Changed</nav>")
+	w.handleChanges(map[string]bool{nav: true})
+	if got := index(); got != "<head>Theme Index</head><nav>Changed</nav><h1>Index</h1>" {
+		t.Errorf("Expected the page to use the changed theme template, got %v", got)
+	}
+
+	// Creating a template in the site overrides the theme's
+	head := writeTestFile(t, path.Join(bh.tmplDir, "head.html"), "<head>Site</head>")
+	w.handleChanges(map[string]bool{head: true})
+	if got := index(); got != "<head>Site</head><nav>Changed</nav><h1>Index</h1>" {
+		t.Errorf("Expected the page to use the site's template, got %v", got)
+	}
+
+	// Removing it falls back to the theme's again
+	if err := os.Remove(head); err != nil {
+		t.Fatal(err)
+	}
+	w.handleChanges(map[string]bool{head: true})
+	if got := index(); got != "<head>Theme Index</head><nav>Changed</nav><h1>Index</h1>" {
+		t.Errorf("Expected the page to use the theme's template once the site's was removed, got %v", got)
+	}
+
+	// The same applies to assets
+	out := path.Join(bh.Output, "css/style.css")
+	style := writeTestFile(t, path.Join(bh.Root, "css/style.css"), "body { color: red; }")
+	w.handleChanges(map[string]bool{path.Dir(style): true})
+	if b, _ := ioutil.ReadFile(out); string(b) != "body { color: red; }" {
+		t.Errorf("Expected the site's stylesheet to be copied, got %v", string(b))
+	}
+	if err := os.RemoveAll(path.Dir(style)); err != nil {
+		t.Fatal(err)
+	}
+	w.handleChanges(map[string]bool{path.Dir(style): true})
+	if b, _ := ioutil.ReadFile(out); string(b) != "body {}" {
+		t.Errorf("Expected the theme's stylesheet to be copied once the site's was removed, got %v", string(b))
+	}
+}
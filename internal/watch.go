@@ -0,0 +1,762 @@
+package internal
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Filesystem events are collected until no new events have arrived for this long.
+// Editors often save a file by writing a temporary file and renaming it, which
+// causes a burst of events for what is a single change
+const watchDelay = 100 * time.Millisecond
+
+// siteWatcher keeps track of the pages found while watching the site
+type siteWatcher struct {
+	bh *BlogHead
+
+	// Every page in the root directory
+	pages map[string]bool
+	// Pages which failed to compile during the last build. These are
+	// compiled again when a file they could depend on is created
+	failed map[string]bool
+
+	// The files used to write the feeds and taxonomy pages
+	feedFiles map[string]bool
+	// The files written for the taxonomies by the last build
+	taxonomyOutput map[string]bool
+	// The output path of each asset
+	assets map[string]string
+	// The output paths of the resized copies of each image
+	variants map[string][]string
+	// The output path of each bundle, keyed by the bundle's name
+	bundles map[string]string
+	// Articles which aren't built, because they are drafts, scheduled or expired
+	hidden map[string]bool
+	// Set when an asset or bundle is written, until the changes have been handled
+	assetsWritten bool
+}
+
+// Watch initializes the filesystem watcher for all directories found
+// in the root directory, including the '.templates' directory, and in
+// the theme's directory.
+// On a file change, the file is rebuilt along with all files which
+// use the changed template. New pages are compiled, and the output of
+// removed pages is deleted. The site is created before the watcher
+// is initialized. Pages which fail to compile are reported, but
+// do not stop the watcher from starting
+func (bh *BlogHead) Watch() error {
+	w := &siteWatcher{
+		bh:             bh,
+		pages:          make(map[string]bool),
+		failed:         make(map[string]bool),
+		taxonomyOutput: make(map[string]bool),
+		assets:         make(map[string]string),
+		variants:       make(map[string][]string),
+		bundles:        make(map[string]string),
+		hidden:         make(map[string]bool),
+	}
+
+	// Build all files
+	if err := bh.Start(); err != nil {
+		errs, ok := err.(BuildErrors)
+		if !ok {
+			return err
+		}
+		for _, err := range errs {
+			if pageErr, ok := err.(*PageError); ok {
+				w.failed[pageErr.Page] = true
+			}
+		}
+		println(err.Error())
+	}
+
+	for _, p := range bh.hidden {
+		w.hidden[p] = true
+	}
+
+	// The manifest written by the build lists the taxonomy files, assets, resized images and bundles
+	manifest := bh.readManifest()
+	for p, entry := range manifest.Entries {
+		if _, ok := entry.Inputs[imageSettingsKey]; ok {
+			for image := range entry.Inputs {
+				if image != imageSettingsKey {
+					w.variants[image] = append(w.variants[image], entry.Output)
+				}
+			}
+		} else if bh.isTaxonomyOutput(p) {
+			w.taxonomyOutput[p] = true
+		} else if info, err := os.Stat(p); err == nil && bh.isAsset(p, info) {
+			w.assets[p] = entry.Output
+		}
+	}
+	for _, name := range bh.bundleNames() {
+		if entry, ok := manifest.Entries[path.Join(bh.Output, path.Clean("/"+name))]; ok {
+			w.bundles[name] = entry.Output
+		}
+	}
+
+	// Watch files for changes
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	bh.watcher = watcher
+
+	// Register listeners on each directory
+	if _, _, err := w.addDir(bh.Root); err != nil {
+		return err
+	}
+	if bh.themeDir != "" {
+		if _, _, err := w.addDir(bh.themeDir); err != nil {
+			return err
+		}
+	}
+
+	// The configuration file's directory is watched rather than the file itself,
+	// since editors which save by renaming would replace the watched file
+	if bh.configFile != "" {
+		if err := bh.watcher.Add(path.Dir(bh.configFile)); err != nil {
+			return err
+		}
+	}
+	w.updateFeedFiles()
+
+	// When a filesystem change is detected, handle the event
+	done := make(chan bool)
+	go w.watchFiles()
+	<-done
+
+	return nil
+}
+
+// Watch dir and each of its subdirectories. Returns the pages and the assets found in the directories
+func (w *siteWatcher) addDir(dir string) ([]string, []string, error) {
+	pages := []string{}
+	assets := []string{}
+
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		absPath, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			// Don't watch the output directory if it is within the root directory
+			if absPath == w.bh.Output {
+				return filepath.SkipDir
+			}
+			return w.bh.watcher.Add(absPath)
+		}
+
+		if w.bh.isPage(absPath, info) {
+			w.pages[absPath] = true
+			pages = append(pages, absPath)
+		} else if w.bh.isAsset(absPath, info) {
+			assets = append(assets, absPath)
+		}
+
+		return nil
+	})
+
+	return pages, assets, err
+}
+
+// Collects filesystem events and handles them once no new events arrive
+func (w *siteWatcher) watchFiles() {
+	changed := make(map[string]bool)
+
+	timer := time.NewTimer(watchDelay)
+	timer.Stop()
+
+	for {
+		select {
+		case event, ok := <-w.bh.watcher.Events:
+			if !ok {
+				// If the watcher was closed, return
+				return
+			}
+
+			// Permission changes don't affect the output
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			p, err := filepath.Abs(event.Name)
+			if err != nil {
+				println(err.Error())
+				continue
+			}
+
+			// Ignore the other files in the configuration file's directory
+			if p != w.bh.configFile && trimPath(w.bh.Root+"/", p) == p && p != w.bh.Root && !w.bh.isThemeFile(p) {
+				continue
+			}
+
+			changed[p] = true
+			timer.Reset(watchDelay)
+		case <-timer.C:
+			if len(changed) > 0 {
+				w.handleChanges(changed)
+				changed = make(map[string]bool)
+			}
+		case err, ok := <-w.bh.watcher.Errors:
+			if !ok {
+				// If the watcher was closed, return
+				return
+			} else {
+				println(err.Error())
+			}
+		}
+	}
+}
+
+// Rebuilds the site for each changed path. The current state of each path is used
+// rather than the events received for it, so that a file which was renamed over or
+// created and then removed within the same burst of events is handled correctly
+func (w *siteWatcher) handleChanges(changed map[string]bool) {
+	bh := w.bh
+	bh.buildTime = time.Now()
+	bh.resetArticles()
+	bh.resetBundles()
+	bh.resetImages()
+	pages := []string{}
+	retry := false
+	feed := false
+	bundles := false
+	sitemap := false
+
+	// Reload the configuration, which may change the site's details or list of articles
+	if changed[bh.configFile] {
+		delete(changed, bh.configFile)
+		if config, err := ReadConfig(bh.configFile); err != nil {
+			println(err.Error())
+		} else {
+			bh.config = config
+			feed = true
+			bundles = true
+			if w.updateTheme() {
+				for p := range w.pages {
+					pages = appendUnique(pages, p)
+				}
+			}
+		}
+
+		// List pages depend on the configuration
+		if err := bh.walkDependencies(bh.configFile, func(p string) error {
+			if w.pages[p] {
+				pages = appendUnique(pages, p)
+			}
+			return nil
+		}); err != nil {
+			println(err.Error())
+		}
+	}
+
+	// Articles whose content changed have a new revision
+	if len(bh.config.Articles) != 0 {
+		if err := bh.recordHistory(); err != nil {
+			println("history: " + err.Error())
+		}
+	}
+
+	for p := range changed {
+		bh.cache.invalidate(p)
+
+		// Rewrite the feed if the file is used by an article
+		if w.feedFiles[p] {
+			feed = true
+		}
+
+		// A file in the site which overrides the theme's, or the theme's file which the site
+		// overrides. Pages which use either are rebuilt, since they may switch between them
+		counterpart := bh.themeCounterpart(p)
+		if counterpart != "" {
+			if err := bh.walkDependencies(counterpart, func(p string) error {
+				if w.pages[p] {
+					pages = appendUnique(pages, p)
+				}
+				return nil
+			}); err != nil {
+				println(err.Error())
+			}
+		}
+
+		info, err := os.Stat(p)
+		if os.IsNotExist(err) {
+			// The file was removed or renamed
+			pages = append(pages, w.remove(p)...)
+			sitemap = true
+
+			// The theme's assets are used again once the site's are removed
+			if bh.isThemeFile(counterpart) {
+				w.writeThemeAssets(counterpart)
+			}
+			continue
+		} else if err != nil {
+			println(err.Error())
+			continue
+		}
+
+		if info.IsDir() {
+			// Watch new directories and build any pages and assets within them
+			found, assets, err := w.addDir(p)
+			if err != nil {
+				println(err.Error())
+			}
+			pages = append(pages, found...)
+			for _, asset := range assets {
+				w.writeAsset(asset)
+			}
+			retry = true
+			continue
+		}
+
+		// Pages which use the data directory are rebuilt when a data file is created
+		if bh.isDataFile(p) {
+			if err := bh.walkDependencies(bh.dataDir(), func(p string) error {
+				if w.pages[p] {
+					pages = appendUnique(pages, p)
+				}
+				return nil
+			}); err != nil {
+				println(err.Error())
+			}
+		}
+
+		if bh.isPage(p, info) {
+			w.pages[p] = true
+		} else {
+			if bh.isAsset(p, info) {
+				// The site's asset replaces the theme's, which has the same output
+				delete(w.assets, counterpart)
+				delete(w.variants, counterpart)
+				w.writeAsset(p)
+			}
+			// A new template, data file or asset may fix a page which failed
+			retry = true
+		}
+
+		// Rewrite all pages dependent on the modified file
+		if err := bh.walkDependencies(p, func(p string) error {
+			if w.pages[p] {
+				pages = appendUnique(pages, p)
+			}
+			return nil
+		}); err != nil {
+			println(err.Error())
+		}
+	}
+
+	if retry {
+		for p := range w.failed {
+			pages = appendUnique(pages, p)
+		}
+	}
+
+	// A change to an article's metadata or the configuration may hide or show articles
+	shown, hiddenChanged := w.updateHidden()
+	for _, p := range shown {
+		pages = appendUnique(pages, p)
+	}
+	if hiddenChanged {
+		feed = true
+	}
+	built := []string{}
+	for _, p := range pages {
+		if !w.hidden[p] {
+			built = append(built, p)
+		}
+	}
+	pages = built
+
+	// Bundles are written before the pages which link to them
+	w.writeBundles(bundles, changed)
+
+	w.compile(pages)
+
+	// The files used by the feed may have changed, for example if
+	// an article's content.html used a new template
+	if w.updateFeedFiles() {
+		feed = true
+	}
+	for p := range changed {
+		if w.feedFiles[p] {
+			feed = true
+		}
+	}
+
+	if feed && len(bh.config.Articles) != 0 {
+		if err := bh.writeFeed(); err != nil {
+			println(err.Error())
+		}
+		w.writeTaxonomies()
+
+		if bh.onGenerate != nil {
+			generated := []string{}
+			for p := range w.taxonomyOutput {
+				generated = append(generated, p)
+			}
+			bh.onGenerate(generated)
+		}
+	}
+
+	if sitemap || feed || len(pages) > 0 {
+		w.writeSitemap()
+	}
+
+	if w.assetsWritten && bh.onAssets != nil {
+		bh.onAssets()
+	}
+	w.assetsWritten = false
+}
+
+// Writes the sitemap of every page and taxonomy page, if the site's domain is set
+func (w *siteWatcher) writeSitemap() {
+	bh := w.bh
+	if bh.config.Domain == "" {
+		return
+	}
+
+	pages := []string{}
+	for p := range w.pages {
+		if !w.hidden[p] {
+			pages = append(pages, p)
+		}
+	}
+	generated := []string{}
+	for p := range w.taxonomyOutput {
+		if path.Ext(p) == ".html" {
+			generated = append(generated, p)
+		}
+	}
+
+	urls, err := bh.sitemapURLs(pages, generated)
+	if err == nil {
+		_, err = bh.writeSitemap(urls, sitemapLimit)
+	}
+	if err != nil {
+		println("sitemap: " + err.Error())
+	}
+}
+
+// Copies the asset at p to the output directory, along with the resized copies of an
+// image. If an output path changed, because it is fingerprinted, the previous output is removed
+func (w *siteWatcher) writeAsset(p string) {
+	out, err := w.bh.writeAsset(p)
+	if err != nil {
+		println(err.Error())
+		return
+	}
+	w.assetsWritten = true
+
+	if prev, ok := w.assets[p]; ok && prev != out {
+		if err := os.Remove(prev); err != nil && !os.IsNotExist(err) {
+			println(err.Error())
+		}
+	}
+	w.assets[p] = out
+
+	if !w.bh.hasImageVariants(p) {
+		return
+	}
+
+	written, err := w.bh.writeImageVariants(p)
+	if err != nil {
+		println(p + ": " + err.Error())
+		return
+	}
+
+	next := make(map[string]bool)
+	for _, out := range written {
+		next[out] = true
+	}
+	for _, prev := range w.variants[p] {
+		if next[prev] {
+			continue
+		}
+		if err := os.Remove(prev); err != nil && !os.IsNotExist(err) {
+			println(err.Error())
+		}
+	}
+	w.variants[p] = written
+}
+
+// Writes each bundle with an input in changed, or every bundle if all is set. The
+// previous output of a bundle is removed if its path changed or it is no longer defined
+func (w *siteWatcher) writeBundles(all bool, changed map[string]bool) {
+	bh := w.bh
+
+	defined := make(map[string]bool)
+	for _, name := range bh.bundleNames() {
+		defined[name] = true
+
+		files, err := bh.bundleInputs(name)
+		if err != nil {
+			println(err.Error())
+			continue
+		}
+
+		write := all
+		for _, p := range files {
+			if changed[p] {
+				write = true
+			}
+		}
+		if !write {
+			continue
+		}
+
+		out, err := bh.writeBundle(name)
+		if err != nil {
+			println(name + ": " + err.Error())
+			continue
+		}
+		if prev, ok := w.bundles[name]; ok && prev != out {
+			if err := os.Remove(prev); err != nil && !os.IsNotExist(err) {
+				println(err.Error())
+			}
+		}
+		w.bundles[name] = out
+		w.assetsWritten = true
+	}
+
+	for name, out := range w.bundles {
+		if defined[name] {
+			continue
+		}
+		delete(w.bundles, name)
+		if err := os.Remove(out); err != nil && !os.IsNotExist(err) {
+			println(err.Error())
+		}
+	}
+}
+
+// Writes the taxonomies and removes the files of terms which no longer have any articles
+func (w *siteWatcher) writeTaxonomies() {
+	written, err := w.bh.writeTaxonomies()
+	if err != nil {
+		println(err.Error())
+		return
+	}
+
+	next := make(map[string]bool)
+	for _, p := range written {
+		next[p] = true
+	}
+
+	for p := range w.taxonomyOutput {
+		if next[p] {
+			continue
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			println(err.Error())
+		}
+	}
+
+	w.taxonomyOutput = next
+}
+
+// Updates the set of files used by the feed. Returns true if the set changed
+func (w *siteWatcher) updateFeedFiles() bool {
+	files, err := w.bh.feedFiles()
+	if err != nil {
+		println(err.Error())
+	}
+
+	// Creating a taxonomy template replaces the default template
+	templates, err := w.bh.taxonomyTemplates()
+	if err != nil {
+		println(err.Error())
+	}
+	files = append(files, templates...)
+	files = append(files, w.bh.taxonomyTemplatePaths()...)
+
+	next := make(map[string]bool)
+	for _, p := range files {
+		next[p] = true
+	}
+
+	changed := len(next) != len(w.feedFiles)
+	for p := range next {
+		if !w.feedFiles[p] {
+			changed = true
+		}
+	}
+
+	w.feedFiles = next
+	return changed
+}
+
+// Writes each of the theme's assets at p, or within p if it is a directory
+func (w *siteWatcher) writeThemeAssets(p string) {
+	if _, err := os.Stat(p); err != nil {
+		return
+	}
+	if err := filepath.Walk(p, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if w.bh.isThemeAsset(p, info) {
+			w.writeAsset(p)
+		}
+		return nil
+	}); err != nil {
+		println(err.Error())
+	}
+}
+
+// Loads the theme named in the configuration. If it changed, the new theme's directories
+// are watched and its assets are written. Returns whether the theme changed, in which
+// case every page is rebuilt, since any of the templates it uses may have moved
+func (w *siteWatcher) updateTheme() bool {
+	bh := w.bh
+	prev := bh.themeDir
+	if err := bh.loadTheme(); err != nil {
+		println(err.Error())
+		return false
+	}
+	if bh.themeDir == prev {
+		return false
+	}
+
+	if bh.themeDir != "" {
+		_, assets, err := w.addDir(bh.themeDir)
+		if err != nil {
+			println(err.Error())
+		}
+		for _, asset := range assets {
+			w.writeAsset(asset)
+		}
+	}
+	return true
+}
+
+// Updates the set of hidden articles. The output of each article which is now hidden is
+// removed. Returns the pages of articles which are no longer hidden, and whether the set changed
+func (w *siteWatcher) updateHidden() ([]string, bool) {
+	bh := w.bh
+	hidden, err := bh.hiddenArticles()
+	if err != nil {
+		println(err.Error())
+		return nil, false
+	}
+
+	next := make(map[string]bool)
+	changed := len(hidden) != len(w.hidden)
+	for _, p := range hidden {
+		next[p] = true
+		if w.hidden[p] {
+			continue
+		}
+
+		changed = true
+		if err := os.Remove(bh.outputPath(p)); err != nil && !os.IsNotExist(err) {
+			println(err.Error())
+		}
+	}
+
+	shown := []string{}
+	for p := range w.hidden {
+		if !next[p] && w.pages[p] {
+			shown = append(shown, p)
+		}
+	}
+
+	bh.hidden = hidden
+	w.hidden = next
+	return shown, changed
+}
+
+// Removes the page, asset or directory at p. The output of each removed page
+// and asset is deleted. Returns the pages which depended on p and must be built again
+func (w *siteWatcher) remove(p string) []string {
+	bh := w.bh
+
+	rebuild := []string{}
+	if err := bh.walkDependencies(p, func(dep string) error {
+		if dep != p && w.pages[dep] {
+			rebuild = appendUnique(rebuild, dep)
+		}
+		return nil
+	}); err != nil {
+		println(err.Error())
+	}
+
+	// If p was a directory, each page within it was removed
+	for page := range w.pages {
+		if page != p && !strings.HasPrefix(page, p+"/") {
+			continue
+		}
+
+		delete(w.pages, page)
+		delete(w.failed, page)
+		bh.forgetDependencies(page)
+
+		if err := os.Remove(bh.outputPath(page)); err != nil && !os.IsNotExist(err) {
+			println(err.Error())
+		}
+		if err := removeOutputs(bh.setListPages(page, nil)); err != nil {
+			println(err.Error())
+		}
+	}
+
+	// If p was a directory, each asset within it was removed
+	for asset, out := range w.assets {
+		if asset != p && !strings.HasPrefix(asset, p+"/") {
+			continue
+		}
+
+		delete(w.assets, asset)
+		if err := os.Remove(out); err != nil && !os.IsNotExist(err) {
+			println(err.Error())
+		}
+
+		for _, variant := range w.variants[asset] {
+			if err := os.Remove(variant); err != nil && !os.IsNotExist(err) {
+				println(err.Error())
+			}
+		}
+		delete(w.variants, asset)
+	}
+
+	bh.forgetDependencies(p)
+
+	// Only return pages which still exist
+	pages := []string{}
+	for _, dep := range rebuild {
+		if w.pages[dep] {
+			pages = append(pages, dep)
+		}
+	}
+	return pages
+}
+
+// Compiles the pages and keeps track of the pages which failed
+func (w *siteWatcher) compile(pages []string) {
+	if len(pages) == 0 {
+		return
+	}
+
+	for _, p := range pages {
+		delete(w.failed, p)
+	}
+
+	if err := w.bh.compilePages(pages); err != nil {
+		for _, err := range err.(BuildErrors) {
+			if pageErr, ok := err.(*PageError); ok {
+				w.failed[pageErr.Page] = true
+			}
+		}
+		println(err.Error())
+	}
+}
@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func Test_siteWatcher_handleChanges(t *testing.T) {
+	bh := makeTempSite(t)
+	if err := bh.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	bh.watcher = unwrap(fsnotify.NewWatcher()).(*fsnotify.Watcher)
+	defer bh.watcher.Close()
+
+	w := &siteWatcher{
+		bh:       bh,
+		pages:    make(map[string]bool),
+		failed:   make(map[string]bool),
+		assets:   make(map[string]string),
+		variants: make(map[string][]string),
+		bundles:  make(map[string]string),
+		hidden:   make(map[string]bool),
+	}
+	if _, _, err := w.addDir(bh.Root); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name, text string) string {
+		p := path.Join(bh.Root, name)
+		f := unwrap(createFile(p)).(*os.File)
+		defer f.Close()
+		if _, err := f.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(path.Join(bh.Output, name))
+		return err == nil
+	}
+
+	// A page created in a new directory is compiled
+	dir := path.Join(bh.Root, "posts")
+	write("posts/first.html", "<h1>First</h1>")
+	w.handleChanges(map[string]bool{dir: true})
+	if !exists("posts/first.html") {
+		t.Errorf("Expected a page in a new directory to be compiled")
+	}
+
+	// A page using a missing template fails, and is compiled once the template exists
+	second := write("posts/second.html", "{{ template \"nav.html\" }}")
+	w.handleChanges(map[string]bool{second: true})
+	if !w.failed[second] {
+		t.Errorf("Expected a page with a missing template to fail")
+	}
+	nav := write(".templates/nav.html", "<nav></nav>")
+	w.handleChanges(map[string]bool{nav: true})
+	if w.failed[second] || !exists("posts/second.html") {
+		t.Errorf("Expected a failed page to be compiled once its template was created")
+	}
+
+	// A page renamed within the same burst of events
+	renamed := path.Join(bh.Root, "posts/renamed.html")
+	if err := os.Rename(path.Join(bh.Root, "posts/first.html"), renamed); err != nil {
+		t.Fatal(err)
+	}
+	w.handleChanges(map[string]bool{path.Join(bh.Root, "posts/first.html"): true, renamed: true})
+	if exists("posts/first.html") || !exists("posts/renamed.html") {
+		t.Errorf("Expected the output of a renamed page to be moved")
+	}
+	if deps := bh.dependents(nav); len(deps) != 1 || deps[0] != second {
+		t.Errorf("Expected only the remaining page to depend on the template, got %v", deps)
+	}
+
+	// Removing a directory removes the output of each page within it
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	w.handleChanges(map[string]bool{dir: true})
+	if exists("posts/renamed.html") || exists("posts/second.html") || len(bh.dependents(nav)) != 0 {
+		t.Errorf("Expected the output of pages in a removed directory to be deleted")
+	}
+
+	// A fingerprinted asset is copied, and its old output is removed when it changes
+	bh.config.Fingerprint = true
+	style := write("style.css", "body {}")
+	w.handleChanges(map[string]bool{style: true})
+	before := w.assets[style]
+	if _, err := os.Stat(before); err != nil {
+		t.Errorf("Expected a new asset to be copied, got %v", err)
+	}
+	write("style.css", "body { color: red; }")
+	w.handleChanges(map[string]bool{style: true})
+	if _, err := os.Stat(before); !os.IsNotExist(err) || w.assets[style] == before {
+		t.Errorf("Expected the previous output of a changed asset to be removed")
+	}
+	if _, err := os.Stat(w.assets[style]); err != nil {
+		t.Errorf("Expected a changed asset to be copied, got %v", err)
+	}
+
+	// Changing a data file rebuilds its page, without compiling the data file
+	if err := ioutil.WriteFile(path.Join(bh.Root, "index_meta.json"), []byte("{\"title\": \"Changed\"}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.handleChanges(map[string]bool{path.Join(bh.Root, "index_meta.json"): true})
+	if exists("index_meta.json") {
+		t.Errorf("Expected the data file not to be compiled as a page")
+	}
+	if b, _ := ioutil.ReadFile(path.Join(bh.Output, "index.html")); string(b) != "<head>Changed</head><h1>Index</h1>" {
+		t.Errorf("Expected the page to be compiled with its new data, got %v", string(b))
+	}
+}
+
+func Test_siteWatcher_handleChanges_feed(t *testing.T) {
+	bh := makeTempSite(t)
+
+	article := path.Join(bh.Root, "post.html")
+	content := path.Join(bh.tmplDir, ".data", "post.html", "content.html")
+	bh.configFile = path.Join(path.Dir(bh.Root), ".bloghead")
+	bh.config = &BlogConfig{
+		Title:      "Before",
+		Domain:     "example.com",
+		Blueprints: make(map[string]string),
+		Articles:   []string{article},
+	}
+	if err := SaveConfig(bh.config, bh.configFile); err != nil {
+		t.Fatal(err)
+	}
+
+	for p, text := range map[string]string{
+		article:           "<h1>Post</h1>",
+		metaPath(article): "{\"title\": \"Post\"}",
+		content:           "<p>Before</p>",
+	} {
+		f := unwrap(createFile(p)).(*os.File)
+		if _, err := f.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+
+	if err := bh.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &siteWatcher{
+		bh:       bh,
+		pages:    make(map[string]bool),
+		failed:   make(map[string]bool),
+		assets:   make(map[string]string),
+		variants: make(map[string][]string),
+		bundles:  make(map[string]string),
+		hidden:   make(map[string]bool),
+	}
+	w.updateFeedFiles()
+
+	feed := func() string {
+		return string(unwrap(ioutil.ReadFile(path.Join(bh.Output, "feed.xml"))).([]byte))
+	}
+
+	// Changing an article's content rewrites the feed
+	if err := ioutil.WriteFile(content, []byte("<p>After</p>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.handleChanges(map[string]bool{content: true})
+	if !strings.Contains(feed(), "<p>After</p>") {
+		t.Errorf("Expected the feed to contain the new content, got %v", feed())
+	}
+
+	// Changing the configuration rewrites the feed
+	bh.config.Title = "After"
+	if err := SaveConfig(bh.config, bh.configFile); err != nil {
+		t.Fatal(err)
+	}
+	bh.config.Title = "Before"
+	w.handleChanges(map[string]bool{bh.configFile: true})
+	if !strings.Contains(feed(), "<title>After</title>") {
+		t.Errorf("Expected the feed to use the new configuration, got %v", feed())
+	}
+}
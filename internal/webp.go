@@ -0,0 +1,634 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"sort"
+)
+
+// Images are converted to WebP with the lossless format, VP8L, which is written with the
+// subtract green and predictor transforms, and backward references to repeated pixels.
+// The format is described at https://developers.google.com/speed/webp/docs/webp_lossless_bitstream_specification
+
+// The largest width or height of a WebP image
+const webpMaxSize = 1 << 14
+
+const (
+	// The size of each tile of the predictor transform is 1 << webpTileBits pixels
+	webpTileBits = 4
+	// The number of length prefix codes, which follow the literal green values in the green alphabet
+	webpLengthCodes = 24
+	// The number of distance prefix codes
+	webpDistanceCodes = 40
+	// The longest backward reference, and the furthest back it can point
+	webpMaxLength = 4096
+	webpWindow    = 1 << 16
+	// The number of earlier positions with the same hash which are tried for a backward reference
+	webpMaxChain = 32
+)
+
+// The order in which the lengths of the code length code are written
+var webpCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// Writes bits to a byte slice, starting from the least significant bit of each byte
+type bitWriter struct {
+	buf   []byte
+	bits  uint64
+	nbits uint
+}
+
+func (w *bitWriter) write(value uint32, n uint) {
+	w.bits |= uint64(value) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits, w.nbits = 0, 0
+	}
+	return w.buf
+}
+
+// A pixel of the encoded image, which is either a literal ARGB value, or a backward
+// reference which copies length pixels from the pixels dist before it
+type webpToken struct {
+	argb   uint32
+	length int
+	dist   int
+}
+
+// A canonical prefix code. Codes are stored bit reversed, since they are written
+// starting from their first bit. A symbol with a length of 0 has no code, unless it
+// is the only symbol, which is written with no bits
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint32
+	single  bool
+}
+
+func (c *prefixCode) write(w *bitWriter, symbol int) {
+	if !c.single {
+		w.write(c.codes[symbol], uint(c.lengths[symbol]))
+	}
+}
+
+// Encodes img as a lossless WebP image
+func encodeWebP(img image.Image) ([]byte, error) {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > webpMaxSize || height > webpMaxSize {
+		return nil, errors.New(fmt.Sprintf("a %vx%v image can't be written as WebP", width, height))
+	}
+
+	nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+
+	argb := make([]uint32, width*height)
+	alpha := false
+	for i := range argb {
+		p := nrgba.Pix[i*4 : i*4+4]
+		argb[i] = uint32(p[3])<<24 | uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+		alpha = alpha || p[3] != 0xff
+	}
+
+	w := &bitWriter{}
+	w.write(0x2f, 8)
+	w.write(uint32(width-1), 14)
+	w.write(uint32(height-1), 14)
+	if alpha {
+		w.write(1, 1)
+	} else {
+		w.write(0, 1)
+	}
+	w.write(0, 3)
+
+	// The subtract green transform
+	w.write(1, 1)
+	w.write(2, 2)
+	subtractGreen(argb)
+
+	// The predictor transform, with the mode of each tile in the green channel of a sub-image
+	w.write(1, 1)
+	w.write(0, 2)
+	w.write(webpTileBits-2, 3)
+	modes, tilesWide := predict(argb, width, height)
+	writeImageData(w, modes, tilesWide, false)
+
+	w.write(0, 1)
+	writeImageData(w, argb, width, true)
+
+	data := w.bytes()
+	var buf bytes.Buffer
+	size := 4 + 8 + len(data) + len(data)%2
+	buf.WriteString("RIFF")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(size))
+	buf.WriteString("WEBPVP8L")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	if len(data)%2 == 1 {
+		buf.WriteByte(0)
+	}
+	return buf.Bytes(), nil
+}
+
+// Subtracts the green value of each pixel from its red and blue values
+func subtractGreen(argb []uint32) {
+	for i, p := range argb {
+		g := (p >> 8) & 0xff
+		r := ((p >> 16) - g) & 0xff
+		b := (p - g) & 0xff
+		argb[i] = p&0xff00ff00 | r<<16 | b
+	}
+}
+
+// Replaces each pixel with its difference from the pixel predicted from its neighbours.
+// Each tile uses the prediction mode which gives the smallest differences. Returns the
+// mode of each tile, and the number of tiles in each row
+func predict(argb []uint32, width, height int) ([]uint32, int) {
+	tile := 1 << webpTileBits
+	tilesWide := (width + tile - 1) / tile
+	tilesHigh := (height + tile - 1) / tile
+
+	modes := make([]uint32, tilesWide*tilesHigh)
+	for ty := 0; ty < tilesHigh; ty++ {
+		for tx := 0; tx < tilesWide; tx++ {
+			best, bestCost := 0, -1
+			for mode := 0; mode < 14; mode++ {
+				cost := 0
+				for y := ty * tile; y < (ty+1)*tile && y < height; y++ {
+					for x := tx * tile; x < (tx+1)*tile && x < width; x++ {
+						cost += residualCost(argb[y*width+x], predictPixel(argb, width, x, y, mode))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			modes[ty*tilesWide+tx] = 0xff000000 | uint32(best)<<8
+		}
+	}
+
+	// The predictions use the pixels before they are replaced, so the image is replaced from the end
+	for y := height - 1; y >= 0; y-- {
+		for x := width - 1; x >= 0; x-- {
+			mode := int(modes[(y>>webpTileBits)*tilesWide+(x>>webpTileBits)]>>8) & 0xff
+			i := y*width + x
+			argb[i] = subPixels(argb[i], predictPixel(argb, width, x, y, mode))
+		}
+	}
+	return modes, tilesWide
+}
+
+// Returns the prediction of the pixel at x, y with the mode. The top row and the left
+// column are predicted from the pixel before them, whatever the mode
+func predictPixel(argb []uint32, width, x, y, mode int) uint32 {
+	i := y*width + x
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return argb[i-1]
+	case x == 0:
+		return argb[i-width]
+	}
+
+	l, t, tl := argb[i-1], argb[i-width], argb[i-width-1]
+	// The pixel to the top right of the last column is the first pixel of the current row
+	tr := argb[i-width+1]
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return average2(average2(l, tr), t)
+	case 6:
+		return average2(l, tl)
+	case 7:
+		return average2(l, t)
+	case 8:
+		return average2(tl, t)
+	case 9:
+		return average2(t, tr)
+	case 10:
+		return average2(average2(l, tl), average2(t, tr))
+	case 11:
+		return selectPixel(l, t, tl)
+	case 12:
+		return mapChannels(func(c uint) int {
+			return int(channel(l, c)) + int(channel(t, c)) - int(channel(tl, c))
+		})
+	default:
+		avg := average2(l, t)
+		return mapChannels(func(c uint) int {
+			a := int(channel(avg, c))
+			return a + (a-int(channel(tl, c)))/2
+		})
+	}
+}
+
+// Returns the channel of the pixel which starts at the bit c
+func channel(p uint32, c uint) uint32 {
+	return (p >> c) & 0xff
+}
+
+// Returns the pixel with each channel set by f, clamped to 0-255
+func mapChannels(f func(c uint) int) uint32 {
+	var p uint32
+	for c := uint(0); c < 32; c += 8 {
+		v := f(c)
+		if v < 0 {
+			v = 0
+		} else if v > 0xff {
+			v = 0xff
+		}
+		p |= uint32(v) << c
+	}
+	return p
+}
+
+func average2(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+// Returns whichever of the left and top pixels is closest to the gradient l + t - tl
+func selectPixel(l, t, tl uint32) uint32 {
+	pl, pt := 0, 0
+	for c := uint(0); c < 32; c += 8 {
+		pl += abs(int(channel(t, c)) - int(channel(tl, c)))
+		pt += abs(int(channel(l, c)) - int(channel(tl, c)))
+	}
+	if pl < pt {
+		return l
+	}
+	return t
+}
+
+// Subtracts each channel of b from a, modulo 256
+func subPixels(a, b uint32) uint32 {
+	var p uint32
+	for c := uint(0); c < 32; c += 8 {
+		p |= ((channel(a, c) - channel(b, c)) & 0xff) << c
+	}
+	return p
+}
+
+// Returns an estimate of the cost of coding the difference between the pixel and its prediction
+func residualCost(p, prediction uint32) int {
+	d := subPixels(p, prediction)
+	cost := 0
+	for c := uint(0); c < 32; c += 8 {
+		v := int(channel(d, c))
+		if v > 128 {
+			v = 256 - v
+		}
+		cost += v
+	}
+	return cost
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Writes the pixels of an image which is width pixels wide, preceded by their prefix codes.
+// The main image also records that it doesn't use meta prefix codes
+func writeImageData(w *bitWriter, argb []uint32, width int, main bool) {
+	// No color cache
+	w.write(0, 1)
+	if main {
+		w.write(0, 1)
+	}
+
+	tokens := backwardReferences(argb, width)
+
+	counts := [5][]int{
+		make([]int, 256+webpLengthCodes),
+		make([]int, 256),
+		make([]int, 256),
+		make([]int, 256),
+		make([]int, webpDistanceCodes),
+	}
+	for _, t := range tokens {
+		if t.length == 0 {
+			counts[0][channel(t.argb, 8)]++
+			counts[1][channel(t.argb, 16)]++
+			counts[2][channel(t.argb, 0)]++
+			counts[3][channel(t.argb, 24)]++
+			continue
+		}
+		code, _, _ := prefixEncode(t.length)
+		counts[0][256+code]++
+		code, _, _ = prefixEncode(distanceCode(t.dist, width))
+		counts[4][code]++
+	}
+
+	codes := [5]*prefixCode{}
+	for i := range counts {
+		codes[i] = writePrefixCode(w, counts[i])
+	}
+
+	for _, t := range tokens {
+		if t.length == 0 {
+			codes[0].write(w, int(channel(t.argb, 8)))
+			codes[1].write(w, int(channel(t.argb, 16)))
+			codes[2].write(w, int(channel(t.argb, 0)))
+			codes[3].write(w, int(channel(t.argb, 24)))
+			continue
+		}
+		code, n, extra := prefixEncode(t.length)
+		codes[0].write(w, 256+code)
+		w.write(extra, n)
+		code, n, extra = prefixEncode(distanceCode(t.dist, width))
+		codes[4].write(w, code)
+		w.write(extra, n)
+	}
+}
+
+// Splits the pixels into literals and backward references. The pixel above and the
+// pixel to the left are tried first, then earlier pixels which start with the same two pixels
+func backwardReferences(argb []uint32, width int) []webpToken {
+	const hashBits = 15
+	head := make([]int, 1<<hashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int, len(argb))
+	hash := func(i int) int {
+		return int((argb[i]*0x1e35a7bd + argb[i+1]*0x2f0f1a27) >> (32 - hashBits))
+	}
+	insert := func(i int) {
+		if i+1 < len(argb) {
+			h := hash(i)
+			prev[i] = head[h]
+			head[h] = i
+		}
+	}
+	matchLength := func(i, dist int) int {
+		n := 0
+		for i+n < len(argb) && n < webpMaxLength && argb[i+n] == argb[i+n-dist] {
+			n++
+		}
+		return n
+	}
+
+	tokens := []webpToken{}
+	for i := 0; i < len(argb); {
+		length, dist := 0, 0
+		for _, d := range []int{width, 1} {
+			if d <= i {
+				if n := matchLength(i, d); n > length {
+					length, dist = n, d
+				}
+			}
+		}
+		if i+1 < len(argb) {
+			for j, tries := head[hash(i)], 0; j >= 0 && i-j <= webpWindow && tries < webpMaxChain; j, tries = prev[j], tries+1 {
+				if n := matchLength(i, i-j); n > length {
+					length, dist = n, i-j
+				}
+			}
+		}
+
+		if length < 3 {
+			tokens = append(tokens, webpToken{argb: argb[i]})
+			insert(i)
+			i++
+			continue
+		}
+		tokens = append(tokens, webpToken{length: length, dist: dist})
+		for end := i + length; i < end; i++ {
+			insert(i)
+		}
+	}
+	return tokens
+}
+
+// Returns the distance code of a backward reference to the pixel dist before the current
+// pixel. The codes 1 and 2 are the pixels above and to the left, and other distances
+// follow the 120 codes for the pixels near the current pixel
+func distanceCode(dist, width int) int {
+	switch dist {
+	case width:
+		return 1
+	case 1:
+		return 2
+	}
+	return dist + 120
+}
+
+// Returns the prefix code of the length or distance code value, along with
+// the number of extra bits and their value
+func prefixEncode(value int) (int, uint, uint32) {
+	d := value - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+	high := 0
+	for d>>(high+1) != 0 {
+		high++
+	}
+	second := (d >> (high - 1)) & 1
+	extra := uint(high - 1)
+	return 2*high + second, extra, uint32(d & (1<<extra - 1))
+}
+
+// Writes the prefix code for the symbol counts, and returns the code. A code with up
+// to two symbols below 256 is written as a simple code, and any other code is written as
+// the length of each symbol's code, which are themselves written with a prefix code
+func writePrefixCode(w *bitWriter, counts []int) *prefixCode {
+	used := []int{}
+	for s, n := range counts {
+		if n > 0 {
+			used = append(used, s)
+		}
+	}
+
+	if len(used) <= 2 && (len(used) == 0 || used[len(used)-1] < 256) {
+		if len(used) == 0 {
+			used = []int{0}
+		}
+		w.write(1, 1)
+		w.write(uint32(len(used)-1), 1)
+		w.write(1, 1)
+		lengths := make([]uint8, len(counts))
+		for i, s := range used {
+			w.write(uint32(s), 8)
+			lengths[used[i]] = 1
+		}
+		return newPrefixCode(lengths)
+	}
+
+	lengths := huffmanLengths(counts, 15)
+	code := newPrefixCode(lengths)
+	w.write(0, 1)
+
+	// The lengths are written with the symbols 0-15, and runs of zero lengths with 17 and 18
+	type run struct {
+		symbol int
+		extra  uint32
+	}
+	runs := []run{}
+	for i := 0; i < len(lengths); {
+		n := 1
+		for i+n < len(lengths) && lengths[i+n] == 0 && lengths[i] == 0 && n < 138 {
+			n++
+		}
+		switch {
+		case lengths[i] != 0 || n < 3:
+			runs = append(runs, run{int(lengths[i]), 0})
+			n = 1
+		case n <= 10:
+			runs = append(runs, run{17, uint32(n - 3)})
+		default:
+			runs = append(runs, run{18, uint32(n - 11)})
+		}
+		i += n
+	}
+
+	lengthCounts := make([]int, 19)
+	for _, r := range runs {
+		lengthCounts[r.symbol]++
+	}
+	lengthCode := newPrefixCode(huffmanLengths(lengthCounts, 7))
+
+	n := len(webpCodeLengthOrder)
+	for n > 4 && lengthCode.lengths[webpCodeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	w.write(uint32(n-4), 4)
+	for _, s := range webpCodeLengthOrder[:n] {
+		w.write(uint32(lengthCode.lengths[s]), 3)
+	}
+
+	// Every symbol's length is written
+	w.write(0, 1)
+	for _, r := range runs {
+		lengthCode.write(w, r.symbol)
+		switch r.symbol {
+		case 17:
+			w.write(r.extra, 3)
+		case 18:
+			w.write(r.extra, 7)
+		}
+	}
+	return code
+}
+
+// Returns the canonical prefix code with the lengths
+func newPrefixCode(lengths []uint8) *prefixCode {
+	c := &prefixCode{lengths: lengths, codes: make([]uint32, len(lengths))}
+
+	var count [16]uint32
+	used := 0
+	for _, l := range lengths {
+		if l > 0 {
+			count[l]++
+			used++
+		}
+	}
+	c.single = used <= 1
+
+	var next [16]uint32
+	code := uint32(0)
+	for l := 1; l < 16; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	for s, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		// Reverse the code, since it is written starting from its first bit
+		v, rev := next[l], uint32(0)
+		for i := uint8(0); i < l; i++ {
+			rev = rev<<1 | (v>>i)&1
+		}
+		c.codes[s] = rev
+		next[l]++
+	}
+	return c
+}
+
+// Returns the length of the Huffman code of each symbol, given the number of times each
+// symbol is used. The codes are at most limit bits long. If a code would be longer, the
+// counts of the rarest symbols are raised until it isn't
+func huffmanLengths(counts []int, limit int) []uint8 {
+	type node struct {
+		count       int
+		left, right int
+	}
+
+	for min := 1; ; min *= 2 {
+		lengths := make([]uint8, len(counts))
+		nodes := []node{}
+		for s, n := range counts {
+			if n > 0 {
+				if n < min {
+					n = min
+				}
+				nodes = append(nodes, node{n, -1, s})
+			}
+		}
+		if len(nodes) == 0 {
+			return lengths
+		}
+		if len(nodes) == 1 {
+			lengths[nodes[0].right] = 1
+			return lengths
+		}
+
+		// Merge the two nodes with the smallest counts until one is left
+		queue := make([]int, len(nodes))
+		for i := range queue {
+			queue[i] = i
+		}
+		for len(queue) > 1 {
+			sort.SliceStable(queue, func(i, j int) bool {
+				return nodes[queue[i]].count < nodes[queue[j]].count
+			})
+			nodes = append(nodes, node{nodes[queue[0]].count + nodes[queue[1]].count, queue[0], queue[1]})
+			queue = append(queue[2:], len(nodes)-1)
+		}
+
+		var walk func(i int, depth uint8)
+		walk = func(i int, depth uint8) {
+			if nodes[i].left < 0 {
+				lengths[nodes[i].right] = depth
+				return
+			}
+			walk(nodes[i].left, depth+1)
+			walk(nodes[i].right, depth+1)
+		}
+		walk(queue[0], 0)
+
+		longest := uint8(0)
+		for _, l := range lengths {
+			if l > longest {
+				longest = l
+			}
+		}
+		if int(longest) <= limit {
+			return lengths
+		}
+	}
+}
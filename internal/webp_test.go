@@ -0,0 +1,372 @@
+package internal
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// Reads bits starting from the least significant bit of each byte
+type bitReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *bitReader) read(n int) (uint32, error) {
+	var v uint32
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.buf)*8 {
+			return 0, errors.New("unexpected end of data")
+		}
+		v |= uint32(r.buf[r.pos/8]>>(r.pos%8)&1) << i
+		r.pos++
+	}
+	return v, nil
+}
+
+// A prefix code read by the decoder, keyed by the length and value of each code
+type testCode struct {
+	symbols map[[2]uint32]int
+	single  int
+}
+
+func newTestCode(lengths []int) (*testCode, error) {
+	c := &testCode{symbols: make(map[[2]uint32]int), single: -1}
+	var count [16]uint32
+	used := []int{}
+	for s, l := range lengths {
+		if l > 0 {
+			count[l]++
+			used = append(used, s)
+		}
+	}
+	if len(used) == 0 {
+		return nil, errors.New("empty prefix code")
+	}
+	if len(used) == 1 {
+		c.single = used[0]
+		return c, nil
+	}
+
+	var next [16]uint32
+	code := uint32(0)
+	for l := 1; l < 16; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	for s, l := range lengths {
+		if l > 0 {
+			c.symbols[[2]uint32{uint32(l), next[l]}] = s
+			next[l]++
+		}
+	}
+	return c, nil
+}
+
+func (c *testCode) read(r *bitReader) (int, error) {
+	if c.single >= 0 {
+		return c.single, nil
+	}
+	code := uint32(0)
+	for l := uint32(1); l < 16; l++ {
+		bit, err := r.read(1)
+		if err != nil {
+			return 0, err
+		}
+		code = code<<1 | bit
+		if s, ok := c.symbols[[2]uint32{l, code}]; ok {
+			return s, nil
+		}
+	}
+	return 0, errors.New("invalid code")
+}
+
+func readTestCode(r *bitReader, size int) (*testCode, error) {
+	lengths := make([]int, size)
+	if simple, _ := r.read(1); simple == 1 {
+		n, _ := r.read(1)
+		first, _ := r.read(1)
+		s, _ := r.read(1 + 7*int(first))
+		lengths[s] = 1
+		if n == 1 {
+			s, _ = r.read(8)
+			lengths[s] = 1
+		}
+		return newTestCode(lengths)
+	}
+
+	n, _ := r.read(4)
+	lengthLengths := make([]int, 19)
+	for _, s := range webpCodeLengthOrder[:n+4] {
+		l, _ := r.read(3)
+		lengthLengths[s] = int(l)
+	}
+	lengthCode, err := newTestCode(lengthLengths)
+	if err != nil {
+		return nil, err
+	}
+	if max, _ := r.read(1); max != 0 {
+		return nil, errors.New("max_symbol isn't supported")
+	}
+
+	for i := 0; i < size; {
+		s, err := lengthCode.read(r)
+		if err != nil {
+			return nil, err
+		}
+		switch s {
+		case 17:
+			n, _ := r.read(3)
+			i += int(n) + 3
+		case 18:
+			n, _ := r.read(7)
+			i += int(n) + 11
+		case 16:
+			return nil, errors.New("repeated lengths aren't supported")
+		default:
+			lengths[i] = s
+			i++
+		}
+	}
+	return newTestCode(lengths)
+}
+
+func readPrefixValue(r *bitReader, prefix int) int {
+	if prefix < 4 {
+		return prefix + 1
+	}
+	extra := (prefix - 2) >> 1
+	offset := (2 + prefix&1) << extra
+	v, _ := r.read(extra)
+	return offset + int(v) + 1
+}
+
+func readTestImage(r *bitReader, width, height int, main bool) ([]uint32, error) {
+	if cache, _ := r.read(1); cache != 0 {
+		return nil, errors.New("color cache isn't supported")
+	}
+	if main {
+		if meta, _ := r.read(1); meta != 0 {
+			return nil, errors.New("meta prefix codes aren't supported")
+		}
+	}
+
+	codes := make([]*testCode, 5)
+	for i, size := range []int{256 + webpLengthCodes, 256, 256, 256, webpDistanceCodes} {
+		code, err := readTestCode(r, size)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+	}
+
+	argb := make([]uint32, 0, width*height)
+	for len(argb) < width*height {
+		g, err := codes[0].read(r)
+		if err != nil {
+			return nil, err
+		}
+		if g < 256 {
+			red, _ := codes[1].read(r)
+			blue, _ := codes[2].read(r)
+			alpha, _ := codes[3].read(r)
+			argb = append(argb, uint32(alpha)<<24|uint32(red)<<16|uint32(g)<<8|uint32(blue))
+			continue
+		}
+
+		length := readPrefixValue(r, g-256)
+		d, err := codes[4].read(r)
+		if err != nil {
+			return nil, err
+		}
+		dist := readPrefixValue(r, d)
+		switch {
+		case dist == 1:
+			dist = width
+		case dist == 2:
+			dist = 1
+		case dist > 120:
+			dist -= 120
+		default:
+			return nil, errors.New("distance code isn't supported")
+		}
+		if dist > len(argb) || len(argb)+length > width*height {
+			return nil, errors.New("invalid backward reference")
+		}
+		for i := 0; i < length; i++ {
+			argb = append(argb, argb[len(argb)-dist])
+		}
+	}
+	return argb, nil
+}
+
+// Decodes a lossless WebP image written by encodeWebP, which uses the
+// subtract green and predictor transforms and no color cache
+func decodeTestWebP(b []byte) (*image.NRGBA, error) {
+	if len(b) < 21 || string(b[0:4]) != "RIFF" || string(b[8:16]) != "WEBPVP8L" {
+		return nil, errors.New("not a lossless WebP image")
+	}
+	if int(binary.LittleEndian.Uint32(b[4:8])) != len(b)-8 {
+		return nil, errors.New("wrong RIFF size")
+	}
+	r := &bitReader{buf: b[20:]}
+
+	if sig, _ := r.read(8); sig != 0x2f {
+		return nil, errors.New("wrong signature")
+	}
+	w, _ := r.read(14)
+	h, _ := r.read(14)
+	width, height := int(w)+1, int(h)+1
+	_, _ = r.read(1)
+	if version, _ := r.read(3); version != 0 {
+		return nil, errors.New("wrong version")
+	}
+
+	var modes []uint32
+	tileBits, green := 0, false
+	for {
+		if more, _ := r.read(1); more == 0 {
+			break
+		}
+		switch t, _ := r.read(2); t {
+		case 0:
+			bits, _ := r.read(3)
+			tileBits = int(bits) + 2
+			tile := 1 << tileBits
+			var err error
+			if modes, err = readTestImage(r, (width+tile-1)/tile, (height+tile-1)/tile, false); err != nil {
+				return nil, err
+			}
+		case 2:
+			green = true
+		default:
+			return nil, errors.New("transform isn't supported")
+		}
+	}
+
+	argb, err := readTestImage(r, width, height, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if modes != nil {
+		tilesWide := (width + 1<<tileBits - 1) >> tileBits
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				mode := int(modes[(y>>tileBits)*tilesWide+(x>>tileBits)]>>8) & 0xff
+				i := y*width + x
+				pred := predictPixel(argb, width, x, y, mode)
+				var p uint32
+				for c := uint(0); c < 32; c += 8 {
+					p |= ((channel(argb[i], c) + channel(pred, c)) & 0xff) << c
+				}
+				argb[i] = p
+			}
+		}
+	}
+	if green {
+		for i, p := range argb {
+			g := channel(p, 8)
+			argb[i] = p&0xff00ff00 | ((channel(p, 16)+g)&0xff)<<16 | (channel(p, 0)+g)&0xff
+		}
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i, p := range argb {
+		img.Pix[i*4], img.Pix[i*4+1], img.Pix[i*4+2], img.Pix[i*4+3] = uint8(p>>16), uint8(p>>8), uint8(p), uint8(p>>24)
+	}
+	return img, nil
+}
+
+func Test_encodeWebP(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name          string
+		width, height int
+		pixel         func(x, y int) color.NRGBA
+	}{
+		{"Single pixel", 1, 1, func(x, y int) color.NRGBA { return color.NRGBA{1, 2, 3, 4} }},
+		{"Solid", 7, 5, func(x, y int) color.NRGBA { return color.NRGBA{10, 200, 30, 255} }},
+		{"Gradient", 300, 200, func(x, y int) color.NRGBA { return color.NRGBA{uint8(x), uint8(y), uint8(x + y), 255} }},
+		{"Stripes", 64, 64, func(x, y int) color.NRGBA { return color.NRGBA{uint8(x / 4 % 2 * 255), 0, uint8(y % 3 * 100), 255} }},
+		{"Column", 1, 500, func(x, y int) color.NRGBA { return color.NRGBA{uint8(y % 7), 3, 9, 255} }},
+		{"Noise", 123, 77, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(r.Intn(256)), uint8(r.Intn(256)), uint8(r.Intn(256)), uint8(r.Intn(256))}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := image.NewNRGBA(image.Rect(0, 0, tt.width, tt.height))
+			for y := 0; y < tt.height; y++ {
+				for x := 0; x < tt.width; x++ {
+					src.SetNRGBA(x, y, tt.pixel(x, y))
+				}
+			}
+
+			b, err := encodeWebP(src)
+			if err != nil {
+				t.Fatalf("encodeWebP() error = %v", err)
+			}
+			got, err := decodeTestWebP(b)
+			if err != nil {
+				t.Fatalf("encodeWebP() wrote an image which can't be decoded: %v", err)
+			}
+			if got.Bounds() != src.Bounds() {
+				t.Fatalf("encodeWebP() wrote a %v image, want %v", got.Bounds(), src.Bounds())
+			}
+			for i := range src.Pix {
+				if got.Pix[i] != src.Pix[i] {
+					t.Fatalf("encodeWebP() changed pixel %v from %v to %v", i/4, src.Pix[i/4*4:i/4*4+4], got.Pix[i/4*4:i/4*4+4])
+				}
+			}
+		})
+	}
+}
+
+func Test_huffmanLengths_limit(t *testing.T) {
+	// Counts which follow the Fibonacci sequence give the longest codes
+	counts := make([]int, 30)
+	a, b := 1, 1
+	for i := range counts {
+		counts[i] = a
+		a, b = b, a+b
+	}
+
+	lengths := huffmanLengths(counts, 15)
+	kraft := 0.0
+	for _, l := range lengths {
+		if l == 0 || l > 15 {
+			t.Fatalf("huffmanLengths() = %v, want lengths from 1 to 15", lengths)
+		}
+		kraft += 1 / float64(uint(1)<<l)
+	}
+	if kraft != 1 {
+		t.Errorf("huffmanLengths() = %v, which isn't a complete code", lengths)
+	}
+}
+
+func Test_predictPixel(t *testing.T) {
+	gray := func(v uint32) uint32 {
+		return v<<24 | v<<16 | v<<8 | v
+	}
+	// The top left, top and top right pixels, then the left pixel of the predicted pixel
+	argb := []uint32{gray(40), gray(48), gray(80), gray(16), 0, 0}
+
+	want := []uint32{0xff000000, 16, 48, 80, 40, 48, 28, 32, 44, 64, 46, 16, 24, 28}
+	for mode, w := range want {
+		if mode > 0 {
+			w = gray(w)
+		}
+		if got := predictPixel(argb, 3, 1, 1, mode); got != w {
+			t.Errorf("predictPixel() with mode %v = %#x, want %#x", mode, got, w)
+		}
+	}
+
+	// The pixel to the top right of the last column is the first pixel of the row
+	if got := predictPixel(argb, 3, 2, 1, 3); got != gray(16) {
+		t.Errorf("predictPixel() of the last column = %#x, want %#x", got, gray(16))
+	}
+}